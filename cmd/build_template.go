@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/kuper-tech/protokaf/internal/calldata"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// templateBuilder builds a JSON template with calldata functions for the message.
+type templateBuilder struct {
+	*messageBuilder
+	b strings.Builder
+}
+
+func buildTemplate(mb *messageBuilder, md *desc.MessageDescriptor) string {
+	t := &templateBuilder{messageBuilder: mb}
+	t.writeMessage(md, 0)
+
+	return t.b.String()
+}
+
+func (t *templateBuilder) writeMessage(md *desc.MessageDescriptor, depth int) {
+	t.enter(md)
+	defer t.leave(md)
+
+	fields := make([]*desc.FieldDescriptor, 0, len(md.GetFields()))
+	for _, field := range md.GetFields() {
+		oneOf := field.GetOneOf()
+		if oneOf == nil {
+			fields = append(fields, field)
+			continue
+		}
+
+		// all choices are handled at once
+		if field != oneOf.GetChoices()[0] {
+			continue
+		}
+
+		for _, choice := range t.oneOfChoices(oneOf) {
+			if !t.expandable(choice) {
+				continue
+			}
+
+			fields = append(fields, choice)
+			if !t.allChoices() {
+				break
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		t.b.WriteString("{}")
+		return
+	}
+
+	t.b.WriteString("{\n")
+	for i, field := range fields {
+		t.indent(depth + 1)
+		fmt.Fprintf(&t.b, "%q: ", field.GetJSONName())
+
+		switch {
+		case field.IsMap() && !t.expandable(field.GetMapValueType()):
+			t.b.WriteString("{}")
+		case field.IsMap():
+			t.b.WriteString("{\n")
+			t.indent(depth + 2)
+			fmt.Fprintf(&t.b, "%s: ", mapKeyTemplateHint(field.GetMapKeyType()))
+			t.writeValue(field.GetMapValueType(), depth+2)
+			t.b.WriteString("\n")
+			t.indent(depth + 1)
+			t.b.WriteString("}")
+		case field.IsRepeated() && !t.expandable(field):
+			t.b.WriteString("[]")
+		case field.IsRepeated():
+			t.b.WriteString("[\n")
+			t.indent(depth + 2)
+			t.writeValue(field, depth+2)
+			t.b.WriteString("\n")
+			t.indent(depth + 1)
+			t.b.WriteString("]")
+		default:
+			t.writeValue(field, depth+1)
+		}
+
+		if i != len(fields)-1 {
+			t.b.WriteString(",")
+		}
+		t.b.WriteString("\n")
+	}
+	t.indent(depth)
+	t.b.WriteString("}")
+}
+
+func (t *templateBuilder) writeValue(field *desc.FieldDescriptor, depth int) {
+	if field.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE {
+		t.b.WriteString(scalarTemplateHint(field))
+		return
+	}
+
+	md := field.GetMessageType()
+	if !t.expandable(field) {
+		t.b.WriteString("null")
+		return
+	}
+
+	switch md.GetFullyQualifiedName() {
+	case "google.protobuf.Timestamp":
+		t.b.WriteString(calldata.HintTimestamp)
+	case "google.protobuf.Duration":
+		t.b.WriteString(calldata.HintDuration)
+	case "google.protobuf.Any", "google.protobuf.Value":
+		t.b.WriteString("null")
+	case "google.protobuf.Struct":
+		t.b.WriteString("{}")
+	case "google.protobuf.ListValue":
+		t.b.WriteString("[]")
+	case "google.protobuf.FieldMask":
+		t.b.WriteString(`""`)
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		// wrapper is marshaled as its value, but named as the outer field
+		value := md.FindFieldByName("value")
+		if value.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING {
+			t.b.WriteString(calldata.StringHint(field.GetName()))
+		} else {
+			t.b.WriteString(scalarTemplateHint(value))
+		}
+	default:
+		t.writeMessage(md, depth)
+	}
+}
+
+func (t *templateBuilder) indent(depth int) {
+	t.b.WriteString(strings.Repeat(buildIndent, depth))
+}
+
+func scalarTemplateHint(field *desc.FieldDescriptor) string {
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64:
+		return calldata.HintInt
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+		descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return calldata.HintFloat
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return calldata.HintBool
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return `""`
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return calldata.StringHint(field.GetName())
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		values := field.GetEnumType().GetValues()
+		names := make([]string, 0, len(values))
+		for _, v := range values {
+			names = append(names, v.GetName())
+		}
+
+		return calldata.EnumHint(names)
+	}
+
+	return "null"
+}
+
+// mapKeyTemplateHint returns a hint for map key, JSON object keys are always strings.
+func mapKeyTemplateHint(field *desc.FieldDescriptor) string {
+	switch field.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return calldata.HintString
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return `"{{randomBoolean}}"`
+	}
+
+	return fmt.Sprintf("%q", calldata.HintInt)
+}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/kuper-tech/protokaf/internal/calldata"
+	"github.com/kuper-tech/protokaf/internal/proto"
 	"github.com/stretchr/testify/require"
 )
 
@@ -75,3 +78,123 @@ func Test_NewBuildCmd(t *testing.T) {
 	require.Equal(t, "", stderr)
 	require.Contains(t, stdout, expected)
 }
+
+func Test_NewBuildCmd_Template(t *testing.T) {
+	cmd := NewBuildCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{"ExampleMessage", "--template", "--proto", "../internal/proto/testdata/types.proto"})
+
+	stdout, stderr, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	require.Equal(t, "", stderr)
+	require.Contains(t, stdout, `"int32Field": {{randomNumber 0 100}},`)
+	require.Contains(t, stdout, `"stringField": {{randomString 10 | quote}},`)
+	require.Contains(t, stdout, `"enumField": {{randomStringSample "UNKNOWN" "OPTION_ONE" "OPTION_TWO" | quote}},`)
+	require.Contains(t, stdout, `"timestampField": {{.Timestamp | quote}},`)
+
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/types.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("ExampleMessage")
+	require.Nil(t, err)
+
+	// skip log lines around the template
+	data := stdout[strings.Index(stdout, "{\n") : strings.LastIndex(stdout, "\n}")+2]
+
+	tmpl, err := calldata.ParseTemplate([]byte(data))
+	require.Nil(t, err)
+
+	b, err := calldata.NewCallData(0).Execute(tmpl)
+	require.Nil(t, err)
+
+	_, err = proto.Unmarshal(b.Bytes(), md)
+	require.Nil(t, err)
+}
+
+func Test_NewBuildCmd_Recursive(t *testing.T) {
+	cmd := NewBuildCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{
+		"TreeNode",
+		"--max-depth", "2",
+		"--oneof", "text",
+		"--proto", "../internal/proto/testdata/recursive.proto",
+	})
+
+	expected := `{
+  "name": "",
+  "children": [
+    {"name": "", "children": [], "parent": null, "text": ""}
+  ],
+  "parent": {"name": "", "children": [], "parent": null, "text": ""},
+  "text": ""
+}`
+
+	stdout, stderr, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	require.Equal(t, "", stderr)
+	require.JSONEq(t, expected, buildOutputJSON(t, stdout))
+}
+
+func Test_NewBuildCmd_OneOfAll(t *testing.T) {
+	cmd := NewBuildCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{
+		"TreeNode",
+		"--max-depth", "1",
+		"--oneof", "all",
+		"--proto", "../internal/proto/testdata/recursive.proto",
+	})
+
+	expected := `{"name": "", "children": [], "parent": null, "number": 0, "text": ""}`
+
+	stdout, stderr, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	require.Equal(t, "", stderr)
+	require.JSONEq(t, expected, buildOutputJSON(t, stdout))
+}
+
+func Test_NewBuildCmd_OneOfAllMap(t *testing.T) {
+	cmd := NewBuildCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{
+		"Forest",
+		"--max-depth", "1",
+		"--oneof", "all",
+		"--proto", "../internal/proto/testdata/recursive.proto",
+	})
+
+	// alternatives of message values of maps are written too
+	expected := `{"trees": {"": {"name": "", "children": [], "parent": null, "number": 0, "text": ""}}}`
+
+	stdout, stderr, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	require.Equal(t, "", stderr)
+	require.JSONEq(t, expected, buildOutputJSON(t, stdout))
+}
+
+func Test_NewBuildCmd_UnknownOneOf(t *testing.T) {
+	cmd := NewBuildCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{
+		"TreeNode",
+		"--oneof", "txt",
+		"--proto", "../internal/proto/testdata/recursive.proto",
+	})
+
+	_, _, err := getCommandOut(t, cmd)
+
+	require.EqualError(t, err, `oneof flag has unknown choice: "txt" is not a oneof field of example.TreeNode`)
+}
+
+// buildOutputJSON returns JSON of the build command output without log lines around it.
+func buildOutputJSON(t *testing.T, stdout string) string {
+	start, end := strings.Index(stdout, "{\n"), strings.LastIndex(stdout, "\n}")
+	require.True(t, start >= 0 && end > start, "no JSON in output: %s", stdout)
+
+	return stdout[start : end+2]
+}
@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
@@ -9,11 +15,34 @@ import (
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
+const (
+	// OneOfFlagFirstValue builds the first choice of every oneof.
+	OneOfFlagFirstValue = "first"
+
+	// OneOfFlagAllValue builds all choices of every oneof.
+	OneOfFlagAllValue = "all"
+
+	buildIndent = "  "
+)
+
 func NewBuildCmd() *cobra.Command {
+	var (
+		templateFlag bool
+		maxDepthFlag int
+		oneOfFlag    []string
+	)
+
 	cmd := &cobra.Command{
 		Use:   "build <MessageName>",
 		Short: "Build json by proto message",
 		Args:  messageNameRequired,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if maxDepthFlag < 1 {
+				return fmt.Errorf("max-depth flag has invalid value: %d, must be greater than zero", maxDepthFlag)
+			}
+
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			// parse protofiles & create proto object
 			p, err := parseProtofiles()
@@ -26,49 +55,136 @@ func NewBuildCmd() *cobra.Command {
 				return
 			}
 
-			msg := buildMessage(dynamic.NewMessage(messageDescriptor))
+			b := newMessageBuilder(maxDepthFlag, oneOfFlag)
+			if err = b.checkOneOfChoices(messageDescriptor); err != nil {
+				return
+			}
+
+			if templateFlag {
+				cmd.Println(buildTemplate(b, messageDescriptor))
+				return
+			}
+
+			msg := b.buildMessage(dynamic.NewMessage(messageDescriptor))
 
-			b, err := msg.MarshalJSONPB(&jsonpb.Marshaler{
-				EmitDefaults: true,
-				Indent:       "  ",
-			})
+			data, err := b.marshalJSON(msg)
 			if err != nil {
 				return
 			}
 
-			cmd.Println(string(b))
+			cmd.Println(string(data))
 
 			return
 		},
 	}
 
+	flags := cmd.Flags()
+
+	flags.BoolVar(&templateFlag, "template", false, "Build template with functions for produce data")
+	flags.IntVar(&maxDepthFlag, "max-depth", 3, "How many times a recursive message may be nested into itself")
+	flags.StringSliceVar(&oneOfFlag, "oneof", []string{OneOfFlagFirstValue}, fmt.Sprintf(
+		"Oneof choices to build: %s, %s or field name(s). "+
+			"JSON built with %s has several members of a oneof and must be edited to a single member to be produced",
+		OneOfFlagFirstValue, OneOfFlagAllValue, OneOfFlagAllValue,
+	))
+
 	return cmd
 }
 
-func buildMessage(message *dynamic.Message) *dynamic.Message {
-	for _, field := range message.GetMessageDescriptor().GetFields() {
+// oneOfAlternative is a built oneof choice that can't be set to the message
+// together with the other choice.
+type oneOfAlternative struct {
+	field *desc.FieldDescriptor
+	value interface{}
+}
+
+// messageBuilder fills messages with default values.
+type messageBuilder struct {
+	maxDepth int
+	oneOf    []string
+
+	// nesting of message types on the current path
+	nesting      map[string]int
+	alternatives map[*dynamic.Message][]oneOfAlternative
+}
+
+func newMessageBuilder(maxDepth int, oneOf []string) *messageBuilder {
+	return &messageBuilder{
+		maxDepth:     maxDepth,
+		oneOf:        oneOf,
+		nesting:      make(map[string]int),
+		alternatives: make(map[*dynamic.Message][]oneOfAlternative),
+	}
+}
+
+func (b *messageBuilder) buildMessage(message *dynamic.Message) *dynamic.Message {
+	md := message.GetMessageDescriptor()
+
+	b.enter(md)
+	defer b.leave(md)
+
+	for _, field := range md.GetFields() {
 		switch {
-		case field.IsRepeated():
-			message.SetField(field, []interface{}{buildDefaultValue(field)})
 		case field.IsMap():
+			if !b.expandable(field.GetMapValueType()) {
+				continue
+			}
+
 			message.SetField(
 				field,
 				map[interface{}]interface{}{
-					buildDefaultValue(field.GetMapKeyType()): buildDefaultValue(field.GetMapValueType()),
+					b.buildDefaultValue(field.GetMapKeyType()): b.buildDefaultValue(field.GetMapValueType()),
 				},
 			)
+		case field.IsRepeated():
+			if !b.expandable(field) {
+				continue
+			}
+
+			message.SetField(field, []interface{}{b.buildDefaultValue(field)})
 		case field.GetOneOf() != nil:
-			oneOfField := field.GetOneOf().GetChoices()[0]
-			message.SetField(oneOfField, buildDefaultValue(oneOfField))
+			// all choices are handled at once
+			if field != field.GetOneOf().GetChoices()[0] {
+				continue
+			}
+
+			b.buildOneOf(message, field.GetOneOf())
 		default:
-			message.SetField(field, buildDefaultValue(field))
+			if !b.expandable(field) {
+				continue
+			}
+
+			message.SetField(field, b.buildDefaultValue(field))
 		}
 	}
 
 	return message
 }
 
-func buildDefaultValue(field *desc.FieldDescriptor) interface{} {
+func (b *messageBuilder) buildOneOf(message *dynamic.Message, oneOf *desc.OneOfDescriptor) {
+	all := b.allChoices()
+	isSet := false
+
+	for _, choice := range b.oneOfChoices(oneOf) {
+		if !b.expandable(choice) {
+			continue
+		}
+
+		value := b.buildDefaultValue(choice)
+		if isSet {
+			b.alternatives[message] = append(b.alternatives[message], oneOfAlternative{choice, value})
+		} else {
+			message.SetField(choice, value)
+			isSet = true
+		}
+
+		if !all {
+			return
+		}
+	}
+}
+
+func (b *messageBuilder) buildDefaultValue(field *desc.FieldDescriptor) interface{} {
 	switch field.GetType() {
 	case descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
 		descriptorpb.FieldDescriptorProto_TYPE_UINT32:
@@ -103,8 +219,259 @@ func buildDefaultValue(field *desc.FieldDescriptor) interface{} {
 			return val
 		}
 
-		return buildMessage(dynamic.NewMessage(field.GetMessageType()))
+		return b.buildMessage(dynamic.NewMessage(field.GetMessageType()))
+	}
+
+	return nil
+}
+
+// oneOfChoices returns candidates to build for oneof ordered by priority.
+func (b *messageBuilder) oneOfChoices(oneOf *desc.OneOfDescriptor) []*desc.FieldDescriptor {
+	choices := oneOf.GetChoices()
+
+	for _, choice := range choices {
+		for _, name := range b.oneOf {
+			if name == OneOfFlagFirstValue || name == OneOfFlagAllValue {
+				continue
+			}
+
+			if choice.GetName() == name || choice.GetFullyQualifiedName() == name {
+				return []*desc.FieldDescriptor{choice}
+			}
+		}
+	}
+
+	return choices
+}
+
+// checkOneOfChoices returns an error if a oneof choice name of the builder
+// isn't a choice of any oneof reachable from the message.
+func (b *messageBuilder) checkOneOfChoices(md *desc.MessageDescriptor) error {
+	choices := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var walk func(md *desc.MessageDescriptor)
+	walk = func(md *desc.MessageDescriptor) {
+		if visited[md.GetFullyQualifiedName()] {
+			return
+		}
+		visited[md.GetFullyQualifiedName()] = true
+
+		for _, oneOf := range md.GetOneOfs() {
+			for _, choice := range oneOf.GetChoices() {
+				choices[choice.GetName()] = true
+				choices[choice.GetFullyQualifiedName()] = true
+			}
+		}
+
+		for _, field := range md.GetFields() {
+			if field.GetMessageType() != nil {
+				walk(field.GetMessageType())
+			}
+		}
+	}
+	walk(md)
+
+	for _, name := range b.oneOf {
+		if name == OneOfFlagFirstValue || name == OneOfFlagAllValue {
+			continue
+		}
+
+		if !choices[name] {
+			return fmt.Errorf("oneof flag has unknown choice: %q is not a oneof field of %s", name, md.GetFullyQualifiedName())
+		}
 	}
 
 	return nil
 }
+
+func (b *messageBuilder) allChoices() bool {
+	for _, name := range b.oneOf {
+		if name == OneOfFlagAllValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandable reports whether the field of message type may be expanded
+// without exceeding the max depth of recursion.
+func (b *messageBuilder) expandable(field *desc.FieldDescriptor) bool {
+	md := field.GetMessageType()
+	if md == nil {
+		return true
+	}
+
+	name := md.GetFullyQualifiedName()
+	if b.nesting[name] < b.maxDepth {
+		return true
+	}
+
+	log.Debugf("Recursive message %s is not expanded deeper than %d level(s)", name, b.maxDepth)
+
+	return false
+}
+
+func (b *messageBuilder) enter(md *desc.MessageDescriptor) {
+	b.nesting[md.GetFullyQualifiedName()]++
+}
+
+func (b *messageBuilder) leave(md *desc.MessageDescriptor) {
+	b.nesting[md.GetFullyQualifiedName()]--
+}
+
+// marshalJSON marshals built message to indented JSON.
+// Oneof alternatives are written next to the choice set in the message.
+func (b *messageBuilder) marshalJSON(msg *dynamic.Message) ([]byte, error) {
+	if len(b.alternatives) == 0 {
+		return msg.MarshalJSONPB(&jsonpb.Marshaler{
+			EmitDefaults: true,
+			Indent:       buildIndent,
+		})
+	}
+
+	data, err := b.marshalCompactJSON(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.Indent(buf, data, "", buildIndent); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (b *messageBuilder) marshalCompactJSON(msg *dynamic.Message) ([]byte, error) {
+	md := msg.GetMessageDescriptor()
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+
+	write := func(field *desc.FieldDescriptor, value interface{}) error {
+		data, err := b.marshalFieldJSON(md, field, value)
+		if err != nil {
+			return err
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%q:%s", field.GetJSONName(), data)
+
+		return nil
+	}
+
+	for _, field := range md.GetFields() {
+		if field.GetOneOf() == nil || msg.HasField(field) {
+			if err := write(field, msg.GetField(field)); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, alt := range b.alternatives[msg] {
+			if alt.field == field {
+				if err := write(alt.field, alt.value); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// marshalFieldJSON marshals the field value, messages are marshaled with their alternatives.
+func (b *messageBuilder) marshalFieldJSON(md *desc.MessageDescriptor, field *desc.FieldDescriptor, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case *dynamic.Message:
+		if v == nil {
+			return []byte("null"), nil
+		}
+
+		if !isWellKnownType(v.GetMessageDescriptor()) {
+			return b.marshalCompactJSON(v)
+		}
+
+	case []interface{}:
+		if field.GetMessageType() != nil && !isWellKnownType(field.GetMessageType()) {
+			items := make([][]byte, 0, len(v))
+			for _, item := range v {
+				data, err := b.marshalCompactJSON(item.(*dynamic.Message))
+				if err != nil {
+					return nil, err
+				}
+
+				items = append(items, data)
+			}
+
+			return append(append([]byte{'['}, bytes.Join(items, []byte{','})...), ']'), nil
+		}
+
+	case map[interface{}]interface{}:
+		if valueType := field.GetMapValueType().GetMessageType(); valueType != nil && !isWellKnownType(valueType) {
+			return b.marshalMapJSON(v)
+		}
+	}
+
+	// marshal message with the single field to get JSON of the value
+	m := dynamic.NewMessage(md)
+	if err := m.TrySetField(field, value); err != nil {
+		return nil, err
+	}
+
+	data, err := m.MarshalJSONPB(&jsonpb.Marshaler{EmitDefaults: true})
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields[field.GetJSONName()], nil
+}
+
+// marshalMapJSON marshals the map of message values with their alternatives, keys are JSON strings.
+func (b *messageBuilder) marshalMapJSON(m map[interface{}]interface{}) ([]byte, error) {
+	keys := make([]string, 0, len(m))
+	values := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		key := fmt.Sprint(k)
+		keys = append(keys, key)
+		values[key] = v
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+
+	for i, key := range keys {
+		data, err := b.marshalCompactJSON(values[key].(*dynamic.Message))
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(buf, "%s:%s", name, data)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func isWellKnownType(md *desc.MessageDescriptor) bool {
+	return strings.HasPrefix(md.GetFullyQualifiedName(), "google.protobuf.")
+}
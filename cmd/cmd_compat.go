@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func NewCompatCmd() *cobra.Command {
+	var (
+		oldFlag []string
+		newFlag []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "compat <MessageName>",
+		Short: "Check compatibility between two versions of proto message",
+		Args:  messageNameRequired,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if len(newFlag) == 0 {
+				newFlag = viper.GetStringSlice("proto")
+			}
+
+			oldMsg, err := loadMessage(oldFlag, args[0])
+			if err != nil {
+				return fmt.Errorf("old schema: %w", err)
+			}
+
+			newMsg, err := loadMessage(newFlag, args[0])
+			if err != nil {
+				return fmt.Errorf("new schema: %w", err)
+			}
+
+			breaking := 0
+			for _, c := range proto.CheckCompatibility(oldMsg, newMsg) {
+				if c.Breaking {
+					breaking++
+				}
+
+				cmd.Println(c.String())
+			}
+
+			if breaking > 0 {
+				return fmt.Errorf("found %d breaking change(s)", breaking)
+			}
+
+			log.Infof("Message %s is compatible", newMsg.GetFullyQualifiedName())
+
+			return
+		},
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringSliceVar(&oldFlag, "old", []string{}, "Old proto files or descriptor set (*.protoset, *.pb)")
+	flags.StringSliceVar(&newFlag, "new", []string{}, "New proto files or descriptor set (default is --proto)")
+
+	_ = cmd.MarkFlagRequired("old")
+
+	return cmd
+}
+
+func loadMessage(files []string, name string) (*desc.MessageDescriptor, error) {
+	p, err := proto.Load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Loaded files: %s", strings.Join(files, ", "))
+
+	return findMessage(p, name)
+}
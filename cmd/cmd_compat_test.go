@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewCompatCmd(t *testing.T) {
+	cmd := NewCompatCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{
+		"Order",
+		"--old", "../internal/proto/testdata/compat/v1.proto",
+		"--new", "../internal/proto/testdata/compat/v2.proto",
+	})
+
+	stdout, _, err := getCommandOut(t, cmd)
+
+	require.EqualError(t, err, "found 5 breaking change(s)")
+	require.Contains(t, stdout, "BREAKING compat.Order.comment: field 3 removed\n")
+	require.Contains(t, stdout, "WARNING compat.Order.amount: type changed from int32 to int64 (wire compatible)\n")
+}
+
+func Test_NewCompatCmd_Compatible(t *testing.T) {
+	cmd := NewCompatCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{
+		"Order",
+		"--old", "../internal/proto/testdata/compat/v1.proto",
+		"--new", "../internal/proto/testdata/compat/v1.proto",
+	})
+
+	stdout, _, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	require.Contains(t, stdout, "Message compat.Order is compatible")
+}
@@ -4,21 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
 	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/kuper-tech/protokaf/internal/tracing"
 	"github.com/kuper-tech/protokaf/internal/utils/dump"
+	"github.com/kuper-tech/protokaf/internal/utils/sink"
+	"github.com/opentracing/opentracing-go"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+const (
+	// IsolationReadUncommitted is a value of isolation to read all records.
+	IsolationReadUncommitted = "read_uncommitted"
+
+	// IsolationReadCommitted is a value of isolation to skip records of aborted transactions.
+	IsolationReadCommitted = "read_committed"
+
+	// RedactKeyEnv is an environment variable of the key of hash redact mode,
+	// so the key isn't visible in arguments of the process.
+	RedactKeyEnv = "PROTOKAF_REDACT_KEY"
+)
+
 var (
 	ErrInvalidOffset = errors.New("invalid offset format")
 	ErrOffsetNotSet  = errors.New("offset not set")
+	ErrWriteMessage  = errors.New("failed to write message")
 )
 
 func NewConsumeCmd() *cobra.Command {
@@ -28,12 +49,30 @@ func NewConsumeCmd() *cobra.Command {
 		countFlag  int
 		noCommit   bool
 		offset     string
+		isolation  string
+
+		outDirFlag         string
+		rotateSizeFlag     string
+		rotateEveryFlag    time.Duration
+		outCompressionFlag string
+
+		redactFlag       []string
+		redactModeFlag   string
+		redactKeyFlag    string
+		redactHeaderFlag []string
+		skipInvalid      bool
+
+		traceFlag bool
 	)
 
 	cmd := &cobra.Command{
 		Use:   "consume <MessageName>",
 		Short: "Consume mode",
 		Args:  messageNameRequired,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			tracing.BindJaegerFlags(cmd.Flags())
+			return nil
+		},
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			// parse protofiles & create proto object
 			p, err := parseProtofiles()
@@ -47,10 +86,67 @@ func NewConsumeCmd() *cobra.Command {
 				return
 			}
 
+			redaction := proto.Redaction{Mode: redactModeFlag, Key: []byte(redactKeyFlag)}
+			if redactKeyFlag == "" {
+				redaction.Key = []byte(os.Getenv(RedactKeyEnv))
+			}
+
+			redact, err := newRedactor(md, redactFlag, redactHeaderFlag, redaction)
+			if err != nil {
+				return
+			}
+
+			// create tracer
+			if traceFlag {
+				closer, err := newTracer()
+				if err != nil {
+					return err
+				}
+				defer closer.Close()
+			}
+
 			if noCommit {
 				kafkaConfig.Consumer.Offsets.AutoCommit.Enable = false
 			}
 
+			kafkaConfig.Consumer.IsolationLevel, err = parseIsolationFlag(isolation)
+			if err != nil {
+				return
+			}
+
+			// messages are written to stdout or files
+			var out recordSink = stdoutSink{}
+			if outDirFlag != "" {
+				var rotateSize int64
+				if rotateSizeFlag != "" {
+					if rotateSize, err = sink.ParseSize(rotateSizeFlag); err != nil {
+						return
+					}
+				}
+
+				out, err = newFileSink(sink.Options{
+					Dir:         outDirFlag,
+					Compression: outCompressionFlag,
+					RotateSize:  rotateSize,
+					RotateEvery: rotateEveryFlag,
+				})
+				if err != nil {
+					return
+				}
+
+				log.Infof("Writing messages to %s", outDirFlag)
+			}
+
+			defer func() {
+				if closeErr := out.Close(); err == nil {
+					err = closeErr
+				}
+			}()
+
+			// files must be closed on interrupt
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
 			// consumer
 			consumer, err := kafka.NewConsumerGroup(viper.GetStringSlice("broker"), groupFlag, kafkaConfig)
 			if err != nil {
@@ -66,9 +162,14 @@ func NewConsumeCmd() *cobra.Command {
 				}
 
 				handler := &protoHandler{
-					MaxCount: countFlag,
-					desc:     md,
-					topic:    topicsFlag[0],
+					MaxCount:    countFlag,
+					desc:        md,
+					topic:       topicsFlag[0],
+					sink:        out,
+					redact:      redact,
+					skipInvalid: skipInvalid,
+					trace:       traceFlag,
+					raw:         isRawOutput(viper.GetString("output")),
 				}
 
 				// set offset
@@ -79,14 +180,14 @@ func NewConsumeCmd() *cobra.Command {
 				}
 				handler.offset = offsetsArg
 
-				err = consumer.Consume(context.Background(), topicsFlag, handler)
+				err = consumer.Consume(ctx, topicsFlag, handler)
 
 				if handler.maximumReached() {
 					log.Debugf("Message consuming limit reached: %d", countFlag)
 					return
 				}
 
-				if err != nil {
+				if err != nil && !errors.Is(err, context.Canceled) {
 					log.Errorf("Consume error: %s", err)
 				}
 
@@ -98,6 +199,10 @@ func NewConsumeCmd() *cobra.Command {
 				if errors.Is(err, ErrMaximumReached) {
 					return nil
 				}
+
+				if errors.Is(err, ErrWriteMessage) || errors.Is(err, ErrInvalidRecord) {
+					return err
+				}
 			}
 
 			return
@@ -111,6 +216,27 @@ func NewConsumeCmd() *cobra.Command {
 	flags.IntVarP(&countFlag, "count", "c", 0, "Exit after consuming this number of messages")
 	flags.BoolVar(&noCommit, "no-commit", false, "Consume messages without commiting offset")
 	flags.StringVarP(&offset, "offset", "o", "", "Start consuming from this offset (default: newest)")
+	flags.StringVar(&isolation, "isolation", IsolationReadUncommitted, fmt.Sprintf(
+		"Isolation level: %s, %s (skip aborted transactions)", IsolationReadUncommitted, IsolationReadCommitted,
+	))
+
+	flags.StringVar(&outDirFlag, "out-dir", "", "Write messages in --output format to files of topic partitions in this directory")
+	flags.StringVar(&rotateSizeFlag, "rotate-size", "", "Start a new file when size of data exceeds this size, e.g. 100MB")
+	flags.DurationVar(&rotateEveryFlag, "rotate-every", 0, "Start a new file after this time on the next record of partition, e.g. 1h")
+	flags.StringVar(&outCompressionFlag, "out-compression", sink.CompressionNone, fmt.Sprintf(
+		"Compression of files: %s, %s, %s", sink.CompressionNone, sink.CompressionGzip, sink.CompressionZstd,
+	))
+
+	flags.StringSliceVar(&redactFlag, "redact", []string{}, "Redact fields at dotted paths before output, e.g. user.email,card.number")
+	flags.StringVar(&redactModeFlag, "redact-mode", proto.RedactMask, fmt.Sprintf(
+		"Replace redacted values with: %s, %s (HMAC-SHA256 with --redact-key), %s (remove fields)", proto.RedactMask, proto.RedactHash, proto.RedactRemove,
+	))
+	flags.StringVar(&redactKeyFlag, "redact-key", "", "Secret key of hash redact mode (default $"+RedactKeyEnv+")")
+	flags.StringSliceVar(&redactHeaderFlag, "redact-header", []string{}, "Redact values of headers with these names")
+	flags.BoolVar(&skipInvalid, "skip-invalid", false, "Skip records failed to decode or redact with --redact and commit their offsets instead of stopping")
+
+	flags.BoolVar(&traceFlag, "trace", false, "Continue traces of records headers (Jaeger, W3C, B3) with consumer spans and print trace IDs")
+	tracing.SetJaegerFlags(flags)
 
 	_ = cmd.MarkFlagRequired("group")
 	_ = cmd.MarkFlagRequired("topic")
@@ -118,6 +244,19 @@ func NewConsumeCmd() *cobra.Command {
 	return cmd
 }
 
+func parseIsolationFlag(isolation string) (sarama.IsolationLevel, error) {
+	switch isolation {
+	case IsolationReadUncommitted:
+		return sarama.ReadUncommitted, nil
+	case IsolationReadCommitted:
+		return sarama.ReadCommitted, nil
+	}
+
+	return 0, fmt.Errorf(
+		"isolation flag has invalid value: %s, use one of %s, %s", isolation, IsolationReadUncommitted, IsolationReadCommitted,
+	)
+}
+
 func parseOffsetFlag(offsetsFlag string) (offset int64, err error) {
 	if offsetsFlag == "" {
 		return -1, ErrOffsetNotSet
@@ -138,6 +277,12 @@ type protoHandler struct {
 	topic             string
 	partition         int32
 	offset            int64
+	sink              recordSink
+	redact            *redactor
+	skipInvalid       bool
+	trace             bool
+	// raw is set if values are written without decoding
+	raw bool
 }
 
 var once sync.Once
@@ -169,14 +314,41 @@ func (h *protoHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sara
 			continue
 		}
 
-		m := f.NewDynamicMessage(h.desc)
+		// tombstones have no message
+		var (
+			m   *dynamic.Message
+			err error
+		)
+
+		if msg.Value != nil {
+			m, err = decodeMessage(f, h.desc, msg.Value)
+		}
+
+		switch {
+		case err == nil:
+			if err := h.write(msg, m); err != nil {
+				return err
+			}
+
+		// undecodable values can't be redacted
+		case h.redact != nil:
+			if !h.skipInvalid {
+				return fmt.Errorf("%w %s/%d/%d: %s", ErrInvalidRecord, msg.Topic, msg.Partition, msg.Offset, err)
+			}
+
+			log.Errorf("Unmarshal message error, record %s/%d/%d is skipped: %s", msg.Topic, msg.Partition, msg.Offset, err)
+
+		case h.raw:
+			log.Errorf("Unmarshal message error of record %s/%d/%d: %s", msg.Topic, msg.Partition, msg.Offset, err)
 
-		if err := m.Unmarshal(msg.Value); err != nil {
-			log.Errorf("Unmarshal message error: %s", err)
-		} else {
-			dump.DynamicMessage(log, "Message consumed", viper.GetString("output"), m)
+			if err := h.write(msg, nil); err != nil {
+				return err
+			}
+
+		default:
+			log.Errorf("Unmarshal message error, record %s/%d/%d is skipped: %s", msg.Topic, msg.Partition, msg.Offset, err)
+			dumpConsumerMessage(msg, "")
 		}
-		dumpConsumerMessage(msg)
 
 		sess.MarkMessage(msg, "")
 
@@ -191,6 +363,69 @@ func (h *protoHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sara
 	return nil
 }
 
+// write redacts the record and writes it to the sink, records failed to redact are skipped
+// with skipInvalid, otherwise ErrInvalidRecord is returned.
+// Trace ID of the consumer span is written with the record in record output and printed in its dump.
+func (h *protoHandler) write(msg *sarama.ConsumerMessage, m *dynamic.Message) error {
+	var traceID string
+	if h.trace {
+		if span := startConsumerSpan(msg); span != nil {
+			defer span.Finish()
+			traceID = tracing.TraceID(span.Context())
+		}
+	}
+
+	redacted, err := h.redact.Apply(msg, m)
+	if err != nil {
+		if !h.skipInvalid {
+			return fmt.Errorf("%w %s/%d/%d: redact: %s", ErrInvalidRecord, msg.Topic, msg.Partition, msg.Offset, err)
+		}
+
+		log.Errorf("Redact message error, record %s/%d/%d is skipped: %s", msg.Topic, msg.Partition, msg.Offset, err)
+		return nil
+	}
+	msg = redacted
+
+	rec := kafka.NewRecordFromConsumerMessage(msg)
+	rec.TraceID = traceID
+
+	if err := h.sink.Write(rec, m); err != nil {
+		return fmt.Errorf("%w: %s", ErrWriteMessage, err)
+	}
+	dumpConsumerMessage(msg, traceID)
+
+	return nil
+}
+
+// startConsumerSpan starts a span continuing the trace of record headers and prints its trace ID
+// with the record coordinates, it's nil if headers have no trace context.
+func startConsumerSpan(msg *sarama.ConsumerMessage) opentracing.Span {
+	span, err := tracing.CreateConsumerSpan(nil, msg)
+	if errors.Is(err, opentracing.ErrSpanContextNotFound) {
+		log.Debugf("No trace context in record %s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+		return nil
+	}
+
+	if err != nil {
+		log.Errorf("Failed to extract trace context of record %s/%d/%d: %s", msg.Topic, msg.Partition, msg.Offset, err)
+		return nil
+	}
+
+	log.Infof("Trace ID of record %s/%d/%d: %s", msg.Topic, msg.Partition, msg.Offset, tracing.TraceID(span.Context()))
+
+	return span
+}
+
+// decodeMessage decodes record value into the message with given descriptor.
+func decodeMessage(f *dynamic.MessageFactory, md *desc.MessageDescriptor, value []byte) (*dynamic.Message, error) {
+	m := f.NewDynamicMessage(md)
+	if err := m.Unmarshal(value); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
 func (h protoHandler) maximumReached() bool {
 	if h.MaxCount != 0 {
 		return h.counter == h.MaxCount
@@ -199,7 +434,8 @@ func (h protoHandler) maximumReached() bool {
 	return false
 }
 
-func dumpConsumerMessage(msg *sarama.ConsumerMessage) {
+// dumpConsumerMessage prints metadata of the record, trace ID is empty without consumer span.
+func dumpConsumerMessage(msg *sarama.ConsumerMessage, traceID string) {
 	headers := kafka.NewRecordHeadersFromPointers(msg.Headers)
 
 	pairs := dump.Pairs{
@@ -212,5 +448,8 @@ func dumpConsumerMessage(msg *sarama.ConsumerMessage) {
 		{Name: "headers", Value: headers.String()},
 		{Name: "value", Value: msg.Value},
 	}
+	if traceID != "" {
+		pairs = append(pairs, dump.Pair{Name: "trace id", Value: traceID})
+	}
 	pairs.Dump(log)
 }
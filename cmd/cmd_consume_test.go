@@ -1,9 +1,20 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/Shopify/sarama"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/kuper-tech/protokaf/internal/tracing"
+	"github.com/kuper-tech/protokaf/internal/utils/sink"
+	"github.com/opentracing/opentracing-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
 )
 
 func Test_NewConsumeCmd_NoTopicFlags(t *testing.T) {
@@ -40,3 +51,171 @@ func Test_parseOffsetsFlag(t *testing.T) {
 		require.EqualValues(t, -1, v)
 	})
 }
+
+func Test_parseIsolationFlag(t *testing.T) {
+	level, err := parseIsolationFlag(IsolationReadCommitted)
+	require.NoError(t, err)
+	require.Equal(t, sarama.ReadCommitted, level)
+
+	level, err = parseIsolationFlag(IsolationReadUncommitted)
+	require.NoError(t, err)
+	require.Equal(t, sarama.ReadUncommitted, level)
+
+	_, err = parseIsolationFlag("serializable")
+	require.Error(t, err)
+}
+
+func Test_startConsumerSpan(t *testing.T) {
+	reporter := jaeger.NewInMemoryReporter()
+	tracer, closer := jaeger.NewTracer(
+		"test", jaeger.NewConstSampler(true), reporter,
+		jaeger.TracerOptions.Extractor(opentracing.TextMap, tracing.NewExtractor()),
+	)
+	defer closer.Close()
+
+	global := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(global)
+
+	span := startConsumerSpan(&sarama.ConsumerMessage{
+		Topic: "test",
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("uber-trace-id"), Value: []byte("a1b2:c3:0:1")},
+		},
+	})
+	require.NotNil(t, span)
+	span.Finish()
+
+	require.Len(t, reporter.GetSpans(), 1)
+	require.Equal(t, "000000000000a1b2", tracing.TraceID(span.Context()))
+
+	// records without trace context have no spans
+	require.Nil(t, startConsumerSpan(&sarama.ConsumerMessage{Topic: "test"}))
+	require.Nil(t, startConsumerSpan(&sarama.ConsumerMessage{
+		Topic:   "test",
+		Headers: []*sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte("broken")}},
+	}))
+}
+
+func Test_protoHandler_ConsumeClaim_UndecodableRaw(t *testing.T) {
+	md := findTestMessage(t, "HelloRequest")
+
+	viper.Set("output", DecodeFlagHexValue)
+	defer viper.Set("output", nil)
+
+	defer func(f *Flags) { flags = f }(flags)
+	flags = &Flags{Partition: -1}
+
+	dir := t.TempDir()
+	out, err := newFileSink(sink.Options{Dir: dir})
+	require.Nil(t, err)
+
+	h := &protoHandler{desc: md, sink: out, raw: true}
+
+	claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: 0, Value: []byte{0xff, 0xff}}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: 1, Value: encodeTestMessage(t, md, `{"name": "Alice"}`)}
+	close(claim.messages)
+
+	sess := &testConsumerGroupSession{}
+	require.Nil(t, h.ConsumeClaim(sess, claim))
+	require.Nil(t, out.Close())
+
+	// undecodable value is written as is
+	data, err := os.ReadFile(filepath.Join(dir, "test-0-000001.hex"))
+	require.Nil(t, err)
+	assert.Equal(t, "ffff\n0a05416c696365\n", string(data))
+	assert.Equal(t, []int64{0, 1}, sess.marked)
+}
+
+func Test_protoHandler_ConsumeClaim_RedactInvalid(t *testing.T) {
+	md := findTestMessage(t, "HelloRequest")
+
+	viper.Set("output", DecodeFlagHexValue)
+	defer viper.Set("output", nil)
+
+	defer func(f *Flags) { flags = f }(flags)
+	flags = &Flags{Partition: -1}
+
+	r, err := newRedactor(md, []string{"name"}, nil, proto.Redaction{Mode: proto.RedactMask})
+	require.Nil(t, err)
+
+	for _, skipInvalid := range []bool{false, true} {
+		dir := t.TempDir()
+		out, err := newFileSink(sink.Options{Dir: dir})
+		require.Nil(t, err)
+
+		h := &protoHandler{desc: md, sink: out, redact: r, skipInvalid: skipInvalid, raw: true}
+
+		claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: 0, Value: encodeTestMessage(t, md, `{"name": "Alice"}`)}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: 1, Value: []byte{0xff, 0xff}}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: 2, Value: encodeTestMessage(t, md, `{"name": "Bob"}`)}
+		close(claim.messages)
+
+		sess := &testConsumerGroupSession{}
+		err = h.ConsumeClaim(sess, claim)
+		require.Nil(t, out.Close())
+
+		if !skipInvalid {
+			// value which can't be redacted isn't written and its offset isn't committed
+			assert.ErrorIs(t, err, ErrInvalidRecord)
+			assert.Equal(t, []int64{0}, sess.marked)
+			continue
+		}
+
+		require.Nil(t, err)
+		assert.Equal(t, []int64{0, 1, 2}, sess.marked)
+
+		data, err := os.ReadFile(filepath.Join(dir, "test-0-000001.hex"))
+		require.Nil(t, err)
+		assert.Equal(t, 2, strings.Count(string(data), "\n"))
+	}
+}
+
+func Test_protoHandler_ConsumeClaim_TraceID(t *testing.T) {
+	md := findTestMessage(t, "HelloRequest")
+
+	tracer, closer := jaeger.NewTracer(
+		"test", jaeger.NewConstSampler(true), jaeger.NewNullReporter(),
+		jaeger.TracerOptions.Extractor(opentracing.TextMap, tracing.NewExtractor()),
+	)
+	defer closer.Close()
+
+	global := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(global)
+
+	viper.Set("output", DecodeFlagRecordValue)
+	defer viper.Set("output", nil)
+
+	defer func(f *Flags) { flags = f }(flags)
+	flags = &Flags{Partition: -1}
+
+	dir := t.TempDir()
+	out, err := newFileSink(sink.Options{Dir: dir})
+	require.Nil(t, err)
+
+	h := &protoHandler{desc: md, sink: out, trace: true}
+
+	value := encodeTestMessage(t, md, `{"name": "Alice"}`)
+	claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{
+		Topic:   "test",
+		Offset:  0,
+		Headers: []*sarama.RecordHeader{{Key: []byte("uber-trace-id"), Value: []byte("a1b2:c3:0:1")}},
+		Value:   value,
+	}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "test", Offset: 1, Value: value}
+	close(claim.messages)
+
+	require.Nil(t, h.ConsumeClaim(&testConsumerGroupSession{}, claim))
+	require.Nil(t, out.Close())
+
+	// trace ID is written with the record
+	records, err := readRecordFiles([]string{dir})
+	require.Nil(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "000000000000a1b2", records[0].TraceID)
+	assert.Empty(t, records[1].TraceID)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"github.com/jhump/protoreflect/desc/protoprint"
+	"github.com/spf13/cobra"
+)
+
+func NewDescribeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe <MessageName>",
+		Short: "Describe message, enum or service of proto files",
+		Args:  messageNameRequired,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// parse protofiles & create proto object
+			p, err := parseProtofiles()
+			if err != nil {
+				return
+			}
+
+			d, err := p.FindDescriptor(args[0])
+			if err != nil {
+				return
+			}
+
+			printer := protoprint.Printer{
+				ForceFullyQualifiedNames: true,
+				OmitComments:             protoprint.CommentsDetached | protoprint.CommentsTrailing,
+			}
+
+			s, err := printer.PrintProtoToString(d)
+			if err != nil {
+				return
+			}
+
+			cmd.Printf("// %s (%s)\n%s", d.GetFullyQualifiedName(), d.GetFile().GetName(), s)
+
+			return
+		},
+	}
+
+	return cmd
+}
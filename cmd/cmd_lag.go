@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultLagWatch is an interval of refreshing lag if metrics are served without --watch.
+const defaultLagWatch = 10 * time.Second
+
+func NewLagCmd() *cobra.Command {
+	var (
+		groupsFlag        []string
+		topicsFlag        []string
+		watchFlag         time.Duration
+		metricsAddrFlag   string
+		recordTimeoutFlag time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lag",
+		Short: "Show lag of consumer groups, optionally refreshing it and serving Prometheus metrics",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			admin, err := kafka.NewAdmin(viper.GetStringSlice("broker"), kafkaConfig)
+			if err != nil {
+				return
+			}
+			defer admin.Close()
+
+			admin.RecordTimeout = recordTimeoutFlag
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			metrics := newLagMetrics()
+			if metricsAddrFlag != "" {
+				if err = serveLagMetrics(ctx, metricsAddrFlag, metrics); err != nil {
+					return
+				}
+
+				if watchFlag == 0 {
+					watchFlag = defaultLagWatch
+				}
+			}
+
+			out := cmd.OutOrStdout()
+
+			// groups failed to refresh are skipped in the table and removed from metrics
+			refresh := func() error {
+				var (
+					lags    = make(map[string][]kafka.PartitionLag, len(groupsFlag))
+					failed  int
+					lastErr error
+				)
+
+				for _, group := range groupsFlag {
+					groupLags, err := admin.GroupLag(group, topicsFlag)
+					if err != nil {
+						log.Errorf("Failed to get lag of group %s: %s", group, err)
+						metrics.Fail(group)
+						failed++
+						lastErr = err
+						continue
+					}
+
+					lags[group] = groupLags
+					metrics.Update(group, groupLags)
+				}
+
+				if watchFlag > 0 && isTerminal(out) {
+					fmt.Fprint(out, "\033[H\033[2J")
+				}
+
+				if err := printLagTable(out, groupsFlag, lags); err != nil {
+					return err
+				}
+
+				if failed > 0 {
+					return fmt.Errorf("%d of %d groups failed, last error: %w", failed, len(groupsFlag), lastErr)
+				}
+
+				return nil
+			}
+
+			if watchFlag == 0 {
+				return refresh()
+			}
+
+			ticker := time.NewTicker(watchFlag)
+			defer ticker.Stop()
+
+			for {
+				// failed refreshes are retried in watch mode
+				if err := refresh(); err != nil {
+					log.Errorf("Failed to get lag: %s", err)
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringSliceVarP(&groupsFlag, "group", "G", []string{}, "Consumer group(s)")
+	flags.StringSliceVarP(&topicsFlag, "topic", "t", []string{}, "Show only these topics (default: topics with committed offsets and assigned partitions)")
+	flags.DurationVar(&watchFlag, "watch", 0, "Refresh lag with this interval, e.g. 10s")
+	flags.StringVar(&metricsAddrFlag, "metrics-addr", "", fmt.Sprintf(
+		"Serve Prometheus metrics at /metrics on this address, e.g. :9308 (refreshed every %s without --watch)", defaultLagWatch,
+	))
+	flags.DurationVar(&recordTimeoutFlag, "record-timeout", kafka.DefaultRecordTimeout, "Timeout of reading the next records of all partitions of a group for lag in time")
+
+	_ = cmd.MarkFlagRequired("group")
+
+	return cmd
+}
+
+// printLagTable prints lag of groups in partitions, unknown values are "-".
+func printLagTable(out io.Writer, groups []string, lags map[string][]kafka.PartitionLag) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "GROUP\tTOPIC\tPARTITION\tCOMMITTED\tLOG-END\tLAG\tTIME-LAG\tMEMBER")
+
+	for _, group := range groups {
+		for _, l := range lags[group] {
+			timeLag := "-"
+			if l.TimeLag > 0 {
+				timeLag = l.TimeLag.Truncate(time.Millisecond).String()
+			}
+
+			member := l.Member
+			if member == "" {
+				member = "-"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%s\t%s\n",
+				group, l.Topic, l.Partition, offsetString(l.Committed), l.LogEnd, offsetString(l.Lag), timeLag, member,
+			)
+		}
+	}
+
+	return w.Flush()
+}
+
+func offsetString(offset int64) string {
+	if offset < 0 {
+		return "-"
+	}
+
+	return strconv.FormatInt(offset, 10)
+}
+
+// serveLagMetrics serves metrics until the context is done.
+func serveLagMetrics(ctx context.Context, addr string, metrics *lagMetrics) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Metrics server error: %s", err)
+		}
+	}()
+
+	log.Infof("Serving metrics at http://%s/metrics", ln.Addr())
+
+	return nil
+}
+
+// isTerminal reports whether out is a terminal.
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
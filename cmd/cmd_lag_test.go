@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLags = []kafka.PartitionLag{
+	{Topic: "test", Partition: 0, Committed: 7, LogEnd: 10, Lag: 3, TimeLag: 1500 * time.Millisecond, Member: "app@/10.0.0.1"},
+	{Topic: "test", Partition: 1, Committed: -1, LogEnd: 3, Lag: -1},
+}
+
+func Test_NewLagCmd_NoGroupFlag(t *testing.T) {
+	cmd := NewLagCmd()
+	cmd.SetArgs([]string{})
+
+	_, _, err := getCommandOut(t, cmd)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `required flag(s) "group" not set`)
+}
+
+func Test_printLagTable(t *testing.T) {
+	var b bytes.Buffer
+	require.Nil(t, printLagTable(&b, []string{"group"}, map[string][]kafka.PartitionLag{"group": testLags}))
+
+	assert.Equal(t, ""+
+		"GROUP  TOPIC  PARTITION  COMMITTED  LOG-END  LAG  TIME-LAG  MEMBER\n"+
+		"group  test   0          7          10       3    1.5s      app@/10.0.0.1\n"+
+		"group  test   1          -          3        -    -         -\n",
+		b.String())
+}
+
+func Test_lagMetrics(t *testing.T) {
+	metrics := newLagMetrics()
+	metrics.now = func() time.Time { return time.UnixMilli(1700000000500) }
+	metrics.Update("group", testLags)
+	metrics.Update(`other"group`, testLags[:1])
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, err := io.ReadAll(rec.Body)
+	require.Nil(t, err)
+
+	assert.Equal(t, `# HELP protokaf_consumergroup_lag Number of records not consumed by the group
+# TYPE protokaf_consumergroup_lag gauge
+protokaf_consumergroup_lag{group="group",topic="test",partition="0"} 3
+protokaf_consumergroup_lag{group="other\"group",topic="test",partition="0"} 3
+# HELP protokaf_consumergroup_lag_seconds Time since the timestamp of the next record to consume
+# TYPE protokaf_consumergroup_lag_seconds gauge
+protokaf_consumergroup_lag_seconds{group="group",topic="test",partition="0"} 1.5
+protokaf_consumergroup_lag_seconds{group="other\"group",topic="test",partition="0"} 1.5
+# HELP protokaf_consumergroup_current_offset Offset committed by the group
+# TYPE protokaf_consumergroup_current_offset gauge
+protokaf_consumergroup_current_offset{group="group",topic="test",partition="0"} 7
+protokaf_consumergroup_current_offset{group="other\"group",topic="test",partition="0"} 7
+# HELP protokaf_topic_partition_log_end_offset Offset of the next produced record
+# TYPE protokaf_topic_partition_log_end_offset gauge
+protokaf_topic_partition_log_end_offset{topic="test",partition="0"} 10
+protokaf_topic_partition_log_end_offset{topic="test",partition="1"} 3
+# HELP protokaf_consumergroup_partition_assigned Partition is assigned to the group member
+# TYPE protokaf_consumergroup_partition_assigned gauge
+protokaf_consumergroup_partition_assigned{group="group",topic="test",partition="0",member="app@/10.0.0.1"} 1
+protokaf_consumergroup_partition_assigned{group="other\"group",topic="test",partition="0",member="app@/10.0.0.1"} 1
+# HELP protokaf_lag_up Last refresh of lag of the group succeeded
+# TYPE protokaf_lag_up gauge
+protokaf_lag_up{group="group"} 1
+protokaf_lag_up{group="other\"group"} 1
+# HELP protokaf_lag_last_success_timestamp_seconds Time of the last successful refresh of lag of the group
+# TYPE protokaf_lag_last_success_timestamp_seconds gauge
+protokaf_lag_last_success_timestamp_seconds{group="group"} 1700000000.5
+protokaf_lag_last_success_timestamp_seconds{group="other\"group"} 1700000000.5
+`, string(body))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "version=0.0.4")
+}
+
+func Test_lagMetrics_Fail(t *testing.T) {
+	metrics := newLagMetrics()
+	metrics.now = func() time.Time { return time.Unix(1700000000, 0) }
+	metrics.Update("group", testLags)
+	metrics.Fail("group")
+	metrics.Fail("new")
+
+	var b bytes.Buffer
+	require.Nil(t, metrics.write(&b))
+
+	// stale lag isn't served after a failed refresh
+	assert.NotContains(t, b.String(), "protokaf_consumergroup_lag{")
+	assert.Contains(t, b.String(), `protokaf_lag_up{group="group"} 0`)
+	assert.Contains(t, b.String(), `protokaf_lag_up{group="new"} 0`)
+	assert.Contains(t, b.String(), `protokaf_lag_last_success_timestamp_seconds{group="group"} 1700000000`+"\n")
+	assert.NotContains(t, b.String(), `protokaf_lag_last_success_timestamp_seconds{group="new"}`)
+}
+
+// errResponseWriter fails writes of the body.
+type errResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (errResponseWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func Test_lagMetrics_serve_WriteError(t *testing.T) {
+	metrics := newLagMetrics()
+	metrics.Update("group", testLags)
+
+	err := metrics.serve(errResponseWriter{httptest.NewRecorder()})
+	assert.EqualError(t, err, "broken pipe")
+
+	// the lock is released before writing, so updates aren't blocked by clients
+	metrics.Update("group", testLags[:1])
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/spf13/cobra"
+)
+
+func NewMessagesCmd() *cobra.Command {
+	var (
+		filterFlag string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "messages",
+		Short: "List messages, enums and services of proto files",
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// parse protofiles & create proto object
+			p, err := parseProtofiles()
+			if err != nil {
+				return
+			}
+
+			filter := strings.ToLower(filterFlag)
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			for _, d := range p.Types() {
+				name := d.GetFullyQualifiedName()
+				if !strings.Contains(strings.ToLower(name), filter) {
+					continue
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\n", descriptorKind(d), name, d.GetFile().GetName())
+			}
+
+			return w.Flush()
+		},
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVar(&filterFlag, "filter", "", "Show only names containing this substring (case-insensitive)")
+
+	return cmd
+}
+
+func descriptorKind(d desc.Descriptor) string {
+	switch d.(type) {
+	case *desc.MessageDescriptor:
+		return "message"
+	case *desc.EnumDescriptor:
+		return "enum"
+	case *desc.ServiceDescriptor:
+		return "service"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewMessagesCmd(t *testing.T) {
+	cmd := NewMessagesCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{"--filter", "hello", "--proto", "../internal/proto/testdata/example.proto"})
+
+	stdout, stderr, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	require.Equal(t, "", stderr)
+	require.Contains(t, stdout, "message  example.HelloRequest   ../internal/proto/testdata/example.proto\n")
+	require.Contains(t, stdout, "message  example.HelloResponse  ../internal/proto/testdata/example.proto\n")
+	require.NotContains(t, stdout, "example.Num")
+}
+
+func Test_NewDescribeCmd(t *testing.T) {
+	cmd := NewDescribeCmd()
+	NewFlags(cmd).Init()
+	cmd.SetArgs([]string{"ExampleMessage", "--proto", "../internal/proto/testdata/types.proto"})
+
+	stdout, stderr, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	require.Equal(t, "", stderr)
+	require.Contains(t, stdout, "// example.ExampleMessage (../internal/proto/testdata/types.proto)\n// Message definition\nmessage ExampleMessage {")
+	require.Contains(t, stdout, "  // Enum type\n  .example.ExampleEnum enum_field = 16;")
+	require.Contains(t, stdout, "  oneof my_oneof {")
+}
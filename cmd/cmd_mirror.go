@@ -0,0 +1,367 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/Shopify/sarama"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func NewMirrorCmd() *cobra.Command { //nolint:funlen
+	var (
+		from, to      mirrorSide
+		groupFlag     string
+		topicsFlag    []string
+		topicMapFlag  []string
+		partitionFlag string
+		fromOldest    bool
+		inFlightFlag  int
+		filterFlag    string
+		redactFlag    []string
+		toMessageFlag string
+		fieldMapFlag  []string
+		skipInvalid   bool
+
+		topicMap map[string]string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "mirror [MessageName]",
+		Short: "Mirror records from one cluster to another, optionally filtering and transcoding messages",
+		Args:  cobra.MaximumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			bindProducerFlags(cmd.Flags())
+
+			if topicMap, err = parseTopicMap(topicMapFlag); err != nil {
+				return
+			}
+
+			switch partitionFlag {
+			case ReplayPartitionPreserve, ReplayPartitionRehash:
+			default:
+				return fmt.Errorf(
+					"partition flag has invalid value: %s, use one of %s, %s",
+					partitionFlag, ReplayPartitionPreserve, ReplayPartitionRehash,
+				)
+			}
+
+			if inFlightFlag < 1 {
+				inFlightFlag = 1
+			}
+
+			return
+		},
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			var fromDesc, toDesc *desc.MessageDescriptor
+			if len(args) > 0 || toMessageFlag != "" {
+				if len(args) == 0 {
+					return errors.New("--to-message requires message name")
+				}
+
+				p, err := parseProtofiles()
+				if err != nil {
+					return err
+				}
+
+				if fromDesc, err = findMessage(p, args[0]); err != nil {
+					return err
+				}
+
+				if toMessageFlag != "" {
+					if toDesc, err = findMessage(p, toMessageFlag); err != nil {
+						return err
+					}
+				}
+			}
+
+			transform, err := newMirrorTransform(fromDesc, toDesc, filterFlag, redactFlag, fieldMapFlag)
+			if err != nil {
+				return
+			}
+
+			// every cluster has own config
+			fromConfig, err := from.config()
+			if err != nil {
+				return
+			}
+
+			if fromOldest {
+				fromConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+			}
+
+			toConfig, err := to.config()
+			if err != nil {
+				return
+			}
+
+			if partitionFlag == ReplayPartitionPreserve {
+				toConfig.Producer.Partitioner = sarama.NewManualPartitioner
+			} else if toConfig.Producer.Partitioner, err = newPartitioner(viper.GetString("partitioner"), -1); err != nil {
+				return
+			}
+
+			err = applyProducerOptions(toConfig, producerOptions())
+			if err != nil {
+				return
+			}
+
+			producer, err := kafka.NewProducer(to.brokers, toConfig)
+			if err != nil {
+				return
+			}
+			defer closeProducer(producer, &err)
+
+			consumer, err := kafka.NewConsumerGroup(from.brokers, groupFlag, fromConfig)
+			if err != nil {
+				return
+			}
+			defer consumer.Close()
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			handler := &mirrorHandler{
+				ctx:         ctx,
+				producer:    producer,
+				transform:   transform,
+				topicMap:    topicMap,
+				inFlight:    inFlightFlag,
+				skipInvalid: skipInvalid,
+			}
+
+			// failed produce and invalid records stop mirroring
+			errc := make(chan error, 1)
+			go func() {
+				for err := range consumer.Errors() {
+					log.Errorf("Mirror error: %s", err)
+
+					if errors.Is(err, ErrWriteMessage) || errors.Is(err, ErrInvalidRecord) {
+						select {
+						case errc <- err:
+						default:
+						}
+						stop()
+					}
+				}
+			}()
+
+			log.Infof("Mirror topics %v from %v to %v", topicsFlag, from.brokers, to.brokers)
+
+			err = consumer.Consume(ctx, topicsFlag, handler)
+
+			log.Infof(
+				"Mirrored %d records, failed %d, filtered out %d, invalid skipped %d",
+				atomic.LoadInt64(&handler.mirrored), atomic.LoadInt64(&handler.failed),
+				atomic.LoadInt64(&handler.skipped), atomic.LoadInt64(&handler.invalid),
+			)
+
+			if dropped := transform.Dropped(); len(dropped) > 0 {
+				log.Warnf("Fields dropped by transcoding: %s", strings.Join(dropped, ", "))
+			}
+
+			select {
+			case err = <-errc:
+				return err
+			default:
+			}
+
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+
+			return err
+		},
+	}
+
+	flags := cmd.Flags()
+
+	setMirrorSideFlags(flags, "from", &from)
+	setMirrorSideFlags(flags, "to", &to)
+
+	flags.StringVarP(&groupFlag, "group", "G", "", "Consumer group in the source cluster")
+	flags.StringSliceVarP(&topicsFlag, "topic", "t", []string{}, "Topic to mirror")
+	flags.StringArrayVar(&topicMapFlag, "topic-map", []string{}, "Produce records of src topic to dst topic: src=dst (may be specified multiple times)")
+	flags.StringVar(&partitionFlag, "partition", ReplayPartitionPreserve, fmt.Sprintf(
+		"Partitions of records: %s (original partitions), %s (choose by key with --partitioner)",
+		ReplayPartitionPreserve, ReplayPartitionRehash,
+	))
+	flags.BoolVar(&fromOldest, "from-oldest", false, "Start from the oldest records if group has no committed offsets")
+	flags.IntVar(&inFlightFlag, "in-flight", 100, "Number of records of every partition produced without waiting for results")
+	flags.StringVar(&filterFlag, "filter", "", `Mirror only records the template is "true" for, e.g. '{{ eq .Message.name "Alice" }}'`)
+	flags.StringArrayVar(&redactFlag, "redact", []string{}, "Clear the field at dotted path, e.g. user.email (may be specified multiple times)")
+	flags.StringVar(&toMessageFlag, "to-message", "", "Re-encode messages with this message type")
+	flags.StringArrayVar(&fieldMapFlag, "field-map", []string{}, "Move value of field to another one: old=new, dotted paths (may be specified multiple times)")
+	flags.BoolVar(&skipInvalid, "skip-invalid", false, "Skip records failed to decode or transcode and commit their offsets instead of stopping")
+
+	setProducerFlags(flags)
+
+	_ = cmd.MarkFlagRequired("from-broker")
+	_ = cmd.MarkFlagRequired("to-broker")
+	_ = cmd.MarkFlagRequired("group")
+	_ = cmd.MarkFlagRequired("topic")
+
+	return cmd
+}
+
+// mirrorSide is connection options of a cluster.
+type mirrorSide struct {
+	brokers []string
+	authDSN string
+	tls     kafka.TLSOptions
+}
+
+func setMirrorSideFlags(flags *pflag.FlagSet, side string, o *mirrorSide) {
+	flags.StringSliceVar(&o.brokers, side+"-broker", []string{}, fmt.Sprintf("Bootstrap broker(s) of %s cluster (host[:port],...)", side))
+	flags.StringVar(&o.authDSN, side+"-auth-dsn", "", fmt.Sprintf("Kafka auth DSN of %s cluster (%s)", side, kafka.AuthDSNTemplate))
+	flags.BoolVar(&o.tls.Enable, side+"-tls", false, fmt.Sprintf("Connect to %s cluster with TLS", side))
+	flags.StringVar(&o.tls.CAFile, side+"-tls-ca", "", fmt.Sprintf("CA certificates file of %s cluster", side))
+	flags.StringVar(&o.tls.CertFile, side+"-tls-cert", "", fmt.Sprintf("Client certificate file for %s cluster", side))
+	flags.StringVar(&o.tls.KeyFile, side+"-tls-key", "", fmt.Sprintf("Client key file for %s cluster", side))
+	flags.BoolVar(&o.tls.InsecureSkipVerify, side+"-tls-insecure", false, fmt.Sprintf("Skip verification of %s cluster certificates", side))
+}
+
+// config returns a new kafka config of the cluster.
+func (o mirrorSide) config() (*sarama.Config, error) {
+	config, err := kafka.NewConfig(appName, o.authDSN, viper.GetString("kafka-version"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.tls.Apply(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ErrInvalidRecord is an error of a record which can't be decoded or transcoded.
+var ErrInvalidRecord = errors.New("invalid record")
+
+// mirrorHandler produces consumed records to another cluster,
+// offsets are marked in order after records are produced.
+type mirrorHandler struct {
+	// ctx is the context of producing, records of a revoked claim are still produced
+	ctx         context.Context
+	producer    *kafka.Producer
+	transform   *mirrorTransform
+	topicMap    map[string]string
+	inFlight    int
+	skipInvalid bool
+
+	// failed counts records failed to produce, invalid counts records skipped with skipInvalid
+	mirrored, skipped, failed, invalid int64
+}
+
+func (*mirrorHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (*mirrorHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim produces records until the claim is revoked, records in flight are waited then.
+func (h *mirrorHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	type pending struct {
+		msg    *sarama.ConsumerMessage
+		result <-chan error
+	}
+
+	queue := make([]pending, 0, h.inFlight)
+
+	// wait marks records while more than n are in flight
+	wait := func(n int) error {
+		for len(queue) > n {
+			p := queue[0]
+			queue = queue[1:]
+
+			// skipped record
+			if p.result == nil {
+				sess.MarkMessage(p.msg, "")
+				continue
+			}
+
+			err := <-p.result
+
+			// interrupted, offsets of unfinished records aren't marked
+			if err != nil && h.ctx.Err() != nil && errors.Is(err, h.ctx.Err()) {
+				return nil
+			}
+
+			if err != nil {
+				atomic.AddInt64(&h.failed, 1)
+				return fmt.Errorf("%w: %s", ErrWriteMessage, err)
+			}
+
+			atomic.AddInt64(&h.mirrored, 1)
+			sess.MarkMessage(p.msg, "")
+		}
+
+		return nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return wait(0)
+			}
+
+			result, err := h.send(msg)
+			if err != nil {
+				if werr := wait(0); werr != nil {
+					return werr
+				}
+
+				return err
+			}
+
+			queue = append(queue, pending{msg: msg, result: result})
+
+			if err := wait(h.inFlight - 1); err != nil {
+				return err
+			}
+
+		case <-sess.Context().Done():
+			return wait(0)
+		}
+	}
+}
+
+// send produces the record and returns the channel of its result, filtered out records are skipped
+// with nil channel. Records failed to transform are skipped with skipInvalid, otherwise ErrInvalidRecord is returned.
+func (h *mirrorHandler) send(msg *sarama.ConsumerMessage) (<-chan error, error) {
+	value, ok, err := h.transform.Apply(msg)
+	if err != nil {
+		if !h.skipInvalid {
+			return nil, fmt.Errorf("%w %s/%d/%d: %s", ErrInvalidRecord, msg.Topic, msg.Partition, msg.Offset, err)
+		}
+
+		atomic.AddInt64(&h.invalid, 1)
+		log.Errorf("Failed to transform record %s/%d/%d, it's skipped: %s", msg.Topic, msg.Partition, msg.Offset, err)
+
+		return nil, nil
+	}
+
+	if !ok {
+		atomic.AddInt64(&h.skipped, 1)
+		return nil, nil
+	}
+
+	pm := kafka.NewRecordFromConsumerMessage(msg).ProducerMessage()
+	if value != nil {
+		pm.Value = sarama.ByteEncoder(value)
+	}
+
+	if topic, ok := h.topicMap[msg.Topic]; ok {
+		pm.Topic = topic
+	}
+
+	return h.producer.Send(h.ctx, pm), nil
+}
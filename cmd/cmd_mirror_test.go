@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConsumerGroupSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context // background if nil
+	marked []int64
+}
+
+func (s *testConsumerGroupSession) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+
+	return s.ctx
+}
+
+func (s *testConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type testConsumerGroupClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testConsumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func Test_mirrorHandler_ConsumeClaim(t *testing.T) {
+	md := findTestMessage(t, "HelloRequest")
+
+	tr, err := newMirrorTransform(md, nil, `{{ ne .Message.name "skip" }}`, nil, nil)
+	require.Nil(t, err)
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = sarama.NewManualPartitioner
+
+	client := mocks.NewAsyncProducer(t, config)
+
+	var produced []*sarama.ProducerMessage
+	for i := 0; i < 2; i++ {
+		client.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			produced = append(produced, msg)
+			return nil
+		})
+	}
+	client.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+
+	producer := kafka.NewProducerFromClient(client)
+	defer producer.Close()
+
+	h := &mirrorHandler{
+		ctx:       context.Background(),
+		producer:  producer,
+		transform: tr,
+		topicMap:  map[string]string{"src": "dst"},
+		inFlight:  2,
+	}
+
+	claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 10)}
+	for i, name := range []string{"a", "skip", "b", "c"} {
+		claim.messages <- &sarama.ConsumerMessage{
+			Topic:     "src",
+			Partition: 2,
+			Offset:    int64(i),
+			Key:       []byte(name),
+			Value:     encodeTestMessage(t, md, `{"name": "`+name+`"}`),
+		}
+	}
+	close(claim.messages)
+
+	sess := &testConsumerGroupSession{}
+
+	err = h.ConsumeClaim(sess, claim)
+	assert.ErrorIs(t, err, ErrWriteMessage)
+
+	// offset of failed record isn't marked
+	assert.Equal(t, []int64{0, 1, 2}, sess.marked)
+
+	require.Len(t, produced, 2)
+	assert.Equal(t, "dst", produced[0].Topic)
+	assert.Equal(t, int32(2), produced[0].Partition)
+	// failed record isn't counted as mirrored
+	assert.EqualValues(t, 2, h.mirrored)
+	assert.EqualValues(t, 1, h.failed)
+	assert.EqualValues(t, 1, h.skipped)
+}
+
+func Test_mirrorHandler_ConsumeClaim_Invalid(t *testing.T) {
+	md := findTestMessage(t, "HelloRequest")
+
+	tr, err := newMirrorTransform(md, nil, "", nil, nil)
+	require.Nil(t, err)
+
+	for _, skipInvalid := range []bool{false, true} {
+		config := sarama.NewConfig()
+		config.Producer.Return.Successes = true
+
+		// unused expectations are reported on close, ignore them
+		client := mocks.NewAsyncProducer(nopErrorReporter{}, config)
+		client.ExpectInputAndSucceed()
+		client.ExpectInputAndSucceed()
+
+		producer := kafka.NewProducerFromClient(client)
+
+		h := &mirrorHandler{ctx: context.Background(), producer: producer, transform: tr, inFlight: 10, skipInvalid: skipInvalid}
+
+		claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "src", Offset: 0, Value: encodeTestMessage(t, md, `{"name": "a"}`)}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "src", Offset: 1, Value: []byte{0xff}}
+		claim.messages <- &sarama.ConsumerMessage{Topic: "src", Offset: 2, Value: encodeTestMessage(t, md, `{"name": "b"}`)}
+		close(claim.messages)
+
+		sess := &testConsumerGroupSession{}
+		err := h.ConsumeClaim(sess, claim)
+		producer.Close()
+
+		if skipInvalid {
+			require.Nil(t, err)
+			assert.Equal(t, []int64{0, 1, 2}, sess.marked)
+			assert.EqualValues(t, 1, h.invalid)
+			assert.EqualValues(t, 2, h.mirrored)
+		} else {
+			// offset of the invalid record isn't committed
+			assert.ErrorIs(t, err, ErrInvalidRecord)
+			assert.Equal(t, []int64{0}, sess.marked)
+		}
+	}
+}
+
+func Test_mirrorHandler_ConsumeClaim_Revoked(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	client := mocks.NewAsyncProducer(t, config)
+	client.ExpectInputAndSucceed()
+
+	producer := kafka.NewProducerFromClient(client)
+	defer producer.Close()
+
+	tr, err := newMirrorTransform(nil, nil, "", nil, nil)
+	require.Nil(t, err)
+
+	h := &mirrorHandler{ctx: context.Background(), producer: producer, transform: tr, inFlight: 10}
+
+	claim := &testConsumerGroupClaim{messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "src", Value: []byte("a")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &testConsumerGroupSession{ctx: ctx}
+
+	// the claim is revoked after the record, it's produced and marked without errors
+	go func() {
+		for len(claim.messages) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	require.Nil(t, h.ConsumeClaim(sess, claim))
+	assert.Equal(t, []int64{0}, sess.marked)
+}
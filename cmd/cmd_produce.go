@@ -2,28 +2,42 @@ package cmd
 
 import (
 	"bufio"
-	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"sync/atomic"
-	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/Shopify/sarama"
 	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
 	"github.com/kuper-tech/protokaf/internal/calldata"
 	"github.com/kuper-tech/protokaf/internal/kafka"
 	"github.com/kuper-tech/protokaf/internal/proto"
 	"github.com/kuper-tech/protokaf/internal/tracing"
 	"github.com/kuper-tech/protokaf/internal/utils/dump"
+	"github.com/kuper-tech/protokaf/internal/utils/ratelimit"
+	"github.com/kuper-tech/protokaf/internal/utils/stats"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	jaegerConfig "github.com/uber/jaeger-client-go/config"
-	jaegerZapLog "github.com/uber/jaeger-client-go/log/zap"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// PrintBytesHexValue prints encoded values as hex dump.
+	PrintBytesHexValue = "hex"
+
+	// PrintBytesBase64Value prints encoded values in base64.
+	PrintBytesBase64Value = "base64"
 )
 
 func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
@@ -34,12 +48,36 @@ func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
 		timeoutStr             string
 		timeoutFlag            time.Duration
 		traceFlag              bool
+		traceParentFlag        string
+		traceIDFlag            string
+		parentSpanIDFlag       string
+		parentSpan             *jaeger.SpanContext
+		traceParent            opentracing.StartSpanOption
 		printJaegerConfig      bool
 		printTemplateFunctions bool
 		countFlag              int
 		concurrencyFlag        int
+		inFlightFlag           int
+		maxErrorsFlag          int
+		rateFlag               string
+		durationFlag           time.Duration
+		rate                   *ratelimit.Rate
+		statsFlag              bool
+		statsIntervalFlag      time.Duration
+		statsJSONFlag          string
+		collector              *stats.Collector
 		seedFlag               int64
 		headers                []string
+		transactionalIDFlag    string
+		transactionSizeFlag    int
+		abortFlag              bool
+		tombstoneFlag          bool
+		inputFormatFlag        string
+		inputCodec             proto.Codec
+		timestampFlag          string
+		dryRunFlag             bool
+		printBytesFlag         string
+		outFlag                string
 	)
 
 	printInfo := func() bool {
@@ -57,13 +95,49 @@ func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
 			return messageNameRequired(cmd, args)
 		},
 		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			tracing.BindJaegerFlags(cmd.Flags())
+
 			if printInfo() {
 				return
 			}
 
-			err = cmd.MarkFlagRequired("topic")
+			bindProducerFlags(cmd.Flags())
+
+			// spans of messages join the existing trace
+			if traceParentFlag != "" || traceIDFlag != "" || parentSpanIDFlag != "" {
+				parent, err := tracing.ParentSpanContext(traceParentFlag, traceIDFlag, parentSpanIDFlag)
+				if err != nil {
+					return err
+				}
+
+				parentSpan = &parent
+				traceFlag = true
+			}
+
+			// messages may be built without topic
+			dryRunFlag = dryRunFlag || outFlag != ""
+
+			if !dryRunFlag {
+				err = cmd.MarkFlagRequired("topic")
+				if err != nil {
+					return
+				}
+			} else if durationFlag > 0 || traceFlag || transactionalIDFlag != "" {
+				return errors.New("--dry-run can't be used with --duration, --trace or --transactional-id")
+			}
+
+			switch printBytesFlag {
+			case "", PrintBytesHexValue, PrintBytesBase64Value:
+			default:
+				return fmt.Errorf(
+					"print-bytes flag has invalid value: %s, use one of %s, %s",
+					printBytesFlag, PrintBytesHexValue, PrintBytesBase64Value,
+				)
+			}
+
+			inputCodec, err = proto.NewCodec(inputFormatFlag)
 			if err != nil {
-				return
+				return fmt.Errorf("input-format flag has invalid value: %w", err)
 			}
 
 			if timeoutStr != "" {
@@ -73,14 +147,41 @@ func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
 				}
 			}
 
-			if countFlag < 1 {
+			// with duration messages are produced until time is up
+			if durationFlag > 0 && !cmd.Flags().Changed("count") {
+				countFlag = 0
+			} else if countFlag < 1 {
 				countFlag = 1
 			}
 
+			if rateFlag != "" {
+				r, err := ratelimit.ParseRate(rateFlag)
+				if err != nil {
+					return err
+				}
+				rate = &r
+			}
+
+			if transactionalIDFlag != "" {
+				if durationFlag > 0 || rate != nil {
+					return errors.New("--transactional-id can't be used with --duration or --rate")
+				}
+			} else if abortFlag {
+				return errors.New("--abort requires --transactional-id")
+			}
+
+			if tombstoneFlag && keyFlag == "" {
+				return errors.New("--tombstone requires --key")
+			}
+
 			if concurrencyFlag < 1 {
 				concurrencyFlag = 1
 			}
 
+			if inFlightFlag < 1 {
+				inFlightFlag = 1
+			}
+
 			return
 		},
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
@@ -89,30 +190,29 @@ func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
 				return
 			}
 
-			// create tracer config
-			jaegerCfg, jaegerCfgErr := tracing.NewJaegerConfig()
 			if printJaegerConfig {
+				jaegerCfg, _ := tracing.NewJaegerConfig()
 				dump.PrintStruct(log, "Jaeger config", jaegerCfg)
 				return
 			}
 
 			// create tracer
 			if traceFlag {
-				if jaegerCfgErr != nil {
-					return jaegerCfgErr
+				closer, err := newTracer()
+				if err != nil {
+					return err
 				}
+				defer closer.Close()
+			}
 
-				jaegerLogger := zapLog.Named("jaeger")
-				tracer, closer, err := jaegerCfg.NewTracer(
-					jaegerConfig.Logger(jaegerZapLog.NewLogger(jaegerLogger)),
-				)
+			// parent is converted to the span context of the tracer, its spans can't be children of others
+			if parentSpan != nil {
+				parent, err := tracing.ContinueSpanContext(opentracing.GlobalTracer(), *parentSpan)
 				if err != nil {
-					return err
+					return fmt.Errorf("continue trace: %w", err)
 				}
 
-				opentracing.SetGlobalTracer(tracer)
-				log.Debug("Create new tracer")
-				defer closer.Close()
+				traceParent = opentracing.ChildOf(parent)
 			}
 
 			// parse protofiles & create proto object
@@ -127,10 +227,13 @@ func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
 				return
 			}
 
-			// read data form stdin or -d flag
-			data, err := readData(dataFlag)
-			if err != nil {
-				return
+			// read data form stdin or -d flag, tombstones have no data
+			var data []byte
+			if !tombstoneFlag {
+				data, err = readData(dataFlag)
+				if err != nil {
+					return
+				}
 			}
 
 			// set seed for random data
@@ -140,52 +243,130 @@ func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
 				log.Infof("Producing %d messages...", countFlag)
 			}
 
-			// partition num defined by message field
-			if p := flags.Partition; p != -1 {
-				kafkaConfig.Producer.Partitioner = func(topic string) sarama.Partitioner {
-					return constPartitioner{p}
-				}
+			if durationFlag > 0 {
+				log.Infof("Producing messages for %s...", durationFlag)
 			}
 
-			// create producer
-			producer, err := kafka.NewProducer(viper.GetStringSlice("broker"), kafkaConfig)
+			// partition num defined by --partition flag is used as is
+			partitioner := viper.GetString("partitioner")
+			if flags.Partition != -1 {
+				partitioner = PartitionerManual
+			}
+
+			kafkaConfig.Producer.Partitioner, err = newPartitioner(partitioner, flags.Partition)
 			if err != nil {
-				return err
+				return
+			}
+
+			err = applyProducerOptions(kafkaConfig, producerOptions())
+			if err != nil {
+				return
 			}
-			defer producer.Close()
 
-			// parse template for data
-			tmpl, err := calldata.ParseTemplate(data)
+			// parse templates of message parts, binary data isn't a template
+			valueTemplate := data
+			if inputFormatFlag == proto.FormatBinary {
+				valueTemplate = nil
+			}
+
+			tmpl, err := parseProduceTemplate(topicFlag, keyFlag, headers, timestampFlag, valueTemplate)
 			if err != nil {
 				return
 			}
 
+			if inputFormatFlag == proto.FormatBinary {
+				tmpl.rawValue = data
+			}
+
+			var producer *kafka.Producer
+
+			newMessage := func(reqNum int) *produceMessage {
+				return &produceMessage{
+					reqNum:       reqNum,
+					sendTimeout:  timeoutFlag,
+					producer:     producer,
+					traceEnabled: traceFlag,
+					tracer:       opentracing.GlobalTracer(),
+					traceParent:  traceParent,
+					tmpl:         tmpl,
+					messageDesc:  md,
+					codec:        inputCodec,
+					stats:        collector,
+				}
+			}
+
+			if dryRunFlag {
+				return produceDryRun(newMessage, countFlag, printBytesFlag, outFlag)
+			}
+
+			// broker may override timestamps of records
+			if timestampFlag != "" && !strings.Contains(topicFlag, "{{") {
+				if err = checkTimestampType(topicFlag); err != nil {
+					return
+				}
+			}
+
+			if statsFlag || statsJSONFlag != "" {
+				collector = stats.NewCollector()
+				defer func() {
+					if reportErr := reportProduceStats(collector, statsJSONFlag, cmd.OutOrStdout()); err == nil {
+						err = reportErr
+					}
+				}()
+
+				if statsIntervalFlag > 0 {
+					stopProgress := printProduceProgress(collector, statsIntervalFlag)
+					defer stopProgress()
+				}
+			}
+
+			if transactionalIDFlag != "" {
+				tp, err := kafka.NewTransactionalProducer(
+					viper.GetStringSlice("broker"), kafkaConfig, transactionalIDFlag,
+				)
+				if err != nil {
+					return err
+				}
+				defer tp.Close()
+
+				return produceTransactions(tp, newMessage, countFlag, transactionSizeFlag, !abortFlag)
+			}
+
+			// create producer
+			producer, err = kafka.NewProducer(viper.GetStringSlice("broker"), kafkaConfig)
+			if err != nil {
+				return err
+			}
+			defer closeProducer(producer, &err)
+
 			// send messages
 			execCtx, cancel := context.WithCancel(cmd.Context())
 			defer cancel()
 
-			workers := newProduceWorker(concurrencyFlag)
-			workers.Run(execCtx, countFlag)
+			workers := newProduceWorker(concurrencyFlag, inFlightFlag)
+
+			// errors are counted by statistics
+			if maxErrorsFlag == 0 && collector == nil {
+				maxErrorsFlag = 1
+			}
+			workers.SetMaxErrors(maxErrorsFlag)
+			if rate != nil {
+				log.Infof("Producing rate: %s", rate)
+				workers.SetLimiter(ratelimit.NewLimiter(*rate, 1))
+			}
+			workers.Run(execCtx, countFlag, durationFlag)
 
 			go func() {
-				for i := 0; i < countFlag; i++ {
-					workers.AddJob(&produceMessage{
-						reqNum:       i,
-						key:          keyFlag,
-						topic:        topicFlag,
-						data:         data,
-						headers:      headers,
-						sendTimeout:  timeoutFlag,
-						producer:     producer,
-						traceEnabled: traceFlag,
-						tracer:       opentracing.GlobalTracer(),
-						tmpl:         tmpl,
-						messageDesc:  md,
-					})
+				for i := 0; countFlag == 0 || i < countFlag; i++ {
+					if !workers.AddJob(newMessage(i)) {
+						return
+					}
 				}
 			}()
 
-			return workers.Result()
+			err = workers.Result()
+
+			return
 		},
 	}
 
@@ -197,36 +378,41 @@ func NewProduceCmd() *cobra.Command { //nolint:funlen,gocognit
 	flags.StringArrayVarP(&headers, "header", "H", []string{}, "Add message headers (may be specified multiple times)")
 	flags.StringVar(&timeoutStr, "timeout", "60s", "Operation timeout")
 	flags.BoolVar(&traceFlag, "trace", false, "Send OpenTracing spans to Jaeger")
+	flags.StringVar(&traceParentFlag, "trace-parent", "", "Continue the trace of W3C traceparent instead of starting new traces (implies --trace)")
+	flags.StringVar(&traceIDFlag, "trace-id", "", "Continue the trace with this ID in hex, requires --parent-span-id (implies --trace)")
+	flags.StringVar(&parentSpanIDFlag, "parent-span-id", "", "ID of the parent span in hex of --trace-id")
 	flags.BoolVar(&printJaegerConfig, "jaeger-config-print", false, "Print Jaeger config")
 	flags.IntVarP(&countFlag, "count", "c", 1, "Producing this number of messages")
+	flags.DurationVar(&durationFlag, "duration", 0, "Producing messages during this time instead of --count")
+	flags.StringVar(&rateFlag, "rate", "", `Limit producing rate, e.g. "500/s" or "100/s..2000/s over 5m"`)
 	flags.IntVar(&concurrencyFlag, "concurrency", 1, "Number of message senders to run concurrently for const concurrency producing")
+	flags.IntVar(&inFlightFlag, "in-flight", 100, "Number of messages each sender may produce without waiting for results")
+	flags.IntVar(&maxErrorsFlag, "max-errors", 0, "Stop after this number of failed messages, -1 for no limit (default: 1, no limit with statistics)")
 	flags.Int64Var(&seedFlag, "seed", 0, "Set seed for pseudo-random sequence")
+	flags.BoolVar(&statsFlag, "stats", false, "Print producing statistics instead of produced messages")
+	flags.DurationVar(&statsIntervalFlag, "stats-interval", 5*time.Second, "Interval of statistics progress lines, 0 to disable")
+	flags.StringVar(&statsJSONFlag, "stats-json", "", `Write final statistics report as JSON to this file ("-" for stdout)`)
+	flags.BoolVar(&dryRunFlag, "dry-run", false, "Build and print messages without producing")
+	flags.StringVar(&printBytesFlag, "print-bytes", "", fmt.Sprintf(
+		"Print encoded values in dry run: %s, %s", PrintBytesHexValue, PrintBytesBase64Value,
+	))
+	flags.StringVar(&outFlag, "out", "", "Write encoded values as length-delimited stream to this file (implies --dry-run)")
+	flags.StringVar(&timestampFlag, "timestamp", "", "Record timestamp in RFC3339 format or unix time in milliseconds, may be a template")
+	flags.StringVar(&inputFormatFlag, "input-format", proto.FormatJSON, fmt.Sprintf(
+		"Format of message data: %s", strings.Join(proto.Formats, ", "),
+	))
+	flags.BoolVar(&tombstoneFlag, "tombstone", false, "Produce messages with null value to delete the key on compacted topics")
+	flags.StringVar(&transactionalIDFlag, "transactional-id", "", "Produce messages in transactions with this transactional id (experimental)")
+	flags.IntVar(&transactionSizeFlag, "transaction-size", 0, "Number of messages in every transaction (default: all of --count)")
+	flags.BoolVar(&abortFlag, "abort", false, "Abort transactions instead of committing them")
 	flags.BoolVar(&printTemplateFunctions, "template-functions-print", false, "Print functions for using in template")
 
+	setProducerFlags(flags)
 	tracing.SetJaegerFlags(flags)
 
 	return cmd
 }
 
-func makeProduceHeaders(headers []string) []sarama.RecordHeader {
-	sep := []byte{'='}
-	hdrs := make([]sarama.RecordHeader, 0, len(headers))
-	for _, h := range headers {
-		parts := bytes.SplitN([]byte(h), sep, 2)
-		if len(parts) != 2 {
-			log.Warnf("Invalid headers pair: %s", h)
-			continue
-		}
-
-		hdrs = append(hdrs, sarama.RecordHeader{
-			Key:   parts[0],
-			Value: parts[1],
-		})
-	}
-
-	return hdrs
-}
-
 func getProducedMessageData(msg *sarama.ProducerMessage) dump.Pairs {
 	var keyBytes []byte
 	if msg.Key != nil {
@@ -234,22 +420,162 @@ func getProducedMessageData(msg *sarama.ProducerMessage) dump.Pairs {
 	}
 
 	var valuesBytes []byte
-	valuesBytes, _ = msg.Value.Encode()
+	if msg.Value != nil {
+		valuesBytes, _ = msg.Value.Encode()
+	}
 
 	headers := kafka.RecordHeaders(msg.Headers)
 
 	return dump.Pairs{
+		{Name: "timestamp", Value: msg.Timestamp},
 		{Name: "topic", Value: msg.Topic},
 		{Name: "partition", Value: msg.Partition},
 		{Name: "offset", Value: msg.Offset},
 		{Name: "key", Value: string(keyBytes)},
-		{Name: "length", Value: msg.Value.Length()},
+		{Name: "length", Value: valueLength(msg)},
 		{Name: "headers", Value: headers.String()},
 		{Name: "metadata", Value: msg.Metadata},
 		{Name: "value", Value: valuesBytes},
 	}
 }
 
+// produceDryRun builds count messages without producing, prints them
+// and writes values as length-delimited stream to the file if it's set.
+func produceDryRun(newMessage func(reqNum int) *produceMessage, count int, printBytes, filename string) error {
+	var (
+		f   *os.File
+		out *bufio.Writer
+	)
+
+	if filename != "" {
+		var err error
+		if f, err = os.Create(filename); err != nil {
+			return err
+		}
+
+		// closed explicitly on success, the error of closing after a failure doesn't matter
+		defer func() {
+			if f != nil {
+				_ = f.Close()
+			}
+		}()
+
+		out = bufio.NewWriter(f)
+	}
+
+	for i := 0; i < count; i++ {
+		s, err := newMessage(i).Build()
+		if err != nil {
+			return fmt.Errorf("message %d: %w", i, err)
+		}
+
+		var value []byte
+		if s.msg.Value != nil {
+			if value, err = s.msg.Value.Encode(); err != nil {
+				return fmt.Errorf("message %d: %w", i, err)
+			}
+		}
+
+		printBuiltMessage(s, value, printBytes)
+
+		if out == nil {
+			continue
+		}
+
+		if s.msg.Value == nil {
+			log.Warnf("Tombstone %d isn't written to %s", i, filename)
+			continue
+		}
+
+		if err := proto.WriteDelimited(out, value); err != nil {
+			return err
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("write %s: %w", filename, err)
+	}
+
+	err := f.Close()
+	f = nil
+	if err != nil {
+		return fmt.Errorf("close %s: %w", filename, err)
+	}
+
+	log.Infof("Messages are written to %s", filename)
+
+	return nil
+}
+
+// printBuiltMessage prints rendered data and encoded value of the message.
+func printBuiltMessage(s *sentMessage, value []byte, printBytes string) {
+	key, _ := s.msg.Key.Encode()
+
+	if s.message == nil {
+		dump.Tombstone(log, "Message built", key)
+	} else if !utf8.Valid(s.data) {
+		opts := jsonOptions()
+		opts.Indent = "  "
+		dump.DynamicMessage(log, "Message built", DecodeFlagJSONValue, proto.NewJSONCodec(opts), s.message)
+	} else {
+		dump.Text(log, "Message built", strings.TrimSpace(string(s.data)))
+	}
+
+	pairs := dump.Pairs{
+		{Name: "topic", Value: s.msg.Topic},
+		{Name: "key", Value: string(key)},
+		{Name: "headers", Value: kafka.RecordHeaders(s.msg.Headers).String()},
+		{Name: "timestamp", Value: s.msg.Timestamp},
+		{Name: "size", Value: len(value)},
+	}
+
+	switch printBytes {
+	case PrintBytesHexValue:
+		pairs = append(pairs, dump.Pair{Name: "value", Value: value})
+	case PrintBytesBase64Value:
+		pairs = append(pairs, dump.Pair{Name: "value", Value: base64.StdEncoding.EncodeToString(value)})
+	}
+
+	pairs.Print(log, "Encoded")
+}
+
+// checkTimestampType returns error if timestamps of topic records are set by broker.
+func checkTimestampType(topic string) error {
+	admin, err := sarama.NewClusterAdmin(viper.GetStringSlice("broker"), kafkaConfig)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	values, err := kafka.TopicConfig(admin, topic, kafka.TopicConfigTimestampType)
+	if err != nil {
+		log.Warnf("Failed to check %s of topic %s: %s", kafka.TopicConfigTimestampType, topic, err)
+		return nil
+	}
+
+	if values[kafka.TopicConfigTimestampType] == kafka.TimestampTypeLogAppendTime {
+		return fmt.Errorf(
+			"topic %s has %s=%s, broker overrides timestamps of records",
+			topic, kafka.TopicConfigTimestampType, kafka.TimestampTypeLogAppendTime,
+		)
+	}
+
+	return nil
+}
+
+// valueLength returns length of message value, tombstones have no value.
+func valueLength(msg *sarama.ProducerMessage) int {
+	if msg.Value == nil {
+		return 0
+	}
+
+	return msg.Value.Length()
+}
+
 func readData(dataFlag string) ([]byte, error) {
 	if dataFlag != "" {
 		log.Debugf("Read data from --data value: %s", dataFlag)
@@ -273,122 +599,517 @@ func readData(dataFlag string) ([]byte, error) {
 
 type produceMessage struct {
 	reqNum       int
-	key          string
-	topic        string
-	data         []byte
-	headers      []string
 	sendTimeout  time.Duration
 	producer     *kafka.Producer
 	traceEnabled bool
 	tracer       opentracing.Tracer
-	tmpl         *template.Template
+	traceParent  opentracing.StartSpanOption // root spans if nil
+	tmpl         *produceTemplate
 	messageDesc  *desc.MessageDescriptor
+	codec        proto.Codec // JSON if nil
+	stats        *stats.Collector
 }
 
-func (p *produceMessage) Send(parentCtx context.Context) error {
-	cd := calldata.NewCallData(p.reqNum)
-	b, err := cd.Execute(p.tmpl)
+// Build builds the message to send, all templates are executed with the same call data.
+// Message is a tombstone with null value if template has no value or data is null.
+func (p *produceMessage) Build() (*sentMessage, error) {
+	msg, data, err := p.tmpl.Execute(calldata.NewCallData(p.reqNum))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var m *dynamic.Message
+
+	if data != nil && !isNullData(data) {
+		// parse data and create message
+		if p.codec == nil {
+			m, err = proto.Unmarshal(data, p.messageDesc)
+		} else {
+			m, err = proto.Decode(p.codec, data, p.messageDesc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		log.Debugf("Prepared protobuf message: %v", m)
+	}
+
+	if m != nil {
+		msg.Value = proto.Encoder(m)
+	}
+
+	s := &sentMessage{
+		produceMessage: p,
+		data:           data,
+		message:        m,
+		msg:            msg,
+	}
+
+	if p.traceEnabled {
+		var opts []opentracing.StartSpanOption
+		if p.traceParent != nil {
+			opts = append(opts, p.traceParent)
+		}
+
+		span, err := tracing.CreateSpan(p.tracer, msg, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debugf("Create new span: %v", span)
+		s.span = span
+	}
+
+	return s, nil
+}
+
+// Send builds the message and passes it to producer without waiting for the result.
+func (p *produceMessage) Send(parentCtx context.Context) (*sentMessage, error) {
+	s, err := p.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, p.sendTimeout)
+	s.sentAt = time.Now()
+	s.cancel = cancel
+	s.timeout = ctx.Done()
+	s.result = p.producer.Send(ctx, s.msg)
+
+	return s, nil
+}
+
+// sentMessage is a message passed to producer and waiting for the result.
+type sentMessage struct {
+	*produceMessage
+
+	data    []byte
+	message *dynamic.Message
+	msg     *sarama.ProducerMessage
+	span    opentracing.Span
+	sentAt  time.Time
+	cancel  context.CancelFunc
+	timeout <-chan struct{}
+	result  <-chan error
+}
+
+// Wait waits for the result of producing.
+func (s *sentMessage) Wait() (err error) {
+	defer s.cancel()
+
+	if s.span != nil {
+		defer s.span.Finish()
+	}
+
+	select {
+	case err = <-s.result:
+	case <-s.timeout:
+		err = context.DeadlineExceeded
 	}
 
-	// parse data and create message
-	m, err := proto.Unmarshal(b.Bytes(), p.messageDesc)
 	if err != nil {
+		if s.span != nil {
+			ext.LogError(s.span, err)
+		}
+
+		if s.stats != nil {
+			s.stats.Error(err)
+		}
+
 		return err
 	}
-	log.Debugf("Prepared protobuf message: %v", m)
 
-	// message to send
-	msg := &sarama.ProducerMessage{
-		Topic:   p.topic,
-		Key:     sarama.StringEncoder(p.key),
-		Value:   proto.Encoder(m),
-		Headers: makeProduceHeaders(p.headers),
+	if s.stats != nil {
+		s.stats.Success(valueLength(s.msg), time.Since(s.sentAt))
+		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(parentCtx, p.sendTimeout)
-	defer cancel()
+	rec, err := kafka.NewRecordFromProducerMessage(s.msg)
+	if err != nil {
+		return err
+	}
 
-	var span opentracing.Span
+	messages.Print("Message produced", rec, s.message)
+	getProducedMessageData(s.msg).Dump(log)
 
-	if p.traceEnabled {
-		span, err = tracing.CreateSpan(p.tracer, msg)
+	return nil
+}
+
+// produceTransactions produces count messages in transactions of size messages.
+// Transactions are committed or aborted.
+// closeProducer flushes buffered messages and closes the producer,
+// the error of flushing is set to err if there is no error yet.
+func closeProducer(producer *kafka.Producer, err *error) {
+	if closeErr := producer.Close(); closeErr != nil && *err == nil {
+		*err = fmt.Errorf("close producer: %w", closeErr)
+	}
+}
+
+func produceTransactions(
+	tp *kafka.TransactionalProducer, newMessage func(reqNum int) *produceMessage, count, size int, commit bool,
+) error {
+	if size < 1 || size > count {
+		size = count
+	}
+
+	batch := make([]*sentMessage, 0, size)
+	for i := 0; i < count; i++ {
+		s, err := newMessage(i).Build()
 		if err != nil {
 			return err
 		}
 
-		log.Debugf("Create new span: %v", span)
-		defer span.Finish()
-	}
+		batch = append(batch, s)
+		if len(batch) < size && i != count-1 {
+			continue
+		}
 
-	if err := p.producer.SendMessage(ctx, msg); err != nil {
-		if p.traceEnabled {
-			ext.LogError(span, err)
+		if err := produceTransaction(tp, batch, commit); err != nil {
+			return err
 		}
+		batch = batch[:0]
+	}
+
+	return nil
+}
+
+// produceTransaction produces messages in a transaction, results are reported as for other messages.
+func produceTransaction(tp *kafka.TransactionalProducer, batch []*sentMessage, commit bool) error {
+	msgs := make([]*sarama.ProducerMessage, 0, len(batch))
+	for _, s := range batch {
+		msgs = append(msgs, s.msg)
+	}
+
+	sentAt := time.Now()
+	err := tp.SendBatch(msgs, commit)
 
+	for _, s := range batch {
+		result := make(chan error, 1)
+		result <- err
+
+		s.sentAt = sentAt
+		s.cancel = func() {}
+		s.result = result
+		_ = s.Wait()
+	}
+
+	if err != nil {
 		return err
 	}
 
-	dump.DynamicMessage(log, "Message produced", viper.GetString("output"), m)
-	getProducedMessageData(msg).Dump(log)
+	if commit {
+		log.Infof("Transaction committed: %d message(s)", len(batch))
+	} else {
+		log.Infof("Transaction aborted: %d message(s)", len(batch))
+	}
 
 	return nil
 }
 
+// printProduceProgress prints statistics of every interval until returned function is called.
+func printProduceProgress(c *stats.Collector, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				log.Infof("Progress: %s", c.Interval())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// reportProduceStats prints final statistics and writes it as JSON if filename is set.
+func reportProduceStats(c *stats.Collector, filename string, stdout io.Writer) error {
+	r := c.Report()
+
+	log.Infof("Total: %s", r)
+	if len(r.Errors) > 0 {
+		log.Infof("Errors:\n%s", r.ErrorsString())
+	}
+
+	if filename == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if filename == "-" {
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+
+	return os.WriteFile(filename, append(data, '\n'), 0o600)
+}
+
 type produceWorker struct {
 	executed    int64
+	processed   int64
+	failed      int64
+	maxErrors   int64
 	concurrency int
+	inFlight    int
+	limiter     *ratelimit.Limiter
+	clock       ratelimit.Clock
 	jobs        chan *produceMessage
 	result      chan error
+	stop        chan struct{}
+	once        sync.Once
+	stopOnce    sync.Once
 }
 
-func newProduceWorker(concurrency int) *produceWorker {
+func newProduceWorker(concurrency, inFlight int) *produceWorker {
 	return &produceWorker{
 		concurrency: concurrency,
+		inFlight:    inFlight,
+		clock:       ratelimit.SystemClock,
 		jobs:        make(chan *produceMessage, concurrency),
 		result:      make(chan error, 1),
+		stop:        make(chan struct{}),
 	}
 }
 
-func (p *produceWorker) AddJob(pm *produceMessage) {
-	p.jobs <- pm
+// SetLimiter sets limiter shared by all senders.
+func (p *produceWorker) SetLimiter(l *ratelimit.Limiter) {
+	p.limiter = l
+}
+
+// SetMaxErrors sets the number of failed messages to stop after, there is no limit if it isn't positive.
+func (p *produceWorker) SetMaxErrors(n int) {
+	p.maxErrors = int64(n)
+}
+
+// SetClock sets clock of the duration.
+func (p *produceWorker) SetClock(c ratelimit.Clock) {
+	p.clock = c
+}
+
+// AddJob adds message to send, returns false if workers don't accept messages anymore.
+func (p *produceWorker) AddJob(pm *produceMessage) bool {
+	select {
+	case p.jobs <- pm:
+		return true
+	case <-p.stop:
+		return false
+	}
 }
 
 func (p *produceWorker) Result() error {
 	return <-p.result
 }
 
-func (p *produceWorker) Run(parentCtx context.Context, count int) {
+// Run starts workers, every worker sends messages while waiting results
+// of up to inFlight previous ones. Workers stop after count messages
+// or after the duration if it's set, in-flight messages are waited.
+func (p *produceWorker) Run(parentCtx context.Context, count int, duration time.Duration) {
 	ctx, cancel := context.WithCancel(parentCtx)
 
+	stop := func() {
+		p.stopOnce.Do(func() { close(p.stop) })
+	}
+
+	var (
+		mu      sync.Mutex
+		lastErr error
+	)
+
 	done := func(err error) {
-		cancel()
-		p.result <- err
+		p.once.Do(func() {
+			stop()
+			cancel()
+
+			if failed := atomic.LoadInt64(&p.failed); err == nil && failed > 0 {
+				mu.Lock()
+				err = fmt.Errorf("%d messages failed to produce, last error: %w", failed, lastErr)
+				mu.Unlock()
+			}
+
+			p.result <- err
+		})
+	}
+
+	// fail counts the failed message and reports whether to continue
+	fail := func(err error) bool {
+		mu.Lock()
+		lastErr = err
+		mu.Unlock()
+
+		if n := atomic.AddInt64(&p.failed, 1); p.maxErrors > 0 && n >= p.maxErrors {
+			done(err)
+			return false
+		}
+
+		log.Debugf("Failed to produce message: %s", err)
+
+		return true
 	}
 
+	// processed counts the message and reports whether to continue
+	processed := func() bool {
+		if int(atomic.AddInt64(&p.processed, 1)) == count {
+			done(nil)
+			return false
+		}
+
+		return true
+	}
+
+	if duration > 0 {
+		p.clock.AfterFunc(duration, stop)
+	}
+
+	receivers := sync.WaitGroup{}
+	receivers.Add(p.concurrency)
+
 	for i := 0; i < p.concurrency; i++ {
+		sent := make(chan *sentMessage, p.inFlight)
+		tokens := make(chan struct{}, p.inFlight)
+
+		// sender
 		go func() {
+			defer close(sent)
+
 			for {
 				select {
+				case <-p.stop:
+					return
+
 				case pm := <-p.jobs:
-					if err := pm.Send(ctx); err != nil {
-						done(err)
+					select {
+					case tokens <- struct{}{}:
+					case <-p.stop:
 						return
 					}
 
-					if int(atomic.AddInt64(&p.executed, 1)) == count {
-						done(nil)
-						return
+					if p.limiter != nil {
+						if err := p.limiter.Wait(ctx); err != nil {
+							done(err)
+							return
+						}
+
+						// stopped while waiting
+						select {
+						case <-p.stop:
+							return
+						default:
+						}
 					}
 
+					s, err := pm.Send(ctx)
+					if err != nil {
+						<-tokens
+
+						if pm.stats != nil {
+							pm.stats.Error(err)
+						}
+
+						if !fail(err) || !processed() {
+							return
+						}
+
+						continue
+					}
+
+					sent <- s
+
 				case <-ctx.Done():
 					done(ctx.Err())
 					return
 				}
 			}
 		}()
+
+		// receiver
+		go func() {
+			defer receivers.Done()
+
+			for s := range sent {
+				err := s.Wait()
+				<-tokens
+
+				if err != nil {
+					if !fail(err) {
+						return
+					}
+				} else {
+					atomic.AddInt64(&p.executed, 1)
+				}
+
+				if !processed() {
+					return
+				}
+			}
+		}()
+	}
+
+	// all senders are stopped and in-flight messages are waited
+	go func() {
+		receivers.Wait()
+		done(nil)
+	}()
+}
+
+const (
+	// PartitionerMurmur2 hashes keys the same way as the Java client.
+	PartitionerMurmur2 = "murmur2"
+
+	// PartitionerFNV hashes keys with FNV-1a, the default partitioner of sarama.
+	PartitionerFNV = "fnv"
+
+	// PartitionerRandom chooses a random partition.
+	PartitionerRandom = "random"
+
+	// PartitionerRoundRobin chooses partitions in turn.
+	PartitionerRoundRobin = "roundrobin"
+
+	// PartitionerManual produces to the partition set by --partition flag.
+	PartitionerManual = "manual"
+)
+
+var partitionerValidValues = []string{
+	PartitionerMurmur2,
+	PartitionerFNV,
+	PartitionerRandom,
+	PartitionerRoundRobin,
+	PartitionerManual,
+}
+
+func newPartitioner(name string, partition int32) (sarama.PartitionerConstructor, error) {
+	switch name {
+	case PartitionerMurmur2:
+		return newMurmur2Partitioner, nil
+	case PartitionerFNV:
+		return sarama.NewHashPartitioner, nil
+	case PartitionerRandom:
+		return sarama.NewRandomPartitioner, nil
+	case PartitionerRoundRobin:
+		return sarama.NewRoundRobinPartitioner, nil
+	case PartitionerManual:
+		if partition < 0 {
+			return nil, errors.New("manual partitioner requires --partition")
+		}
+
+		return func(topic string) sarama.Partitioner {
+			return constPartitioner{partition}
+		}, nil
 	}
+
+	return nil, fmt.Errorf(
+		"partitioner flag has invalid value: %s, use one of %s",
+		name,
+		strings.Join(partitionerValidValues, ", "),
+	)
 }
 
 type constPartitioner struct {
@@ -402,3 +1123,75 @@ func (p constPartitioner) Partition(_ *sarama.ProducerMessage, _ int32) (int32,
 func (p constPartitioner) RequiresConsistency() bool {
 	return true
 }
+
+// murmur2Partitioner chooses partition of key like DefaultPartitioner of the Java client,
+// messages without key are sent to random partitions.
+type murmur2Partitioner struct {
+	random sarama.Partitioner
+}
+
+func newMurmur2Partitioner(topic string) sarama.Partitioner {
+	return murmur2Partitioner{random: sarama.NewRandomPartitioner(topic)}
+}
+
+func (p murmur2Partitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if msg.Key == nil {
+		return p.random.Partition(msg, numPartitions)
+	}
+
+	key, err := msg.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+
+	return murmur2Partition(key, numPartitions), nil
+}
+
+func (p murmur2Partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// murmur2Partition is Utils.toPositive(Utils.murmur2(key)) % numPartitions of the Java client.
+func murmur2Partition(key []byte, numPartitions int32) int32 {
+	return (murmur2(key) & 0x7fffffff) % numPartitions
+}
+
+// murmur2 is the 32-bit murmur2 hash as implemented by the Java client.
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return int32(h)
+}
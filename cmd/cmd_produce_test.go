@@ -1,9 +1,28 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/kuper-tech/protokaf/internal/calldata"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/kuper-tech/protokaf/internal/tracing"
+	"github.com/kuper-tech/protokaf/internal/utils/ratelimit"
+	"github.com/kuper-tech/protokaf/internal/utils/stats"
+	"github.com/opentracing/opentracing-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
 )
 
 func Test_NewProduceCmd_NoTopicFlags(t *testing.T) {
@@ -40,3 +59,556 @@ func Test_NewProduceCmd_JaegerConfigPrint(t *testing.T) {
 	assert.Contains(t, stdout, `Jaeger config`)
 	assert.Contains(t, stdout, `"LocalAgentHostPort": "0.0.0.0:6831"`)
 }
+
+func Test_produceWorker(t *testing.T) {
+	const count = 50
+
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	tmpl, err := parseProduceTemplate("test", "", nil, "", []byte(`{"name": "Alice", "age": {{.RequestNumber}}}`))
+	require.Nil(t, err)
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	client := mocks.NewAsyncProducer(t, config)
+	for i := 0; i < count; i++ {
+		client.ExpectInputAndSucceed()
+	}
+
+	producer := kafka.NewProducerFromClient(client)
+	defer producer.Close()
+
+	collector := stats.NewCollector()
+
+	workers := newProduceWorker(4, 10)
+	workers.Run(context.Background(), count, 0)
+
+	go func() {
+		for i := 0; i < count; i++ {
+			workers.AddJob(&produceMessage{
+				reqNum:      i,
+				sendTimeout: time.Second,
+				producer:    producer,
+				tmpl:        tmpl,
+				messageDesc: md,
+				stats:       collector,
+			})
+		}
+	}()
+
+	require.Nil(t, workers.Result())
+	require.EqualValues(t, count, workers.executed)
+
+	filename := filepath.Join(t.TempDir(), "stats.json")
+	require.Nil(t, reportProduceStats(collector, filename, io.Discard))
+
+	data, err := os.ReadFile(filename)
+	require.Nil(t, err)
+
+	report := stats.Report{}
+	require.Nil(t, json.Unmarshal(data, &report))
+	require.EqualValues(t, count, report.Messages)
+	require.Greater(t, report.LatencyMs.Max, float64(0))
+}
+
+type nopErrorReporter struct{}
+
+func (nopErrorReporter) Errorf(string, ...interface{}) {}
+
+func Test_produceWorker_Errors(t *testing.T) {
+	const count = 4
+
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	tmpl, err := parseProduceTemplate("test", "", nil, "", []byte(`{"name": "Alice"}`))
+	require.Nil(t, err)
+
+	run := func(maxErrors int) (*produceWorker, *stats.Collector, error) {
+		config := sarama.NewConfig()
+		config.Producer.Return.Successes = true
+
+		// unused expectations are reported on close, ignore them
+		client := mocks.NewAsyncProducer(nopErrorReporter{}, config)
+		client.ExpectInputAndSucceed()
+		client.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+		client.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+		client.ExpectInputAndSucceed()
+
+		producer := kafka.NewProducerFromClient(client)
+		defer producer.Close()
+
+		collector := stats.NewCollector()
+
+		workers := newProduceWorker(1, 1)
+		workers.SetMaxErrors(maxErrors)
+		workers.Run(context.Background(), count, 0)
+
+		go func() {
+			for i := 0; i < count; i++ {
+				if !workers.AddJob(&produceMessage{
+					reqNum:      i,
+					sendTimeout: time.Second,
+					producer:    producer,
+					tmpl:        tmpl,
+					messageDesc: md,
+					stats:       collector,
+				}) {
+					return
+				}
+			}
+		}()
+
+		return workers, collector, workers.Result()
+	}
+
+	// all messages are produced and errors are counted
+	workers, collector, err := run(0)
+	require.ErrorIs(t, err, sarama.ErrMessageSizeTooLarge)
+	require.Contains(t, err.Error(), "2 messages failed to produce")
+	require.EqualValues(t, 2, workers.executed)
+	require.EqualValues(t, 2, collector.Report().ErrorsCount())
+
+	// stopped at the first error
+	workers, _, err = run(1)
+	require.Equal(t, sarama.ErrMessageSizeTooLarge, err)
+	require.EqualValues(t, 1, workers.executed)
+}
+
+// fakeClock is a clock which time is advanced by sleeping, due functions are called before Sleep returns.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	f  func()
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Sleep(_ context.Context, d time.Duration) error {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+
+	var due []func()
+	timers := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			timers = append(timers, timer)
+		} else {
+			due = append(due, timer.f)
+		}
+	}
+	c.timers = timers
+	c.mu.Unlock()
+
+	for _, f := range due {
+		f()
+	}
+
+	return nil
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.timers = append(c.timers, fakeTimer{c.now.Add(d), f})
+
+	return func() bool { return false }
+}
+
+func Test_produceWorker_DurationAndRate(t *testing.T) {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	tmpl, err := parseProduceTemplate("test", "", nil, "", []byte(`{"name": "Alice"}`))
+	require.Nil(t, err)
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	// unused expectations are reported on close, ignore them
+	client := mocks.NewAsyncProducer(nopErrorReporter{}, config)
+	for i := 0; i < 100; i++ {
+		client.ExpectInputAndSucceed()
+	}
+
+	producer := kafka.NewProducerFromClient(client)
+	defer producer.Close()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	workers := newProduceWorker(1, 10)
+	workers.SetClock(clock)
+	workers.SetLimiter(ratelimit.NewLimiterWithClock(ratelimit.Rate{From: 50, To: 50}, 1, clock))
+	workers.Run(context.Background(), 0, 200*time.Millisecond)
+
+	go func() {
+		for workers.AddJob(&produceMessage{
+			sendTimeout: time.Second,
+			producer:    producer,
+			tmpl:        tmpl,
+			messageDesc: md,
+		}) {
+		}
+	}()
+
+	// a message is sent every 20ms: at 0ms, 20ms, ..., 180ms
+	require.Nil(t, workers.Result())
+	require.EqualValues(t, 10, workers.executed)
+}
+
+func Test_producerOptions_Idempotent(t *testing.T) {
+	cmd := NewProduceCmd()
+	bindProducerFlags(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{"--idempotent", "--compression", "gzip"}))
+
+	config := sarama.NewConfig()
+	require.NoError(t, applyProducerOptions(config, producerOptions()))
+
+	assert.True(t, config.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Equal(t, 1, config.Net.MaxOpenRequests)
+	assert.Equal(t, sarama.CompressionGZIP, config.Producer.Compression)
+
+	cmd = NewProduceCmd()
+	bindProducerFlags(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{"--idempotent", "--acks", "leader"}))
+
+	assert.ErrorIs(t, applyProducerOptions(sarama.NewConfig(), producerOptions()), kafka.ErrIdempotentAcks)
+}
+
+func Test_NewProduceCmd_AbortWithoutTransaction(t *testing.T) {
+	cmd := NewProduceCmd()
+	cmd.SetArgs([]string{"HelloRequest", "-t", "test", "--abort"})
+
+	_, _, err := getCommandOut(t, cmd)
+
+	assert.EqualError(t, err, "--abort requires --transactional-id")
+}
+
+func Test_produceMessage_BuildTombstone(t *testing.T) {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	tmpl, err := parseProduceTemplate("test", "k", nil, "", []byte(`{{if eq .RequestNumber 1}} null {{else}}{"name": "Alice"}{{end}}`))
+	require.Nil(t, err)
+
+	pm := &produceMessage{tmpl: tmpl, messageDesc: md}
+
+	s, err := pm.Build()
+	require.Nil(t, err)
+	assert.NotNil(t, s.message)
+	assert.NotNil(t, s.msg.Value)
+
+	// null data
+	pm.reqNum = 1
+	s, err = pm.Build()
+	require.Nil(t, err)
+	assert.Nil(t, s.message)
+	assert.Nil(t, s.msg.Value)
+	assert.Equal(t, 0, valueLength(s.msg))
+
+	// tombstone flag, template has no value
+	tmpl, err = parseProduceTemplate("test", "k", nil, "", nil)
+	require.Nil(t, err)
+
+	s, err = (&produceMessage{tmpl: tmpl}).Build()
+	require.Nil(t, err)
+	assert.Nil(t, s.msg.Value)
+}
+
+func Test_produceMessage_BuildTraceParent(t *testing.T) {
+	tracer, closer := jaeger.NewTracer(
+		"test", jaeger.NewConstSampler(true), jaeger.NewInMemoryReporter(),
+		jaeger.TracerOptions.Injector(opentracing.TextMap, tracing.W3CPropagator{}),
+	)
+	defer closer.Close()
+
+	parent, err := tracing.ParentSpanContext("", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	require.Nil(t, err)
+
+	tmpl, err := parseProduceTemplate("test", "k", nil, "", nil)
+	require.Nil(t, err)
+
+	s, err := (&produceMessage{
+		tmpl:         tmpl,
+		traceEnabled: true,
+		tracer:       tracer,
+		traceParent:  opentracing.ChildOf(parent),
+	}).Build()
+	require.Nil(t, err)
+	s.span.Finish()
+
+	require.Len(t, s.msg.Headers, 1)
+	assert.Equal(t, "traceparent", string(s.msg.Headers[0].Key))
+	assert.Regexp(t, "^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01$", string(s.msg.Headers[0].Value))
+}
+
+func Test_NewProduceCmd_TraceParent(t *testing.T) {
+	cmd := NewProduceCmd()
+	cmd.SetArgs([]string{"HelloRequest", "-t", "test", "--trace-id", "4bf92f3577b34da6a3ce929d0e0e4736"})
+
+	_, _, err := getCommandOut(t, cmd)
+
+	assert.EqualError(t, err, "trace ID requires parent span ID and vice versa")
+
+	cmd = NewProduceCmd()
+	cmd.SetArgs([]string{"HelloRequest", "--dry-run", "--trace-parent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+
+	_, _, err = getCommandOut(t, cmd)
+
+	assert.EqualError(t, err, "--dry-run can't be used with --duration, --trace or --transactional-id")
+}
+
+func Test_NewProduceCmd_TombstoneWithoutKey(t *testing.T) {
+	cmd := NewProduceCmd()
+	cmd.SetArgs([]string{"HelloRequest", "-t", "test", "--tombstone"})
+
+	_, _, err := getCommandOut(t, cmd)
+
+	assert.EqualError(t, err, "--tombstone requires --key")
+}
+
+func Test_murmur2(t *testing.T) {
+	// vectors of Utils.murmur2 from the Java client tests
+	tests := []struct {
+		key  string
+		want int32
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, murmur2([]byte(tt.key)), tt.key)
+	}
+}
+
+func Test_murmur2Partitioner(t *testing.T) {
+	tests := []struct {
+		key        string
+		partitions []int32 // for 3, 10 and 100 partitions
+	}{
+		{"21", []int32{0, 0, 40}},
+		{"foobar", []int32{0, 6, 66}},
+		{"a-little-bit-long-string", []int32{2, 2, 12}},
+		{"abc", []int32{0, 7, 7}},
+	}
+
+	p := newMurmur2Partitioner("test")
+	assert.True(t, p.RequiresConsistency())
+
+	for _, tt := range tests {
+		for i, n := range []int32{3, 10, 100} {
+			got, err := p.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(tt.key)}, n)
+			require.Nil(t, err)
+			assert.Equal(t, tt.partitions[i], got, "%s with %d partitions", tt.key, n)
+		}
+	}
+
+	// without key
+	got, err := p.Partition(&sarama.ProducerMessage{}, 3)
+	require.Nil(t, err)
+	assert.True(t, got >= 0 && got < 3)
+}
+
+func Test_newPartitioner(t *testing.T) {
+	for _, name := range partitionerValidValues {
+		constructor, err := newPartitioner(name, 2)
+		require.Nil(t, err, name)
+
+		got, err := constructor("test").Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("key")}, 3)
+		require.Nil(t, err, name)
+		assert.True(t, got >= 0 && got < 3, name)
+	}
+
+	_, err := newPartitioner(PartitionerManual, -1)
+	assert.Error(t, err)
+
+	_, err = newPartitioner("crc32", -1)
+	assert.Error(t, err)
+}
+
+func Test_produceTemplate_Execute(t *testing.T) {
+	tmpl, err := parseProduceTemplate(
+		"topic-{{.RequestNumber}}",
+		"{{.UUID}}",
+		[]string{"x-request-id={{.UUID}}", "x-num={{.RequestNumber}}", "invalid", "x-eq=a=b"},
+		`{{.TimestampUnixMilliAdd "-1h"}}`,
+		[]byte(`{"name": "{{.UUID}}"}`),
+	)
+	require.Nil(t, err)
+
+	cd := calldata.NewCallData(7)
+	msg, data, err := tmpl.Execute(cd)
+	require.Nil(t, err)
+
+	key, err := msg.Key.Encode()
+	require.Nil(t, err)
+
+	assert.Equal(t, "topic-7", msg.Topic)
+	assert.Equal(t, cd.UUID, string(key))
+	assert.Equal(t, []sarama.RecordHeader{
+		{Key: []byte("x-request-id"), Value: []byte(cd.UUID)},
+		{Key: []byte("x-num"), Value: []byte("7")},
+		{Key: []byte("x-eq"), Value: []byte("a=b")},
+	}, msg.Headers)
+	assert.Equal(t, `{"name": "`+cd.UUID+`"}`, string(data))
+	assert.Equal(t, cd.TimestampUnixMilli-3600000, msg.Timestamp.UnixNano()/1e6)
+
+	_, err = parseProduceTemplate("test", "{{", nil, "", nil)
+	assert.Error(t, err)
+}
+
+func Test_parseTimestamp(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"1600000000123", time.Unix(1600000000, 123000000), false},
+		{" 1600000000123\n", time.Unix(1600000000, 123000000), false},
+		{"2020-09-13T12:26:40Z", time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC), false},
+		{"2020-09-13T12:26:40.5+03:00", time.Date(2020, 9, 13, 9, 26, 40, 500000000, time.UTC), false},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, tt.value)
+			continue
+		}
+
+		require.Nil(t, err, tt.value)
+		assert.True(t, tt.want.Equal(got), "%s: %s", tt.value, got)
+	}
+}
+
+func Test_NewProduceCmd_DryRun(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "messages.bin")
+
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{
+		"produce",
+		"HelloRequest",
+		"--proto", "../internal/proto/testdata/example.proto",
+		"--count", "3",
+		"--print-bytes", "base64",
+		"--out", filename,
+		"-d", `{"name": "Alice", "age": {{.RequestNumber}}}`,
+	})
+
+	stdout, _, err := getCommandOut(t, cmd)
+
+	require.Nil(t, err)
+	assert.Contains(t, stdout, `{"name": "Alice", "age": 2}`)
+	assert.Contains(t, stdout, "CgVBbGljZRAC") // name: "Alice", age: 2
+
+	f, err := os.Open(filename)
+	require.Nil(t, err)
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for i := 0; i < 3; i++ {
+		data, err := proto.ReadDelimited(r)
+		require.Nil(t, err)
+		want := []byte{0x0a, 0x05, 'A', 'l', 'i', 'c', 'e'}
+		if i > 0 { // zero age is not encoded
+			want = append(want, 0x10, byte(i))
+		}
+		assert.Equal(t, want, data)
+	}
+
+	_, err = proto.ReadDelimited(r)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func Test_NewProduceCmd_DryRun_WriteError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full is not available")
+	}
+
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{
+		"produce",
+		"HelloRequest",
+		"--proto", "../internal/proto/testdata/example.proto",
+		"--out", "/dev/full",
+		"-d", `{"name": "Alice"}`,
+	})
+
+	_, _, err := getCommandOut(t, cmd)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "write /dev/full")
+}
+
+func Test_NewProduceCmd_InputFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		data   string
+	}{
+		{"yaml", "name: Alice\nage: 30"},
+		{"prototext", `name: "Alice" age: 30`},
+		{"binary", "\x0a\x05Alice\x10\x1e"},
+		{"base64", "CgVBbGljZRAe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "messages.bin")
+
+			cmd := NewRootCmd()
+			cmd.SetArgs([]string{
+				"produce",
+				"HelloRequest",
+				"--proto", "../internal/proto/testdata/example.proto",
+				"--input-format", tt.format,
+				"--out", filename,
+				"-d", tt.data,
+			})
+
+			_, _, err := getCommandOut(t, cmd)
+			require.Nil(t, err)
+
+			data, err := os.ReadFile(filename)
+			require.Nil(t, err)
+			assert.Equal(t, []byte("\x09\x0a\x05Alice\x10\x1e"), data)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		cmd := NewRootCmd()
+		cmd.SetArgs([]string{"produce", "HelloRequest", "--dry-run", "--input-format", "xml", "-d", "{}"})
+
+		_, _, err := getCommandOut(t, cmd)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown format "xml"`)
+	})
+}
@@ -0,0 +1,434 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/kuper-tech/protokaf/internal/utils/sink"
+	"github.com/kuper-tech/protokaf/internal/utils/stats"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// ReplayPartitionPreserve is a value of partition to produce records to their original partitions.
+	ReplayPartitionPreserve = "preserve"
+
+	// ReplayPartitionRehash is a value of partition to choose partitions with --partitioner.
+	ReplayPartitionRehash = "rehash"
+)
+
+// ErrNoRecords is an error of replaying no records.
+var ErrNoRecords = errors.New("no records to replay")
+
+func NewReplayCmd() *cobra.Command {
+	var (
+		speedFlag             string
+		topicMapFlag          []string
+		partitionFlag         string
+		rewriteTimestampsFlag bool
+		timeoutFlag           time.Duration
+
+		speed    float64
+		topicMap map[string]string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "replay <file | dir>...",
+		Short: "Produce records captured by consume with --output record, keeping their timing",
+		Args:  cobra.MinimumNArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			bindProducerFlags(cmd.Flags())
+
+			if speed, err = parseSpeed(speedFlag); err != nil {
+				return
+			}
+
+			if topicMap, err = parseTopicMap(topicMapFlag); err != nil {
+				return
+			}
+
+			switch partitionFlag {
+			case ReplayPartitionPreserve, ReplayPartitionRehash:
+			default:
+				return fmt.Errorf(
+					"partition flag has invalid value: %s, use one of %s, %s",
+					partitionFlag, ReplayPartitionPreserve, ReplayPartitionRehash,
+				)
+			}
+
+			return
+		},
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			records, err := readRecordFiles(args)
+			if err != nil {
+				return
+			}
+
+			if len(records) == 0 {
+				log.Info("No records to replay")
+				return
+			}
+
+			if partitionFlag == ReplayPartitionPreserve {
+				kafkaConfig.Producer.Partitioner = sarama.NewManualPartitioner
+			} else if kafkaConfig.Producer.Partitioner, err = newPartitioner(viper.GetString("partitioner"), -1); err != nil {
+				return
+			}
+
+			err = applyProducerOptions(kafkaConfig, replayProducerOptions())
+			if err != nil {
+				return
+			}
+
+			producer, err := kafka.NewProducer(viper.GetStringSlice("broker"), kafkaConfig)
+			if err != nil {
+				return
+			}
+			defer closeProducer(producer, &err)
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			log.Infof("Replaying %d records...", len(records))
+
+			collector := stats.NewCollector()
+			r := &replayer{
+				producer:          producer,
+				speed:             speed,
+				topicMap:          topicMap,
+				rewriteTimestamps: rewriteTimestampsFlag,
+				timeout:           timeoutFlag,
+				stats:             collector,
+			}
+
+			err = r.Replay(ctx, records)
+			if reportErr := reportProduceStats(collector, "", cmd.OutOrStdout()); err == nil {
+				err = reportErr
+			}
+
+			return
+		},
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVar(&speedFlag, "speed", "1x", `Scale gaps between records, e.g. "10x" replays 10 times faster`)
+	flags.StringArrayVar(&topicMapFlag, "topic-map", []string{}, "Produce records of src topic to dst topic: src=dst (may be specified multiple times)")
+	flags.StringVar(&partitionFlag, "partition", ReplayPartitionPreserve, fmt.Sprintf(
+		"Partitions of records: %s (original partitions), %s (choose by key with --partitioner)",
+		ReplayPartitionPreserve, ReplayPartitionRehash,
+	))
+	flags.BoolVar(&rewriteTimestampsFlag, "rewrite-timestamps", false, "Set timestamps of records relative to the start of replay")
+	flags.DurationVar(&timeoutFlag, "timeout", 60*time.Second, "Timeout of producing a record")
+
+	setProducerFlags(flags)
+
+	return cmd
+}
+
+// parseSpeed parses speed like "10x", "0.5x" or "2".
+func parseSpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("speed flag has invalid value: %s, use a positive number, e.g. 10x", s)
+	}
+
+	return speed, nil
+}
+
+// parseTopicMap parses src=dst pairs.
+func parseTopicMap(pairs []string) (map[string]string, error) {
+	m := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("topic-map flag has invalid value: %s, use src=dst", p)
+		}
+
+		m[parts[0]] = parts[1]
+	}
+
+	return m, nil
+}
+
+// replayProducerOptions returns producer options keeping order of records of every partition:
+// a retried request may be written after the following ones if several requests are in flight,
+// so max open requests of flags and config is overridden.
+func replayProducerOptions() kafka.ProducerOptions {
+	o := producerOptions()
+	if o.MaxOpenRequests != 1 {
+		log.Debugf("Max open requests %d is set to 1 to keep order of records", o.MaxOpenRequests)
+		o.MaxOpenRequests = 1
+	}
+
+	return o
+}
+
+// readRecordFiles reads records of files, files of directories are read in order of their manifests.
+func readRecordFiles(paths []string) ([]kafka.Record, error) {
+	var records []kafka.Record
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		files := []string{path}
+		if info.IsDir() {
+			manifest, err := sink.ReadManifest(path)
+			if err != nil {
+				return nil, err
+			}
+
+			files = files[:0]
+			for _, f := range manifest.Files {
+				files = append(files, filepath.Join(path, f.File))
+			}
+		}
+
+		for _, filename := range files {
+			log.Debugf("Read records from %s", filename)
+
+			if records, err = readRecordFile(filename, records); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// readRecordFile appends records of the file in JSON lines,
+// errors of lines are reported with the file name and the line number.
+func readRecordFile(filename string, records []kafka.Record) ([]kafka.Record, error) {
+	f, err := sink.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+		}
+
+		if len(strings.TrimSpace(string(data))) > 0 {
+			var rec kafka.Record
+			if err := json.Unmarshal(data, &rec); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+			}
+
+			if err := validateRecord(rec); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", filename, line, err)
+			}
+
+			records = append(records, rec)
+		}
+
+		if err != nil {
+			return records, nil
+		}
+	}
+}
+
+// validateRecord returns ErrInvalidRecord if the record has no topic or neither key nor value,
+// e.g. the line isn't a record of record output.
+func validateRecord(rec kafka.Record) error {
+	if rec.Topic == "" {
+		return fmt.Errorf("%w: no topic", ErrInvalidRecord)
+	}
+
+	if rec.Key == nil && rec.Value == nil {
+		return fmt.Errorf("%w: no key and value", ErrInvalidRecord)
+	}
+
+	return nil
+}
+
+// replayer produces records with the original gaps between timestamps scaled by speed.
+type replayer struct {
+	producer          *kafka.Producer
+	speed             float64
+	topicMap          map[string]string
+	rewriteTimestamps bool
+	timeout           time.Duration
+	stats             *stats.Collector
+
+	// sleep waits until the time, it's replaced in tests
+	sleep func(ctx context.Context, t time.Time) error
+}
+
+// Replay produces records in order of timestamps keeping order of records of every partition,
+// it waits for results of all records. Records are passed to producer in order and their results
+// are waited asynchronously, an error is returned if any record failed.
+func (r *replayer) Replay(ctx context.Context, records []kafka.Record) error {
+	sleep := r.sleep
+	if sleep == nil {
+		sleep = sleepUntil
+	}
+
+	ordered, err := mergeRecords(records)
+	if err != nil {
+		return err
+	}
+
+	var (
+		start   = time.Now()
+		first   = ordered[0].Timestamp
+		results = make(chan error, len(ordered))
+		sent    int
+	)
+
+	for _, rec := range ordered {
+		at := start.Add(time.Duration(float64(rec.Timestamp.Sub(first)) / r.speed))
+		if err = sleep(ctx, at); err != nil {
+			break
+		}
+
+		msg := rec.ProducerMessage()
+		if topic, ok := r.topicMap[rec.Topic]; ok {
+			msg.Topic = topic
+		}
+
+		if r.rewriteTimestamps {
+			msg.Timestamp = at
+		}
+
+		sent++
+		r.send(ctx, msg, results)
+	}
+
+	var (
+		failed   int
+		firstErr error
+	)
+
+	for i := 0; i < sent; i++ {
+		if sendErr := <-results; sendErr != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = sendErr
+			}
+		}
+	}
+
+	if errors.Is(err, context.Canceled) {
+		log.Infof("Replay is interrupted after %d of %d records", sent, len(ordered))
+		err = nil
+	}
+
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d of %d records failed to replay, first error: %w", failed, sent, firstErr)
+	}
+
+	return err
+}
+
+// send passes the message to producer and waits for the result in a new goroutine.
+func (r *replayer) send(ctx context.Context, msg *sarama.ProducerMessage, results chan<- error) {
+	sendCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	sentAt := time.Now()
+	result := r.producer.Send(sendCtx, msg)
+
+	go func() {
+		defer cancel()
+
+		var err error
+		select {
+		case err = <-result:
+		case <-sendCtx.Done():
+			err = sendCtx.Err()
+		}
+
+		if err != nil {
+			log.Debugf("Failed to replay record to %s: %s", msg.Topic, err)
+			r.stats.Error(err)
+		} else {
+			r.stats.Success(valueLength(msg), time.Since(sentAt))
+		}
+
+		results <- err
+	}()
+}
+
+// mergeRecords orders records by timestamps, records of every topic partition stay in the original order.
+// ErrNoRecords is returned if there are no records.
+func mergeRecords(records []kafka.Record) ([]kafka.Record, error) {
+	if len(records) == 0 {
+		return nil, ErrNoRecords
+	}
+
+	type topicPartition struct {
+		topic     string
+		partition int32
+	}
+
+	var (
+		keys       []topicPartition
+		partitions = make(map[topicPartition][]kafka.Record)
+	)
+
+	for _, rec := range records {
+		tp := topicPartition{rec.Topic, rec.Partition}
+		if _, ok := partitions[tp]; !ok {
+			keys = append(keys, tp)
+		}
+
+		partitions[tp] = append(partitions[tp], rec)
+	}
+
+	ordered := make([]kafka.Record, 0, len(records))
+	for len(ordered) < len(records) {
+		next := -1
+		for i, tp := range keys {
+			p := partitions[tp]
+			if len(p) == 0 {
+				continue
+			}
+
+			if next < 0 || p[0].Timestamp.Before(partitions[keys[next]][0].Timestamp) {
+				next = i
+			}
+		}
+
+		tp := keys[next]
+		ordered = append(ordered, partitions[tp][0])
+		partitions[tp] = partitions[tp][1:]
+	}
+
+	return ordered, nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
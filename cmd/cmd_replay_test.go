@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/kuper-tech/protokaf/internal/utils/sink"
+	"github.com/kuper-tech/protokaf/internal/utils/stats"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_replayer_Replay(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []kafka.Record{
+		{Topic: "src", Partition: 0, Offset: 1, Timestamp: start, Key: []byte("a"), Value: []byte("1")},
+		{Topic: "src", Partition: 0, Offset: 2, Timestamp: start.Add(10 * time.Second), Key: []byte("b"), Value: []byte("2")},
+		{Topic: "src", Partition: 1, Offset: 5, Timestamp: start.Add(5 * time.Second), Key: []byte("c")},
+		{Topic: "other", Partition: 3, Offset: 7, Timestamp: start.Add(20 * time.Second), Value: []byte("4")},
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = sarama.NewManualPartitioner
+
+	client := mocks.NewAsyncProducer(t, config)
+	var produced []*sarama.ProducerMessage
+	for i := 0; i < len(records); i++ {
+		client.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			produced = append(produced, msg)
+			return nil
+		})
+	}
+
+	producer := kafka.NewProducerFromClient(client)
+	defer producer.Close()
+
+	var gaps []time.Duration
+	r := &replayer{
+		producer:          producer,
+		speed:             10,
+		topicMap:          map[string]string{"src": "dst"},
+		rewriteTimestamps: true,
+		timeout:           time.Second,
+		stats:             stats.NewCollector(),
+	}
+
+	var replayStart time.Time
+	r.sleep = func(ctx context.Context, at time.Time) error {
+		if replayStart.IsZero() {
+			replayStart = at
+		}
+
+		gaps = append(gaps, at.Sub(replayStart))
+
+		return nil
+	}
+
+	require.Nil(t, r.Replay(context.Background(), records))
+	assert.Equal(t, []time.Duration{0, 500 * time.Millisecond, time.Second, 2 * time.Second}, gaps)
+
+	require.Len(t, produced, 4)
+	assert.Equal(t, []string{"dst", "dst", "dst", "other"}, []string{
+		produced[0].Topic, produced[1].Topic, produced[2].Topic, produced[3].Topic,
+	})
+	assert.Equal(t, []int32{0, 1, 0, 3}, []int32{
+		produced[0].Partition, produced[1].Partition, produced[2].Partition, produced[3].Partition,
+	})
+	assert.Nil(t, produced[1].Value)
+	assert.Equal(t, replayStart.Add(time.Second), produced[2].Timestamp)
+	assert.EqualValues(t, 4, r.stats.Report().Messages)
+}
+
+func Test_replayer_Replay_Failed(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []kafka.Record{
+		{Topic: "src", Offset: 1, Timestamp: start, Value: []byte("1")},
+		{Topic: "src", Offset: 2, Timestamp: start, Value: []byte("2")},
+		{Topic: "src", Offset: 3, Timestamp: start, Value: []byte("3")},
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Partitioner = sarama.NewManualPartitioner
+
+	client := mocks.NewAsyncProducer(t, config)
+	client.ExpectInputAndSucceed()
+	client.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+	client.ExpectInputAndSucceed()
+
+	producer := kafka.NewProducerFromClient(client)
+	defer producer.Close()
+
+	r := &replayer{
+		producer: producer,
+		speed:    1,
+		timeout:  time.Second,
+		stats:    stats.NewCollector(),
+		sleep:    func(context.Context, time.Time) error { return nil },
+	}
+
+	err := r.Replay(context.Background(), records)
+	require.ErrorIs(t, err, sarama.ErrMessageSizeTooLarge)
+	assert.Contains(t, err.Error(), "1 of 3 records failed to replay")
+	assert.EqualValues(t, 2, r.stats.Report().Messages)
+}
+
+func Test_mergeRecords_PartitionOrder(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	records := []kafka.Record{
+		{Partition: 0, Offset: 1, Timestamp: start.Add(2 * time.Second)},
+		{Partition: 0, Offset: 2, Timestamp: start},
+		{Partition: 1, Offset: 1, Timestamp: start.Add(time.Second)},
+	}
+
+	ordered, err := mergeRecords(records)
+	require.Nil(t, err)
+	assert.Equal(t, []int64{1, 1, 2}, []int64{ordered[0].Offset, ordered[1].Offset, ordered[2].Offset})
+	assert.Equal(t, int32(1), ordered[0].Partition)
+}
+
+func Test_mergeRecords_Empty(t *testing.T) {
+	_, err := mergeRecords(nil)
+	assert.ErrorIs(t, err, ErrNoRecords)
+
+	r := &replayer{}
+	assert.ErrorIs(t, r.Replay(context.Background(), nil), ErrNoRecords)
+}
+
+func Test_replayProducerOptions(t *testing.T) {
+	cmd := NewReplayCmd()
+	bindProducerFlags(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{"--max-open-requests", "5", "--retries", "10"}))
+
+	config := sarama.NewConfig()
+	require.NoError(t, applyProducerOptions(config, replayProducerOptions()))
+
+	// retried requests can't be reordered with one open request
+	assert.Equal(t, 1, config.Net.MaxOpenRequests)
+	assert.Equal(t, 10, config.Producer.Retry.Max)
+	require.NoError(t, config.Validate())
+
+	// idempotent producer keeps acks=all
+	cmd = NewReplayCmd()
+	bindProducerFlags(cmd.Flags())
+	require.NoError(t, cmd.Flags().Parse([]string{"--idempotent"}))
+
+	config = sarama.NewConfig()
+	config.Version = sarama.V0_11_0_0
+	require.NoError(t, applyProducerOptions(config, replayProducerOptions()))
+	assert.Equal(t, 1, config.Net.MaxOpenRequests)
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+}
+
+func Test_readRecordFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"json", "{\"topic\": \"test\", \"value\": \"AA==\"}\n{\n", ":2: unexpected end of JSON input"},
+		{"no topic", "{\"partition\": 1, \"value\": \"AA==\"}\n", ":1: invalid record: no topic"},
+		{"no key and value", "\n{\"topic\": \"test\"}\n", ":2: invalid record: no key and value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "records.jsonl")
+			require.Nil(t, os.WriteFile(filename, []byte(tt.data), 0o644))
+
+			_, err := readRecordFiles([]string{filename})
+			assert.EqualError(t, err, filename+tt.err)
+		})
+	}
+
+	// tombstones have a key
+	filename := filepath.Join(t.TempDir(), "records.jsonl")
+	require.Nil(t, os.WriteFile(filename, []byte(`{"topic": "test", "key": "AA==", "value": null}`), 0o644))
+
+	records, err := readRecordFiles([]string{filename})
+	require.Nil(t, err)
+	require.Len(t, records, 1)
+	assert.Nil(t, records[0].Value)
+}
+
+func Test_readRecordFiles(t *testing.T) {
+	viper.Set("output", DecodeFlagRecordValue)
+	defer viper.Set("output", nil)
+
+	dir := t.TempDir()
+	s, err := newFileSink(sink.Options{Dir: dir, Compression: sink.CompressionGzip, RotateSize: 100})
+	require.Nil(t, err)
+
+	for offset := int64(0); offset < 3; offset++ {
+		rec := &sarama.ConsumerMessage{
+			Topic:     "test",
+			Offset:    offset,
+			Timestamp: time.Unix(offset, 0).UTC(),
+			Key:       []byte("key"),
+			Headers:   []*sarama.RecordHeader{{Key: []byte("h"), Value: []byte("v")}},
+			Value:     []byte{0x0a, 0x01, 'A'},
+		}
+		require.Nil(t, s.Write(kafka.NewRecordFromConsumerMessage(rec), nil))
+	}
+	require.Nil(t, s.Close())
+
+	records, err := readRecordFiles([]string{dir})
+	require.Nil(t, err)
+	require.Len(t, records, 3)
+
+	assert.Equal(t, kafka.Record{
+		Topic:     "test",
+		Offset:    2,
+		Timestamp: time.Unix(2, 0).UTC(),
+		Key:       []byte("key"),
+		Headers:   []kafka.RecordHeader{{Key: "h", Value: []byte("v")}},
+		Value:     []byte{0x0a, 0x01, 'A'},
+	}, records[2])
+}
+
+func Test_parseSpeed(t *testing.T) {
+	for s, want := range map[string]float64{"10x": 10, "0.5x": 0.5, "2": 2} {
+		got, err := parseSpeed(s)
+		require.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	for _, s := range []string{"0x", "-1", "fast"} {
+		_, err := parseSpeed(s)
+		assert.Error(t, err)
+	}
+}
@@ -53,8 +53,18 @@ func NewRootCmd() *cobra.Command {
 				return
 			}
 
+			// messages in stream output are written to stdout, logs must not mix with them
+			output := viper.GetString("output")
+			logOut := cmd.OutOrStdout()
+			if isStreamOutput(output) {
+				logOut = cmd.ErrOrStderr()
+				setLogger(logOut, logInfoLevel, appName)
+			}
+
+			messages = newMessageWriter(cmd.OutOrStdout(), output, jsonOptions())
+
 			if viper.GetBool("debug") {
-				setLogger(cmd.OutOrStdout(), "debug", cmd.CalledAs())
+				setLogger(logOut, "debug", cmd.CalledAs())
 				log.Info("Debugging enabled")
 
 				sarama.Logger = zap.NewStdLog(zapLog.Named("kafka"))
@@ -64,7 +74,9 @@ func NewRootCmd() *cobra.Command {
 				log.Debugf("Using config file: %s", configFiles)
 			}
 
-			kafkaConfig, err = kafka.NewConfig(appName, viper.GetString("kafka-auth-dsn"))
+			kafkaConfig, err = kafka.NewConfig(
+				appName, viper.GetString("kafka-auth-dsn"), viper.GetString("kafka-version"),
+			)
 			if err != nil {
 				return
 			}
@@ -84,8 +96,15 @@ func NewRootCmd() *cobra.Command {
 	cmd.AddCommand(
 		NewProduceCmd(),
 		NewConsumeCmd(),
+		NewReplayCmd(),
+		NewMirrorCmd(),
+		NewLagCmd(),
 		NewListCmd(),
 		NewBuildCmd(),
+		NewMessagesCmd(),
+		NewDescribeCmd(),
+		NewCompatCmd(),
+		NewValidateCmd(),
 	)
 
 	return cmd
@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Shopify/sarama"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const validateFailuresLimit = 10
+
+// partitionIdleTimeout is a time without records after which a partition fetched up to the end is read.
+var partitionIdleTimeout = 2 * time.Second
+
+func NewValidateCmd() *cobra.Command { //nolint:funlen
+	var (
+		topicFlag      string
+		sampleFlag     int
+		exitAtEndFlag  bool
+		offsetFlag     string
+		failuresFlag   int
+		startingOffset int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "validate <MessageName>",
+		Short: "Validate topic records against proto message",
+		Args:  messageNameRequired,
+		PreRunE: func(cmd *cobra.Command, args []string) (err error) {
+			if sampleFlag < 1 && !exitAtEndFlag {
+				return errors.New("one of --sample or --exit-at-end flags is required")
+			}
+
+			startingOffset, err = parseOffsetFlag(offsetFlag)
+			if errors.Is(err, ErrOffsetNotSet) {
+				startingOffset, err = sarama.OffsetOldest, nil
+			}
+
+			return
+		},
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			// parse protofiles & create proto object
+			p, err := parseProtofiles()
+			if err != nil {
+				return
+			}
+
+			// find message descriptor
+			md, err := findMessage(p, args[0])
+			if err != nil {
+				return
+			}
+
+			client, err := sarama.NewClient(viper.GetStringSlice("broker"), kafkaConfig)
+			if err != nil {
+				return
+			}
+			defer client.Close()
+
+			ctx, cancel := context.WithCancel(cmd.Context())
+			defer cancel()
+
+			records, err := consumePartitions(ctx, client, topicFlag, startingOffset, exitAtEndFlag)
+			if err != nil {
+				return
+			}
+
+			log.Infof("Validating records of topic %q with %s...", topicFlag, md.GetFullyQualifiedName())
+
+			report := newValidationReport(failuresFlag)
+			f := dynamic.NewMessageFactoryWithDefaults()
+
+			for msg := range records {
+				report.Add(msg, md, f)
+
+				if sampleFlag > 0 && report.total == sampleFlag {
+					cancel()
+					break
+				}
+			}
+
+			report.Print()
+
+			if report.failed > 0 {
+				return fmt.Errorf("%d of %d records failed validation", report.failed, report.total)
+			}
+
+			return
+		},
+	}
+
+	flags := cmd.Flags()
+
+	flags.StringVarP(&topicFlag, "topic", "t", "", "Topic to validate")
+	flags.IntVar(&sampleFlag, "sample", 0, "Exit after validating this number of records")
+	flags.BoolVar(&exitAtEndFlag, "exit-at-end", false, "Exit after reaching the end of partitions")
+	flags.StringVarP(&offsetFlag, "offset", "o", "", "Start validating from this offset (default: oldest)")
+	flags.IntVar(&failuresFlag, "failures", validateFailuresLimit, "Number of first failures to print")
+
+	_ = cmd.MarkFlagRequired("topic")
+
+	return cmd
+}
+
+// consumePartitions reads records of topic partitions to the returned channel.
+// If untilEnd is set, every partition is read up to its newest offset at the start.
+// The channel is closed when all partitions are read or ctx is done.
+func consumePartitions(
+	ctx context.Context, client sarama.Client, topic string, offset int64, untilEnd bool,
+) (<-chan *sarama.ConsumerMessage, error) {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	if p := flags.Partition; p >= 0 {
+		partitions = []int32{p}
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(chan *sarama.ConsumerMessage)
+	wg := sync.WaitGroup{}
+
+	fail := func(err error) (<-chan *sarama.ConsumerMessage, error) {
+		consumer.Close()
+		return nil, err
+	}
+
+	for _, partition := range partitions {
+		end, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return fail(err)
+		}
+
+		start := offset
+		if start < 0 {
+			if start, err = client.GetOffset(topic, partition, offset); err != nil {
+				return fail(err)
+			}
+		}
+
+		if untilEnd && start >= end {
+			log.Debugf("Partition %d has no records to read", partition)
+			continue
+		}
+
+		pc, err := consumer.ConsumePartition(topic, partition, start)
+		if err != nil {
+			return fail(err)
+		}
+
+		wg.Add(1)
+		go func(partition int32, pc sarama.PartitionConsumer, end int64) {
+			defer wg.Done()
+			defer pc.AsyncClose()
+
+			// offsets before the end may have no records: control markers of transactions
+			// or compacted records, so the partition is read once it's idle after being fetched up to the end
+			idle := time.NewTicker(partitionIdleTimeout)
+			defer idle.Stop()
+
+			received := false
+
+			for {
+				select {
+				case msg := <-pc.Messages():
+					received = true
+
+					select {
+					case records <- msg:
+					case <-ctx.Done():
+						return
+					}
+
+					if untilEnd && msg.Offset+1 >= end {
+						log.Debugf("Partition %d is read up to offset %d", partition, msg.Offset)
+						return
+					}
+
+				case err := <-pc.Errors():
+					log.Errorf("Partition %d consume error: %s", partition, err)
+
+				case <-idle.C:
+					if untilEnd && !received && pc.HighWaterMarkOffset() >= end {
+						log.Debugf("Partition %d has no more records before offset %d", partition, end)
+						return
+					}
+
+					received = false
+
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(partition, pc, end)
+	}
+
+	go func() {
+		wg.Wait()
+		close(records)
+		consumer.Close()
+	}()
+
+	return records, nil
+}
+
+type validationFailure struct {
+	partition int32
+	offset    int64
+	reason    string
+}
+
+type validationReport struct {
+	total, failed, unknown int
+
+	maxFailures int
+	failures    []validationFailure
+	unknowns    []validationFailure
+}
+
+func newValidationReport(maxFailures int) *validationReport {
+	return &validationReport{maxFailures: maxFailures}
+}
+
+// Add decodes record and counts the result. Records failing to decode or having
+// string fields with invalid UTF-8 fail, records with unknown fields are counted separately.
+func (r *validationReport) Add(msg *sarama.ConsumerMessage, md *desc.MessageDescriptor, f *dynamic.MessageFactory) {
+	r.total++
+
+	m, err := decodeMessage(f, md, msg.Value)
+	if err == nil {
+		if fields := invalidUTF8Fields(m); len(fields) > 0 {
+			err = fmt.Errorf("invalid UTF-8 in string fields %v", fields)
+		}
+	}
+
+	if err != nil {
+		r.failed++
+
+		if len(r.failures) < r.maxFailures {
+			r.failures = append(r.failures, validationFailure{msg.Partition, msg.Offset, err.Error()})
+		}
+
+		return
+	}
+
+	if fields := unknownFields(m); len(fields) > 0 {
+		r.unknown++
+
+		if len(r.unknowns) < r.maxFailures {
+			r.unknowns = append(r.unknowns, validationFailure{
+				msg.Partition, msg.Offset, fmt.Sprintf("unknown fields %v", fields),
+			})
+		}
+	}
+}
+
+// Print prints the report with logger.
+func (r *validationReport) Print() {
+	log.Infof(
+		"Validated %d records: %d failed (%s), %d with unknown fields (%s)",
+		r.total, r.failed, percent(r.failed, r.total), r.unknown, percent(r.unknown, r.total),
+	)
+
+	for _, list := range []struct {
+		title    string
+		failures []validationFailure
+	}{
+		{"First failures:", r.failures},
+		{"First records with unknown fields:", r.unknowns},
+	} {
+		if len(list.failures) == 0 {
+			continue
+		}
+
+		log.Info(list.title)
+		for _, f := range list.failures {
+			log.Infof("  partition %d, offset %d: %s", f.partition, f.offset, f.reason)
+		}
+	}
+}
+
+// unknownFields returns paths of unknown fields in message and nested messages.
+func unknownFields(m *dynamic.Message) []string {
+	var result []string
+
+	walkMessages(m, func(m *dynamic.Message) {
+		for _, n := range m.GetUnknownFields() {
+			result = append(result, fmt.Sprintf("%s.%d", m.GetMessageDescriptor().GetFullyQualifiedName(), n))
+		}
+	})
+
+	return result
+}
+
+// invalidUTF8Fields returns names of string fields with invalid UTF-8 in message and nested messages.
+func invalidUTF8Fields(m *dynamic.Message) []string {
+	var result []string
+
+	walkMessages(m, func(m *dynamic.Message) {
+		for _, fd := range m.GetKnownFields() {
+			if !validUTF8(fd, m.GetField(fd)) {
+				result = append(result, fd.GetFullyQualifiedName())
+			}
+		}
+	})
+
+	return result
+}
+
+// validUTF8 reports whether strings of the field value are valid UTF-8.
+func validUTF8(fd *desc.FieldDescriptor, value interface{}) bool {
+	isString := func(fd *desc.FieldDescriptor) bool {
+		return fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING
+	}
+
+	valid := func(v interface{}) bool {
+		s, ok := v.(string)
+		return !ok || utf8.ValidString(s)
+	}
+
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			if isString(fd.GetMapKeyType()) && !valid(key) || isString(fd.GetMapValueType()) && !valid(item) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if isString(fd) && !valid(item) {
+				return false
+			}
+		}
+	default:
+		return !isString(fd) || valid(v)
+	}
+
+	return true
+}
+
+// walkMessages calls fn for message and nested messages.
+func walkMessages(m *dynamic.Message, fn func(*dynamic.Message)) {
+	fn(m)
+
+	nested := func(v interface{}) {
+		if nm, ok := v.(*dynamic.Message); ok && nm != nil {
+			walkMessages(nm, fn)
+		}
+	}
+
+	for _, fd := range m.GetKnownFields() {
+		switch v := m.GetField(fd).(type) {
+		case []interface{}:
+			for _, item := range v {
+				nested(item)
+			}
+		case map[interface{}]interface{}:
+			for k, item := range v {
+				nested(k)
+				nested(item)
+			}
+		default:
+			nested(v)
+		}
+	}
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "0.00%"
+	}
+
+	return fmt.Sprintf("%.2f%%", float64(n)*100/float64(total))
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewValidateCmd_NoLimitFlags(t *testing.T) {
+	cmd := NewValidateCmd()
+	cmd.SetArgs([]string{"HelloRequest", "--topic", "test"})
+
+	_, _, err := getCommandOut(t, cmd)
+
+	require.EqualError(t, err, "one of --sample or --exit-at-end flags is required")
+}
+
+func Test_validationReport(t *testing.T) {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	report := newValidationReport(1)
+	f := dynamic.NewMessageFactoryWithDefaults()
+
+	for i, value := range [][]byte{
+		{0x0a, 0x05, 'A', 'l', 'i', 'c', 'e', 0x10, 0x0b}, // name: "Alice", age: 11
+		{0x0a, 0x05, 'A', 'l', 'i', 'c', 'e', 0x28, 0x01}, // unknown field 5
+		{0x0a, 0x10, 'A'},                                  // truncated
+		{0xff, 0xff},                                       // invalid tag
+	} {
+		report.Add(&sarama.ConsumerMessage{Partition: 0, Offset: int64(i), Value: value}, md, f)
+	}
+
+	require.Equal(t, 4, report.total)
+	require.Equal(t, 2, report.failed)
+	require.Equal(t, 1, report.unknown)
+	require.Len(t, report.failures, 1)
+	require.EqualValues(t, 2, report.failures[0].offset)
+	require.Equal(t, "unknown fields [example.HelloRequest.5]", report.unknowns[0].reason)
+	require.Equal(t, "50.00%", percent(report.failed, report.total))
+}
+
+func Test_consumePartitions_UntilEndWithoutTailRecords(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	// offset 2 is the end of the partition without a record, e.g. a commit marker
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("test", 0, sarama.OffsetNewest, 3).
+			SetOffset("test", 0, sarama.OffsetOldest, 0),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).SetVersion(4).
+			SetMessage("test", 0, 0, sarama.StringEncoder("a")).
+			SetMessage("test", 0, 1, sarama.StringEncoder("b")).
+			SetHighWaterMark("test", 0, 3),
+	})
+
+	defer func(f *Flags, timeout time.Duration) { flags, partitionIdleTimeout = f, timeout }(flags, partitionIdleTimeout)
+	flags, partitionIdleTimeout = &Flags{Partition: -1}, 100*time.Millisecond
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V1_0_0_0
+
+	client, err := sarama.NewClient([]string{broker.Addr()}, config)
+	require.Nil(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records, err := consumePartitions(ctx, client, "test", sarama.OffsetOldest, true)
+	require.Nil(t, err)
+
+	var offsets []int64
+	for msg := range records {
+		offsets = append(offsets, msg.Offset)
+	}
+
+	require.Nil(t, ctx.Err(), "partition isn't read up to the end")
+	require.Equal(t, []int64{0, 1}, offsets)
+}
+
+func Test_validationReport_InvalidUTF8(t *testing.T) {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	report := newValidationReport(1)
+	report.Add(&sarama.ConsumerMessage{Value: []byte{0x0a, 0x02, 0xc3, 0x28}}, md, dynamic.NewMessageFactoryWithDefaults())
+
+	require.Equal(t, 1, report.failed)
+	require.Equal(t, "invalid UTF-8 in string fields [example.HelloRequest.name]", report.failures[0].reason)
+}
@@ -15,11 +15,35 @@ const (
 
 	// DecodeFlagJSONValue is a value of output in json format.
 	DecodeFlagJSONValue = "json"
+
+	// DecodeFlagJSONLValue is a value of output in compact json, one message per line.
+	DecodeFlagJSONLValue = "jsonl"
+
+	// DecodeFlagPrototextCompactValue is a value of output in protobuf text format, one message per line.
+	DecodeFlagPrototextCompactValue = "prototext-compact"
+
+	// DecodeFlagHexValue is a value of output of encoded messages in hex, one message per line.
+	DecodeFlagHexValue = "hex"
+
+	// DecodeFlagBase64Value is a value of output of encoded messages in base64, one message per line.
+	DecodeFlagBase64Value = "base64"
+
+	// DecodeFlagRawValue is a value of output of encoded messages as length-delimited stream.
+	DecodeFlagRawValue = "raw"
+
+	// DecodeFlagRecordValue is a value of output of records with metadata and encoded value in json, one record per line.
+	DecodeFlagRecordValue = "record"
 )
 
 var decodeFlagValidValues = []string{
 	DecodeFlagTextValue,
 	DecodeFlagJSONValue,
+	DecodeFlagJSONLValue,
+	DecodeFlagPrototextCompactValue,
+	DecodeFlagHexValue,
+	DecodeFlagBase64Value,
+	DecodeFlagRawValue,
+	DecodeFlagRecordValue,
 }
 
 type Flags struct {
@@ -29,6 +53,7 @@ type Flags struct {
 	proto        []string
 	broker       []string
 	kafkaAuthDSN string
+	kafkaVersion string
 	debug        bool
 	output       string
 
@@ -49,10 +74,14 @@ func (f *Flags) Init() {
 	pf.StringSliceVarP(&f.broker, "broker", "b", []string{"0.0.0.0:9092"}, "Bootstrap broker(s) (host[:port],...)")
 	pf.Int32VarP(&f.Partition, "partition", "p", -1, "Partition number")
 	pf.StringVarP(&f.kafkaAuthDSN, "kafka-auth-dsn", "X", "", fmt.Sprintf("Kafka auth DSN (%s)", kafka.AuthDSNTemplate))
+	pf.StringVar(&f.kafkaVersion, "kafka-version", kafka.DefaultVersion, "Kafka version of brokers")
 
 	// proto
 	pf.StringSliceVarP(&f.proto, "proto", "f", []string{}, "Proto files ({file | pattern | url},...)")
 	pf.StringVar(&f.output, "output", "json", fmt.Sprintf("Output type: %s", strings.Join(decodeFlagValidValues, ", ")))
+	pf.Bool("use-proto-names", false, "Use field names of proto files in JSON output")
+	pf.Bool("enums-as-ints", false, "Render enum values as integers in JSON output")
+	pf.Bool("emit-defaults", true, "Render fields with zero values in JSON output")
 
 	// config
 	pf.StringVarP(&f.Config, "config", "F", "", "Config file (default is $HOME/.protokaf.yaml)")
@@ -62,7 +91,11 @@ func (f *Flags) Init() {
 		"debug",
 		"broker",
 		"output",
+		"use-proto-names",
+		"enums-as-ints",
+		"emit-defaults",
 		"kafka-auth-dsn",
+		"kafka-version",
 	} {
 		_ = viper.BindPFlag(name, pf.Lookup(name))
 	}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kuper-tech/protokaf/internal/kafka"
+)
+
+// lagMetrics serves the last lag of consumer groups as Prometheus metrics in the text format
+// with results of refreshing it. It's safe for concurrent use.
+type lagMetrics struct {
+	mu   sync.RWMutex
+	lags map[string][]kafka.PartitionLag
+	// up is set if the last refresh of the group lag succeeded
+	up          map[string]bool
+	lastSuccess map[string]time.Time
+	now         func() time.Time
+}
+
+func newLagMetrics() *lagMetrics {
+	return &lagMetrics{
+		lags:        make(map[string][]kafka.PartitionLag),
+		up:          make(map[string]bool),
+		lastSuccess: make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+// Update replaces lag of the group.
+func (m *lagMetrics) Update(group string, lags []kafka.PartitionLag) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lags[group] = lags
+	m.up[group] = true
+	m.lastSuccess[group] = m.now()
+}
+
+// Fail removes lag of the group after a failed refresh, so stale values aren't served.
+func (m *lagMetrics) Fail(group string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.lags, group)
+	m.up[group] = false
+}
+
+func (m *lagMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	if err := m.serve(w); err != nil {
+		log.Errorf("Failed to serve lag metrics: %s", err)
+	}
+}
+
+// serve renders metrics under the lock and writes them after releasing it,
+// so a slow client doesn't block updates of lags.
+func (m *lagMetrics) serve(w http.ResponseWriter) error {
+	var b bytes.Buffer
+
+	m.mu.RLock()
+	err := m.write(&b)
+	m.mu.RUnlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, err = w.Write(b.Bytes())
+
+	return err
+}
+
+// metricFamily is a gauge with samples.
+type metricFamily struct {
+	name, help string
+	samples    []string
+}
+
+func (f *metricFamily) add(value interface{}, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+
+	f.samples = append(f.samples, fmt.Sprintf("%s{%s} %v", f.name, strings.Join(pairs, ","), value))
+}
+
+func (m *lagMetrics) write(w io.Writer) error {
+	var (
+		lag      = &metricFamily{name: "protokaf_consumergroup_lag", help: "Number of records not consumed by the group"}
+		lagTime  = &metricFamily{name: "protokaf_consumergroup_lag_seconds", help: "Time since the timestamp of the next record to consume"}
+		offset   = &metricFamily{name: "protokaf_consumergroup_current_offset", help: "Offset committed by the group"}
+		logEnd   = &metricFamily{name: "protokaf_topic_partition_log_end_offset", help: "Offset of the next produced record"}
+		assigned = &metricFamily{name: "protokaf_consumergroup_partition_assigned", help: "Partition is assigned to the group member"}
+		up       = &metricFamily{name: "protokaf_lag_up", help: "Last refresh of lag of the group succeeded"}
+		success  = &metricFamily{name: "protokaf_lag_last_success_timestamp_seconds", help: "Time of the last successful refresh of lag of the group"}
+	)
+
+	// groups are refreshed at least once
+	groups := make([]string, 0, len(m.up))
+	for group := range m.up {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	for _, group := range groups {
+		value := 0
+		if m.up[group] {
+			value = 1
+		}
+		up.add(value, "group", group)
+
+		if t, ok := m.lastSuccess[group]; ok {
+			success.add(strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64), "group", group)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		for _, l := range m.lags[group] {
+			partition := fmt.Sprint(l.Partition)
+
+			if l.Lag >= 0 {
+				lag.add(l.Lag, "group", group, "topic", l.Topic, "partition", partition)
+				lagTime.add(l.TimeLag.Seconds(), "group", group, "topic", l.Topic, "partition", partition)
+				offset.add(l.Committed, "group", group, "topic", l.Topic, "partition", partition)
+			}
+
+			if l.Member != "" {
+				assigned.add(1, "group", group, "topic", l.Topic, "partition", partition, "member", l.Member)
+			}
+
+			// log end offsets are metrics of partitions, groups may share them
+			if key := l.Topic + "/" + partition; !seen[key] {
+				seen[key] = true
+				logEnd.add(l.LogEnd, "topic", l.Topic, "partition", partition)
+			}
+		}
+	}
+
+	for _, f := range []*metricFamily{lag, lagTime, offset, logEnd, assigned, up, success} {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", f.name, f.help, f.name); err != nil {
+			return err
+		}
+
+		for _, s := range f.samples {
+			if _, err := fmt.Fprintln(w, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// labelEscaper escapes label values of the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,304 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/calldata"
+	"github.com/kuper-tech/protokaf/internal/proto"
+)
+
+// mirrorTransform filters, redacts and transcodes values of mirrored records.
+// Records are copied as is if message descriptors aren't set.
+type mirrorTransform struct {
+	from, to *desc.MessageDescriptor
+	filter   *template.Template
+	redact   []string
+	fieldMap []fieldMapping
+
+	// dropped are paths of fields unknown to the target message reported before
+	mu      sync.Mutex
+	dropped map[string]bool
+}
+
+// fieldMapping moves value of the field at dotted path from to the path to.
+type fieldMapping struct {
+	from, to []string
+}
+
+// mirrorFilterData is data of filter template.
+type mirrorFilterData struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       string
+	Headers   map[string]string
+	// Message has fields with names of proto file
+	Message map[string]interface{}
+}
+
+// newMirrorTransform creates a new mirrorTransform, to is from if it's nil.
+func newMirrorTransform(from, to *desc.MessageDescriptor, filter string, redact, fieldMap []string) (*mirrorTransform, error) {
+	if to == nil {
+		to = from
+	}
+
+	t := &mirrorTransform{from: from, to: to, redact: redact, dropped: make(map[string]bool)}
+
+	if from == nil && (filter != "" || len(redact) > 0 || len(fieldMap) > 0) {
+		return nil, fmt.Errorf("--filter, --redact and --field-map require message name")
+	}
+
+	if filter != "" {
+		var err error
+		if t.filter, err = calldata.ParseTemplate([]byte(filter)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range fieldMap {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("field-map flag has invalid value: %s, use old=new", m)
+		}
+
+		t.fieldMap = append(t.fieldMap, fieldMapping{
+			from: strings.Split(parts[0], "."),
+			to:   strings.Split(parts[1], "."),
+		})
+	}
+
+	return t, nil
+}
+
+// Apply returns value of the record to produce or false if the record is filtered out.
+func (t *mirrorTransform) Apply(msg *sarama.ConsumerMessage) ([]byte, bool, error) {
+	// tombstones are mirrored as is
+	if t.from == nil || msg.Value == nil {
+		return msg.Value, true, nil
+	}
+
+	m := dynamic.NewMessageFactoryWithDefaults().NewDynamicMessage(t.from)
+	if err := m.Unmarshal(msg.Value); err != nil {
+		return nil, false, err
+	}
+
+	if t.filter != nil {
+		ok, err := t.match(msg, m)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+
+	if err := proto.Redact(m, t.redact, proto.Redaction{Mode: proto.RedactRemove}); err != nil {
+		return nil, false, err
+	}
+
+	if t.to != t.from || len(t.fieldMap) > 0 {
+		var err error
+		if m, err = t.transcode(m); err != nil {
+			return nil, false, err
+		}
+	}
+
+	value, err := m.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+// match executes filter template, the record is mirrored if the result is true.
+func (t *mirrorTransform) match(msg *sarama.ConsumerMessage, m *dynamic.Message) (bool, error) {
+	fields, err := messageFields(m, true)
+	if err != nil {
+		return false, err
+	}
+
+	data := mirrorFilterData{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Headers:   make(map[string]string, len(msg.Headers)),
+		Message:   fields,
+	}
+
+	for _, h := range msg.Headers {
+		data.Headers[string(h.Key)] = string(h.Value)
+	}
+
+	var b bytes.Buffer
+	if err := t.filter.Execute(&b, data); err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(b.String()) == "true", nil
+}
+
+// transcode converts message to the target message through JSON with renamed fields,
+// fields unknown to the target message are dropped and reported once.
+func (t *mirrorTransform) transcode(m *dynamic.Message) (*dynamic.Message, error) {
+	fields, err := messageFields(m, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fm := range t.fieldMap {
+		if v, ok := removeField(fields, fm.from); ok {
+			setField(fields, fm.to, v)
+		}
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	res := dynamic.NewMessageFactoryWithDefaults().NewDynamicMessage(t.to)
+	if err := res.UnmarshalJSONPB(&jsonpb.Unmarshaler{AllowUnknownFields: true}, data); err != nil {
+		return nil, fmt.Errorf("transcode to %s: %w", t.to.GetFullyQualifiedName(), err)
+	}
+
+	t.reportDropped(unknownJSONFields(t.to, fields, ""))
+
+	return res, nil
+}
+
+// reportDropped logs paths of dropped fields which weren't reported before.
+func (t *mirrorTransform) reportDropped(paths []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, path := range paths {
+		if !t.dropped[path] {
+			t.dropped[path] = true
+			log.Warnf("Field %s isn't a field of %s, it's dropped", path, t.to.GetFullyQualifiedName())
+		}
+	}
+}
+
+// Dropped returns sorted paths of fields dropped by transcoding.
+func (t *mirrorTransform) Dropped() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	paths := make([]string, 0, len(t.dropped))
+	for path := range t.dropped {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// unknownJSONFields returns dotted paths of fields in JSON which the message doesn't have.
+func unknownJSONFields(md *desc.MessageDescriptor, fields map[string]interface{}, prefix string) []string {
+	var result []string
+
+	for name, v := range fields {
+		fd := md.FindFieldByName(name)
+		if fd == nil {
+			fd = md.FindFieldByJSONName(name)
+		}
+
+		if fd == nil {
+			result = append(result, prefix+name)
+			continue
+		}
+
+		// well-known types have own JSON
+		nested := fd.GetMessageType()
+		if nested == nil || fd.IsMap() || strings.HasPrefix(nested.GetFullyQualifiedName(), "google.protobuf.") {
+			continue
+		}
+
+		switch v := v.(type) {
+		case map[string]interface{}:
+			result = append(result, unknownJSONFields(nested, v, prefix+name+".")...)
+		case []interface{}:
+			for _, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					result = append(result, unknownJSONFields(nested, m, prefix+name+".")...)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// messageFields returns fields of message in JSON with names of proto file.
+// Integral numbers are int64, so they may be compared with constants in templates.
+func messageFields(m *dynamic.Message, emitDefaults bool) (map[string]interface{}, error) {
+	data, err := m.MarshalJSONPB(&jsonpb.Marshaler{OrigName: true, EmitDefaults: emitDefaults})
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return intNumbers(fields).(map[string]interface{}), nil
+}
+
+func intNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = intNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = intNumbers(e)
+		}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	}
+
+	return v
+}
+
+func removeField(fields map[string]interface{}, path []string) (interface{}, bool) {
+	for _, name := range path[:len(path)-1] {
+		nested, ok := fields[name].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		fields = nested
+	}
+
+	name := path[len(path)-1]
+	v, ok := fields[name]
+	delete(fields, name)
+
+	return v, ok
+}
+
+func setField(fields map[string]interface{}, path []string, v interface{}) {
+	for _, name := range path[:len(path)-1] {
+		nested, ok := fields[name].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			fields[name] = nested
+		}
+		fields = nested
+	}
+
+	fields[path[len(path)-1]] = v
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findTestMessage(t *testing.T, name string) *desc.MessageDescriptor {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage(name)
+	require.Nil(t, err)
+
+	return md
+}
+
+func encodeTestMessage(t *testing.T, md *desc.MessageDescriptor, json string) []byte {
+	m := dynamic.NewMessage(md)
+	require.Nil(t, m.UnmarshalJSON([]byte(json)))
+
+	data, err := m.Marshal()
+	require.Nil(t, err)
+
+	return data
+}
+
+func Test_mirrorTransform_Filter(t *testing.T) {
+	md := findTestMessage(t, "HelloRequest")
+
+	tr, err := newMirrorTransform(md, nil, `{{ and (eq .Message.age 30) (eq .Headers.source "app") }}`, []string{"name"}, nil)
+	require.Nil(t, err)
+
+	msg := &sarama.ConsumerMessage{
+		Value:   encodeTestMessage(t, md, `{"name": "Alice", "age": 30}`),
+		Headers: []*sarama.RecordHeader{{Key: []byte("source"), Value: []byte("app")}},
+	}
+
+	value, ok, err := tr.Apply(msg)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, encodeTestMessage(t, md, `{"age": 30}`), value)
+
+	msg.Value = encodeTestMessage(t, md, `{"name": "Bob", "age": 31}`)
+	_, ok, err = tr.Apply(msg)
+	require.Nil(t, err)
+	assert.False(t, ok)
+
+	// tombstones aren't filtered
+	msg.Value = nil
+	value, ok, err = tr.Apply(msg)
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, value)
+}
+
+func Test_mirrorTransform_Transcode(t *testing.T) {
+	from := findTestMessage(t, "HelloRequest")
+	to := findTestMessage(t, "HelloResponse")
+
+	tr, err := newMirrorTransform(from, to, "", nil, []string{"name=answer"})
+	require.Nil(t, err)
+
+	value, ok, err := tr.Apply(&sarama.ConsumerMessage{Value: encodeTestMessage(t, from, `{"name": "Alice", "age": 30}`)})
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, encodeTestMessage(t, to, `{"answer": "Alice"}`), value)
+
+	_, _, err = tr.Apply(&sarama.ConsumerMessage{Value: []byte{0xff}})
+	assert.Error(t, err)
+
+	// age isn't a field of the response
+	assert.Equal(t, []string{"age"}, tr.Dropped())
+}
+
+func Test_newMirrorTransform_Invalid(t *testing.T) {
+	_, err := newMirrorTransform(nil, nil, "", []string{"name"}, nil)
+	assert.EqualError(t, err, "--filter, --redact and --field-map require message name")
+
+	_, err = newMirrorTransform(findTestMessage(t, "HelloRequest"), nil, "", nil, []string{"name"})
+	assert.EqualError(t, err, "field-map flag has invalid value: name, use old=new")
+
+	// records are copied as is without message
+	tr, err := newMirrorTransform(nil, nil, "", nil, nil)
+	require.Nil(t, err)
+
+	value, ok, err := tr.Apply(&sarama.ConsumerMessage{Value: []byte{0xff}})
+	require.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{0xff}, value)
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/kuper-tech/protokaf/internal/utils/dump"
+	"github.com/kuper-tech/protokaf/internal/utils/sink"
+	"github.com/spf13/viper"
+)
+
+// messages prints consumed and produced messages in the format of --output flag.
+var messages = newMessageWriter(os.Stdout, DecodeFlagJSONValue, proto.JSONOptions{EmitDefaults: true})
+
+// isStreamOutput reports whether messages are written to stdout without titles,
+// logs are written to stderr then.
+func isStreamOutput(output string) bool {
+	switch output {
+	case DecodeFlagJSONLValue,
+		DecodeFlagPrototextCompactValue,
+		DecodeFlagHexValue,
+		DecodeFlagBase64Value,
+		DecodeFlagRawValue,
+		DecodeFlagRecordValue:
+		return true
+	}
+
+	return false
+}
+
+// isRawOutput reports whether the output writes values without decoding them,
+// so records undecodable with the message can be written too.
+func isRawOutput(output string) bool {
+	switch output {
+	case DecodeFlagHexValue,
+		DecodeFlagBase64Value,
+		DecodeFlagRawValue,
+		DecodeFlagRecordValue:
+		return true
+	}
+
+	return false
+}
+
+// jsonOptions returns options of messages in JSON from flags and config.
+func jsonOptions() proto.JSONOptions {
+	return proto.JSONOptions{
+		UseProtoNames: viper.GetBool("use-proto-names"),
+		EnumsAsInts:   viper.GetBool("enums-as-ints"),
+		EmitDefaults:  viper.GetBool("emit-defaults"),
+	}
+}
+
+// messageWriter prints messages with titles to log or writes them to stdout in stream output.
+// It's safe for concurrent use.
+type messageWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	output string
+	opts   proto.JSONOptions
+}
+
+func newMessageWriter(out io.Writer, output string, opts proto.JSONOptions) *messageWriter {
+	return &messageWriter{out: out, output: output, opts: opts}
+}
+
+// Print prints decoded message of the record, message is nil for tombstones
+// and undecodable values of raw outputs. Tombstones are only logged unless output is record.
+func (w *messageWriter) Print(name string, rec kafka.Record, msg *dynamic.Message) {
+	if msg == nil && rec.Value == nil && w.output != DecodeFlagRecordValue {
+		dump.Tombstone(log, name, rec.Key)
+		return
+	}
+
+	if !isStreamOutput(w.output) {
+		codec, err := outputCodec(w.output, w.opts)
+		if err != nil {
+			log.Errorf("Error to print message: %s", err)
+			return
+		}
+
+		dump.DynamicMessage(log, name, w.output, codec, msg)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := writeRecord(w.out, w.output, rec, msg, w.opts); err != nil {
+		log.Errorf("Error to write message: %s", err)
+	}
+}
+
+// outputCodec returns codec of messages in the output.
+// Record and raw outputs write records and values themselves, so they have no codec.
+func outputCodec(output string, opts proto.JSONOptions) (proto.Codec, error) {
+	switch output {
+	case DecodeFlagTextValue:
+		return proto.NewPrototextCodec(false), nil
+	case DecodeFlagJSONValue:
+		opts.Indent = "  "
+		return proto.NewJSONCodec(opts), nil
+	case DecodeFlagJSONLValue:
+		return proto.NewJSONCodec(opts), nil
+	case DecodeFlagPrototextCompactValue:
+		return proto.NewPrototextCodec(true), nil
+	case DecodeFlagHexValue:
+		return proto.NewCodec(proto.FormatHex)
+	case DecodeFlagBase64Value:
+		return proto.NewCodec(proto.FormatBase64)
+	}
+
+	return nil, fmt.Errorf("unknown output: %s", output)
+}
+
+// writeRecord writes the record in the output: record with metadata in JSON,
+// length-delimited value in raw output or its message encoded by codec of the output.
+func writeRecord(w io.Writer, output string, rec kafka.Record, msg *dynamic.Message, opts proto.JSONOptions) error {
+	switch output {
+	case DecodeFlagRecordValue:
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(append(data, '\n'))
+
+		return err
+	case DecodeFlagRawValue:
+		return proto.WriteDelimited(w, rec.Value)
+	}
+
+	codec, err := outputCodec(output, opts)
+	if err != nil {
+		return err
+	}
+
+	return dump.WriteMessage(w, codec, msg, rec.Value)
+}
+
+// outputExtensions are file extensions of outputs.
+var outputExtensions = map[string]string{
+	DecodeFlagTextValue:             "txt",
+	DecodeFlagJSONValue:             "json",
+	DecodeFlagJSONLValue:            "jsonl",
+	DecodeFlagPrototextCompactValue: "txtpb",
+	DecodeFlagHexValue:              "hex",
+	DecodeFlagBase64Value:           "b64",
+	DecodeFlagRawValue:              "bin",
+	DecodeFlagRecordValue:           "jsonl",
+}
+
+// recordSink receives consumed records with decoded messages, message is nil for tombstones
+// and undecodable values of raw outputs.
+type recordSink interface {
+	Write(rec kafka.Record, msg *dynamic.Message) error
+	Close() error
+}
+
+// stdoutSink prints messages with messages writer.
+type stdoutSink struct{}
+
+func (stdoutSink) Write(rec kafka.Record, msg *dynamic.Message) error {
+	messages.Print("Message consumed", rec, msg)
+	return nil
+}
+
+func (stdoutSink) Close() error { return nil }
+
+// fileSink writes messages in the output format to files of topic partitions.
+type fileSink struct {
+	files  *sink.FileSink
+	output string
+	opts   proto.JSONOptions
+}
+
+func newFileSink(opts sink.Options) (*fileSink, error) {
+	output := viper.GetString("output")
+	opts.Extension = outputExtensions[output]
+
+	files, err := sink.NewFileSink(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSink{files: files, output: output, opts: jsonOptions()}, nil
+}
+
+func (s *fileSink) Write(rec kafka.Record, msg *dynamic.Message) error {
+	if msg == nil && rec.Value == nil && s.output != DecodeFlagRecordValue {
+		dump.Tombstone(log, "Message consumed", rec.Key)
+		return nil
+	}
+
+	var b bytes.Buffer
+	if err := writeRecord(&b, s.output, rec, msg, s.opts); err != nil {
+		return err
+	}
+
+	return s.files.Write(rec.Topic, rec.Partition, rec.Offset, b.Bytes())
+}
+
+func (s *fileSink) Close() error {
+	return s.files.Close()
+}
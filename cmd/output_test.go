@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/kuper-tech/protokaf/internal/utils/sink"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_messageWriter(t *testing.T) {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	msg := dynamic.NewMessage(md)
+	msg.SetFieldByName("name", "Alice")
+
+	var logs, out bytes.Buffer
+	setLogger(nopSync{&logs}, "info", "")
+
+	w := newMessageWriter(&out, DecodeFlagJSONLValue, proto.JSONOptions{UseProtoNames: true})
+	w.Print("Message consumed", kafka.Record{}, msg)
+	w.Print("Message consumed", kafka.Record{}, msg)
+
+	assert.Equal(t, "{\"name\":\"Alice\"}\n{\"name\":\"Alice\"}\n", out.String())
+	assert.Empty(t, logs.String())
+
+	out.Reset()
+	w = newMessageWriter(&out, DecodeFlagJSONValue, proto.JSONOptions{EmitDefaults: true})
+	w.Print("Message consumed", kafka.Record{}, msg)
+
+	assert.Empty(t, out.String())
+	assert.Contains(t, logs.String(), "Message consumed (json output)")
+	assert.Contains(t, logs.String(), `"age": 0`)
+}
+
+func Test_NewRootCmd_StreamOutputLogs(t *testing.T) {
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{
+		"produce",
+		"HelloRequest",
+		"--proto", "../internal/proto/testdata/example.proto",
+		"--output", "jsonl",
+		"--dry-run",
+		"-d", `{"name": "Alice"}`,
+	})
+
+	stdout, stderr, err := getCommandOut(t, cmd)
+	require.Nil(t, err)
+
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "Message built")
+}
+
+func Test_fileSink(t *testing.T) {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/example.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.Nil(t, err)
+
+	msg := dynamic.NewMessage(md)
+	msg.SetFieldByName("name", "Alice")
+
+	value, err := msg.Marshal()
+	require.Nil(t, err)
+
+	viper.Set("output", DecodeFlagHexValue)
+	defer viper.Set("output", nil)
+
+	dir := t.TempDir()
+	s, err := newFileSink(sink.Options{Dir: dir})
+	require.Nil(t, err)
+
+	for offset := int64(10); offset < 12; offset++ {
+		rec := kafka.Record{Topic: "test", Partition: 2, Offset: offset, Value: value}
+		require.Nil(t, s.Write(rec, msg))
+	}
+	require.Nil(t, s.Close())
+
+	data, err := os.ReadFile(filepath.Join(dir, "test-2-000001.hex"))
+	require.Nil(t, err)
+	assert.Equal(t, "0a05416c696365\n0a05416c696365\n", string(data))
+
+	_, err = os.Stat(filepath.Join(dir, sink.ManifestFile))
+	assert.Nil(t, err)
+}
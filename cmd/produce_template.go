@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/kuper-tech/protokaf/internal/calldata"
+)
+
+// produceTemplate is a template of message topic, key, header values, timestamp and value,
+// all parts of a message are executed with the same call data.
+type produceTemplate struct {
+	topic   *template.Template
+	key     *template.Template
+	headers []headerTemplate
+	// timestamp is nil if broker sets the current time
+	timestamp *template.Template
+	// value is nil for tombstones and binary data
+	value *template.Template
+	// rawValue is binary data used as is
+	rawValue []byte
+}
+
+type headerTemplate struct {
+	key   []byte
+	value *template.Template
+}
+
+// parseProduceTemplate parses templates of message parts.
+// Headers are key=value pairs, invalid pairs are skipped.
+func parseProduceTemplate(topic, key string, headers []string, timestamp string, value []byte) (*produceTemplate, error) {
+	var (
+		t   = &produceTemplate{}
+		err error
+	)
+
+	if t.topic, err = calldata.ParseTemplate([]byte(topic)); err != nil {
+		return nil, err
+	}
+
+	if t.key, err = calldata.ParseTemplate([]byte(key)); err != nil {
+		return nil, err
+	}
+
+	for _, h := range headers {
+		parts := strings.SplitN(h, "=", 2)
+		if len(parts) != 2 {
+			log.Warnf("Invalid headers pair: %s", h)
+			continue
+		}
+
+		tmpl, err := calldata.ParseTemplate([]byte(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+
+		t.headers = append(t.headers, headerTemplate{key: []byte(parts[0]), value: tmpl})
+	}
+
+	if timestamp != "" {
+		if t.timestamp, err = calldata.ParseTemplate([]byte(timestamp)); err != nil {
+			return nil, err
+		}
+	}
+
+	if value != nil {
+		if t.value, err = calldata.ParseTemplate(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// Execute returns message with topic, key and headers, and data of value.
+// Data is raw value if template has no value, it's nil for tombstones.
+func (t *produceTemplate) Execute(cd *calldata.CallData) (*sarama.ProducerMessage, []byte, error) {
+	topic, err := cd.Execute(t.topic)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := cd.Execute(t.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := make([]sarama.RecordHeader, 0, len(t.headers))
+	for _, h := range t.headers {
+		value, err := cd.Execute(h.value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		headers = append(headers, sarama.RecordHeader{Key: h.key, Value: value.Bytes()})
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:   topic.String(),
+		Key:     sarama.StringEncoder(key.String()),
+		Headers: headers,
+	}
+
+	if t.timestamp != nil {
+		b, err := cd.Execute(t.timestamp)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if msg.Timestamp, err = parseTimestamp(b.String()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if t.value == nil {
+		return msg, t.rawValue, nil
+	}
+
+	value, err := cd.Execute(t.value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return msg, value.Bytes(), nil
+}
+
+// isNullData reports whether data is JSON null, which is produced as tombstone.
+func isNullData(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+}
+
+// parseTimestamp parses timestamp in RFC3339 format or as unix time in milliseconds.
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if millis, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, millis*int64(time.Millisecond)), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, use RFC3339 or unix time in milliseconds", s)
+	}
+
+	return t, nil
+}
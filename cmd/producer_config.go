@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/kuper-tech/protokaf/internal/kafka"
+	"github.com/kuper-tech/protokaf/internal/utils/dump"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// producerFlags are producer tuning flags, they may be set in config too.
+var producerFlags = []string{
+	"partitioner",
+	"acks",
+	"compression",
+	"compression-level",
+	"idempotent",
+	"max-open-requests",
+	"max-message-bytes",
+	"retries",
+	"retry-backoff",
+	"flush-bytes",
+	"flush-messages",
+	"flush-frequency",
+	"flush-max-messages",
+}
+
+// setProducerFlags adds producer tuning flags.
+func setProducerFlags(flags *pflag.FlagSet) {
+	defaults := sarama.NewConfig()
+
+	flags.String("partitioner", PartitionerFNV, fmt.Sprintf(
+		"Partitioner of keys: %s", strings.Join(partitionerValidValues, ", "),
+	))
+
+	flags.String("acks", "leader", "Required acks: none (0), leader (1), all (-1)")
+	flags.String("compression", "none", "Compression codec: none, gzip, snappy, lz4, zstd")
+	flags.Int("compression-level", sarama.CompressionLevelDefault, "Compression level of codec")
+	flags.Bool("idempotent", false, "Enable idempotent producer (requires acks=all and max-open-requests=1)")
+	flags.Int("max-open-requests", defaults.Net.MaxOpenRequests, "Number of unacknowledged requests per broker connection")
+	flags.Int("max-message-bytes", defaults.Producer.MaxMessageBytes, "Maximum permitted size of a message")
+	flags.Int("retries", defaults.Producer.Retry.Max, "Number of retries to produce a message")
+	flags.Duration("retry-backoff", defaults.Producer.Retry.Backoff, "Time to wait between retries")
+	flags.Int("flush-bytes", 0, "Best-effort number of bytes needed to trigger a flush")
+	flags.Int("flush-messages", 0, "Best-effort number of messages needed to trigger a flush")
+	flags.Duration("flush-frequency", 0, "Best-effort frequency of flushes")
+	flags.Int("flush-max-messages", 0, "Maximum number of messages in a single request, 0 is unlimited")
+}
+
+// bindProducerFlags binds producer tuning flags of the running command to config keys,
+// the flags are shared by several commands.
+func bindProducerFlags(flags *pflag.FlagSet) {
+	for _, name := range producerFlags {
+		_ = viper.BindPFlag(name, flags.Lookup(name))
+	}
+}
+
+// producerOptions returns producer options from flags and config.
+// Idempotent producer gets suitable acks and max open requests unless they are set explicitly.
+func producerOptions() kafka.ProducerOptions {
+	o := kafka.ProducerOptions{
+		Acks:             viper.GetString("acks"),
+		Compression:      viper.GetString("compression"),
+		CompressionLevel: viper.GetInt("compression-level"),
+		Idempotent:       viper.GetBool("idempotent"),
+		MaxOpenRequests:  viper.GetInt("max-open-requests"),
+		MaxMessageBytes:  viper.GetInt("max-message-bytes"),
+		Retries:          viper.GetInt("retries"),
+		RetryBackoff:     viper.GetDuration("retry-backoff"),
+		FlushBytes:       viper.GetInt("flush-bytes"),
+		FlushMessages:    viper.GetInt("flush-messages"),
+		FlushFrequency:   viper.GetDuration("flush-frequency"),
+		FlushMaxMessages: viper.GetInt("flush-max-messages"),
+	}
+
+	if o.Idempotent {
+		if !viper.IsSet("acks") {
+			o.Acks = "all"
+		}
+
+		if !viper.IsSet("max-open-requests") {
+			o.MaxOpenRequests = 1
+		}
+	}
+
+	return o
+}
+
+// getProducerConfigData returns effective producer config.
+func getProducerConfigData(config *sarama.Config) dump.Pairs {
+	return dump.Pairs{
+		{Name: "version", Value: config.Version},
+		{Name: "acks", Value: kafka.AcksString(config.Producer.RequiredAcks)},
+		{Name: "compression", Value: config.Producer.Compression},
+		{Name: "compression level", Value: config.Producer.CompressionLevel},
+		{Name: "idempotent", Value: config.Producer.Idempotent},
+		{Name: "max open requests", Value: config.Net.MaxOpenRequests},
+		{Name: "max message bytes", Value: config.Producer.MaxMessageBytes},
+		{Name: "retries", Value: config.Producer.Retry.Max},
+		{Name: "retry backoff", Value: config.Producer.Retry.Backoff},
+		{Name: "flush bytes", Value: config.Producer.Flush.Bytes},
+		{Name: "flush messages", Value: config.Producer.Flush.Messages},
+		{Name: "flush frequency", Value: config.Producer.Flush.Frequency},
+		{Name: "flush max messages", Value: config.Producer.Flush.MaxMessages},
+		{Name: "timeout", Value: config.Producer.Timeout},
+	}
+}
+
+// applyProducerOptions sets producer options to the kafka config and dumps the result.
+func applyProducerOptions(config *sarama.Config, opts kafka.ProducerOptions) error {
+	if err := opts.Apply(config); err != nil {
+		return err
+	}
+
+	log.Debug("Producer config:")
+	getProducerConfigData(config).Dump(log)
+
+	return nil
+}
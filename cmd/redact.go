@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/proto"
+)
+
+// redactor redacts fields of consumed messages and values of headers before they are written.
+// Fields marked with (sensitive) = true are always redacted.
+type redactor struct {
+	redaction proto.Redaction
+	paths     []string
+	sensitive []*desc.FieldDescriptor
+	headers   map[string]bool
+}
+
+// newRedactor creates a new redactor, it's nil if there is nothing to redact.
+func newRedactor(md *desc.MessageDescriptor, paths, headers []string, redaction proto.Redaction) (*redactor, error) {
+	r := &redactor{
+		redaction: redaction,
+		paths:     paths,
+		sensitive: proto.SensitiveFields(md),
+		headers:   make(map[string]bool, len(headers)),
+	}
+
+	for _, h := range headers {
+		r.headers[strings.ToLower(h)] = true
+	}
+
+	// unknown fields and modes are reported before consuming
+	if err := proto.Redact(dynamic.NewMessage(md), paths, redaction); err != nil {
+		return nil, err
+	}
+
+	if len(r.paths) == 0 && len(r.sensitive) == 0 && len(r.headers) == 0 {
+		return nil, nil
+	}
+
+	return r, nil
+}
+
+// Apply redacts the message and returns a copy of the record with redacted headers and value
+// encoded from the redacted message without unknown fields, so no output has original values.
+func (r *redactor) Apply(rec *sarama.ConsumerMessage, msg *dynamic.Message) (*sarama.ConsumerMessage, error) {
+	if r == nil {
+		return rec, nil
+	}
+
+	res := *rec
+
+	if len(r.headers) > 0 {
+		res.Headers = make([]*sarama.RecordHeader, 0, len(rec.Headers))
+		for _, h := range rec.Headers {
+			if !r.headers[strings.ToLower(string(h.Key))] {
+				res.Headers = append(res.Headers, h)
+				continue
+			}
+
+			// headers are removed in remove mode
+			if r.redaction.Mode != proto.RedactRemove {
+				res.Headers = append(res.Headers, &sarama.RecordHeader{Key: h.Key, Value: proto.RedactBytes(h.Value, r.redaction)})
+			}
+		}
+	}
+
+	if msg == nil || (len(r.paths) == 0 && len(r.sensitive) == 0) {
+		return &res, nil
+	}
+
+	if err := proto.Redact(msg, r.paths, r.redaction); err != nil {
+		return nil, err
+	}
+
+	if err := proto.RedactFields(msg, r.sensitive, r.redaction); err != nil {
+		return nil, fmt.Errorf("redact sensitive fields: %w", err)
+	}
+
+	// unknown fields may have values of fields removed from the schema, they aren't written
+	if err := proto.DiscardUnknown(msg); err != nil {
+		return nil, fmt.Errorf("discard unknown fields: %w", err)
+	}
+
+	value, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	res.Value = value
+
+	return &res, nil
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_redactor_Apply(t *testing.T) {
+	p, err := proto.NewProto([]string{"../internal/proto/testdata/customer.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("Customer")
+	require.Nil(t, err)
+
+	r, err := newRedactor(md, []string{"name"}, []string{"Authorization"}, proto.Redaction{Mode: proto.RedactMask})
+	require.Nil(t, err)
+
+	rec := &sarama.ConsumerMessage{
+		Value: encodeTestMessage(t, md, `{"name": "Alice", "email": "alice@example.com", "address": {"city": "Paris"}}`),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("authorization"), Value: []byte("token")},
+			{Key: []byte("source"), Value: []byte("app")},
+		},
+	}
+
+	m := dynamic.NewMessage(md)
+	require.Nil(t, m.Unmarshal(rec.Value))
+
+	res, err := r.Apply(rec, m)
+	require.Nil(t, err)
+
+	// value is encoded from the redacted message
+	redacted := dynamic.NewMessage(md)
+	require.Nil(t, redacted.Unmarshal(res.Value))
+
+	data, err := redacted.MarshalJSON()
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"name": "***", "email": "***", "address": {"city": "Paris"}}`, string(data))
+	assert.True(t, dynamic.Equal(m, redacted))
+
+	assert.Equal(t, []*sarama.RecordHeader{
+		{Key: []byte("authorization"), Value: []byte("***")},
+		{Key: []byte("source"), Value: []byte("app")},
+	}, res.Headers)
+
+	// the consumed record isn't changed
+	assert.Equal(t, []byte("token"), rec.Headers[0].Value)
+
+	// unknown fields aren't written
+	rec.Value = append(rec.Value, 0xa0, 0x06, 0x01)
+	m = dynamic.NewMessage(md)
+	require.Nil(t, m.Unmarshal(rec.Value))
+	require.Len(t, m.GetUnknownFields(), 1)
+
+	res, err = r.Apply(rec, m)
+	require.Nil(t, err)
+	require.Nil(t, redacted.Unmarshal(res.Value))
+	assert.Empty(t, redacted.GetUnknownFields())
+
+	// tombstones have headers only
+	res, err = r.Apply(&sarama.ConsumerMessage{Headers: rec.Headers}, nil)
+	require.Nil(t, err)
+	assert.Nil(t, res.Value)
+	assert.Equal(t, []byte("***"), res.Headers[0].Value)
+}
+
+func Test_newRedactor(t *testing.T) {
+	md := findTestMessage(t, "HelloRequest")
+
+	r, err := newRedactor(md, nil, nil, proto.Redaction{Mode: proto.RedactMask})
+	require.Nil(t, err)
+	assert.Nil(t, r)
+
+	rec := &sarama.ConsumerMessage{Value: []byte{1}}
+	res, err := r.Apply(rec, nil)
+	require.Nil(t, err)
+	assert.Same(t, rec, res)
+
+	_, err = newRedactor(md, []string{"unknown"}, nil, proto.Redaction{Mode: proto.RedactMask})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has no field unknown")
+
+	_, err = newRedactor(md, nil, nil, proto.Redaction{Mode: "blur"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown redact mode "blur"`)
+
+	_, err = newRedactor(md, nil, []string{"Authorization"}, proto.Redaction{Mode: proto.RedactHash})
+	assert.ErrorIs(t, err, proto.ErrRedactKeyRequired)
+}
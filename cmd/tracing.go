@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/kuper-tech/protokaf/internal/tracing"
+	"github.com/opentracing/opentracing-go"
+	jaegerConfig "github.com/uber/jaeger-client-go/config"
+	jaegerZapLog "github.com/uber/jaeger-client-go/log/zap"
+)
+
+// newTracer creates a tracer of flags and env vars and sets it as the global tracer.
+func newTracer() (io.Closer, error) {
+	jaegerCfg, err := tracing.NewJaegerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	tracer, closer, err := tracing.NewTracer(
+		jaegerCfg,
+		tracing.OptionsFromConfig(),
+		jaegerConfig.Logger(jaegerZapLog.NewLogger(zapLog.Named("jaeger"))),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	opentracing.SetGlobalTracer(tracer)
+	log.Debug("Create new tracer")
+
+	return closer, nil
+}
@@ -37,6 +37,8 @@ var (
 		{Name: "TimestampUnixMilli", Desc: "Timestamp as unix time in milliseconds"},
 		{Name: "TimestampUnixNano", Desc: "Timestamp as unix time in nanoseconds"},
 		{Name: "UUID", Desc: "Generated UUIDv4"},
+		{Name: `TimestampAdd "-5m"`, Desc: "Timestamp shifted by duration in RFC3339 format"},
+		{Name: `TimestampUnixMilliAdd "-5m"`, Desc: "Timestamp shifted by duration as unix time in milliseconds"},
 	}
 )
 
@@ -47,15 +49,18 @@ type CallData struct {
 	TimestampUnixMilli int64
 	TimestampUnixNano  int64
 	UUID               string
+
+	now time.Time
 }
 
+// ParseTemplate parses data as a new template with calldata functions.
 func ParseTemplate(data []byte) (*template.Template, error) {
-	t, err := tmpl.Parse(string(data))
+	t, err := tmpl.Clone()
 	if err != nil {
 		return nil, err
 	}
 
-	return t, nil
+	return t.Parse(string(data))
 }
 
 // PrintFuncs prints list of functions to output.
@@ -86,7 +91,28 @@ func NewCallData(reqNum int) *CallData {
 		TimestampUnixMilli: nowNano / 1e6,
 		TimestampUnixNano:  nowNano,
 		UUID:               uuid.NewString(),
+		now:                now,
+	}
+}
+
+// TimestampAdd returns timestamp shifted by duration (e.g. "-5m") in RFC3339 format.
+func (c *CallData) TimestampAdd(duration string) (string, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return "", err
 	}
+
+	return c.now.Add(d).Format(time.RFC3339), nil
+}
+
+// TimestampUnixMilliAdd returns timestamp shifted by duration (e.g. "-5m") as unix time in milliseconds.
+func (c *CallData) TimestampUnixMilliAdd(duration string) (int64, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.now.Add(d).UnixNano() / 1e6, nil
 }
 
 func (c *CallData) Execute(tmpl *template.Template) (*bytes.Buffer, error) {
@@ -0,0 +1,49 @@
+package calldata
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplate_Independent(t *testing.T) {
+	first, err := ParseTemplate([]byte("first {{.RequestNumber}}"))
+	require.NoError(t, err)
+
+	second, err := ParseTemplate([]byte("second {{.RequestNumber}}"))
+	require.NoError(t, err)
+
+	cd := NewCallData(3)
+
+	b, err := cd.Execute(first)
+	require.NoError(t, err)
+	assert.Equal(t, "first 3", b.String())
+
+	b, err = cd.Execute(second)
+	require.NoError(t, err)
+	assert.Equal(t, "second 3", b.String())
+}
+
+func TestCallData_TimestampAdd(t *testing.T) {
+	cd := NewCallData(0)
+
+	tmpl, err := ParseTemplate([]byte(`{{.TimestampUnixMilliAdd "-1m30s"}}`))
+	require.NoError(t, err)
+
+	b, err := cd.Execute(tmpl)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprint(cd.TimestampUnixMilli-90000), b.String())
+
+	ts, err := cd.TimestampAdd("1h")
+	require.NoError(t, err)
+
+	parsed, err := time.Parse(time.RFC3339, ts)
+	require.NoError(t, err)
+	assert.Equal(t, cd.TimestampUnix+3600, parsed.Unix())
+
+	_, err = cd.TimestampAdd("yesterday")
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package calldata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template expressions suggested for fields by their type.
+const (
+	HintInt       = "{{randomNumber 0 100}}"
+	HintFloat     = "{{randomDecimal 0 100 2}}"
+	HintBool      = "{{randomBoolean}}"
+	HintString    = "{{randomString 10 | quote}}"
+	HintUUID      = "{{uuid | quote}}"
+	HintTimestamp = "{{.Timestamp | quote}}"
+	HintDuration  = `"{{randomNumber 1 60}}s"`
+)
+
+type stringHint struct {
+	match func(name string) bool
+	expr  string
+}
+
+var stringHints = []stringHint{
+	{hasSuffix("email"), "{{randomEmail | quote}}"},
+	{hasSuffix("phone", "phone_number"), "{{randomPhoneNumber | quote}}"},
+	{hasSuffix("ip", "ip_address", "ipv4"), "{{randomIpV4Address | quote}}"},
+	{hasSuffix("ipv6"), "{{randomIpV6Address | quote}}"},
+	{hasSuffix("first_name", "last_name", "full_name", "name"), "{{randomFullName | quote}}"},
+	{hasSuffix("id", "uuid", "guid"), HintUUID},
+	{hasSuffix("date"), `{{randomDateInRange "2000-01-01" "2030-01-01" | quote}}`},
+}
+
+// StringHint returns a template expression for the string field with given name.
+// Field name is matched in snake_case, e.g. "user_email" or "order_id".
+func StringHint(fieldName string) string {
+	name := strings.ToLower(fieldName)
+
+	for _, h := range stringHints {
+		if h.match(name) {
+			return h.expr
+		}
+	}
+
+	return HintString
+}
+
+// EnumHint returns a template expression which picks one of given enum values.
+func EnumHint(values []string) string {
+	if len(values) == 1 {
+		return fmt.Sprintf("%q", values[0])
+	}
+
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", v))
+	}
+
+	return fmt.Sprintf("{{randomStringSample %s | quote}}", strings.Join(quoted, " "))
+}
+
+// hasSuffix matches name equal to one of suffixes or ending with "_<suffix>".
+func hasSuffix(suffixes ...string) func(string) bool {
+	return func(name string) bool {
+		for _, s := range suffixes {
+			if name == s || strings.HasSuffix(name, "_"+s) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
@@ -0,0 +1,54 @@
+package calldata
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStringHint(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"email", "{{randomEmail | quote}}"},
+		{"user_email", "{{randomEmail | quote}}"},
+		{"order_id", HintUUID},
+		{"ID", HintUUID},
+		{"paid", HintString},
+		{"zip", HintString},
+		{"description", HintString},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, StringHint(tt.name))
+		})
+	}
+}
+
+func TestHints_Execute(t *testing.T) {
+	SetSeeder(1)
+
+	exprs := []string{HintInt, HintFloat, HintBool, HintString, HintTimestamp, HintDuration, EnumHint([]string{"A", "B"})}
+	for _, h := range stringHints {
+		exprs = append(exprs, h.expr)
+	}
+
+	for _, expr := range exprs {
+		t.Run(expr, func(t *testing.T) {
+			tmpl, err := tmpl.Clone()
+			require.Nil(t, err)
+
+			_, err = tmpl.Parse(expr)
+			require.Nil(t, err)
+
+			b, err := NewCallData(0).Execute(tmpl)
+			require.Nil(t, err)
+
+			var v interface{}
+			assert.Nil(t, json.Unmarshal(b.Bytes(), &v), b.String())
+		})
+	}
+}
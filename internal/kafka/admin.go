@@ -0,0 +1,377 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// DefaultRecordTimeout is a default timeout of reading records for lag in time.
+const DefaultRecordTimeout = 5 * time.Second
+
+// maxRecordReaders limits partitions records are read from at once for lag in time.
+const maxRecordReaders = 32
+
+// Admin wraps cluster admin with the client it's created from to inspect consumer groups.
+type Admin struct {
+	sarama.ClusterAdmin
+
+	client   sarama.Client
+	consumer sarama.Consumer
+
+	// RecordTimeout is a timeout of reading records of all partitions in GroupLag or a record in RecordTimestamp
+	RecordTimeout time.Duration
+}
+
+// PartitionLag is lag of a consumer group in a topic partition.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// Committed is an offset committed by the group, it's -1 if the group has no committed offset
+	Committed int64
+	// LogEnd is an offset of the next produced record
+	LogEnd int64
+	// Lag is a number of records not consumed by the group, it's -1 if the group has no committed offset
+	Lag int64
+	// TimeLag is time since the timestamp of the next record to consume,
+	// it's 0 if there is no lag or the record can't be read
+	TimeLag time.Duration
+	// Member is a client ID and host of the group member consuming the partition, it's empty if unassigned
+	Member string
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// NewAdmin creates a new Admin.
+func NewAdmin(brokers []string, config *sarama.Config) (*Admin, error) {
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAdminFromClient(client)
+}
+
+// NewAdminFromClient creates a new Admin of the client, the client is closed with Admin.
+func NewAdminFromClient(client sarama.Client) (*Admin, error) {
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Admin{ClusterAdmin: admin, client: client, RecordTimeout: DefaultRecordTimeout}, nil
+}
+
+// Close closes the admin and the client.
+func (a *Admin) Close() error {
+	if a.consumer != nil {
+		_ = a.consumer.Close()
+	}
+
+	return a.ClusterAdmin.Close()
+}
+
+// GroupLag returns lag of the consumer group in partitions of topics ordered by topic and partition.
+// Partitions with committed offsets and assigned partitions are returned if topics are empty.
+func (a *Admin) GroupLag(group string, topics []string) ([]PartitionLag, error) {
+	members, err := a.groupMembers(group)
+	if err != nil {
+		return nil, err
+	}
+
+	// all committed offsets are requested without partitions
+	var partitions map[string][]int32
+	if len(topics) > 0 {
+		partitions = make(map[string][]int32, len(topics))
+		for _, topic := range topics {
+			if partitions[topic], err = a.client.Partitions(topic); err != nil {
+				return nil, fmt.Errorf("partitions of %s: %w", topic, err)
+			}
+		}
+	}
+
+	offsets, err := a.ListConsumerGroupOffsets(group, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	if offsets.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("offsets of group %s: %w", group, offsets.Err)
+	}
+
+	committed := make(map[topicPartition]int64)
+	for topic, blocks := range offsets.Blocks {
+		for partition, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("offset of group %s in %s/%d: %w", group, topic, partition, block.Err)
+			}
+
+			committed[topicPartition{topic, partition}] = block.Offset
+		}
+	}
+
+	if len(topics) == 0 {
+		for tp := range members {
+			if _, ok := committed[tp]; !ok {
+				committed[tp] = -1
+			}
+		}
+	}
+
+	logEnds, err := a.logEndOffsets(committed)
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]PartitionLag, 0, len(committed))
+
+	for tp, offset := range committed {
+		lag := PartitionLag{
+			Topic:     tp.topic,
+			Partition: tp.partition,
+			Committed: offset,
+			LogEnd:    logEnds[tp],
+			Lag:       -1,
+			Member:    members[tp],
+		}
+
+		if offset >= 0 {
+			lag.Lag = lag.LogEnd - offset
+			if lag.Lag < 0 {
+				lag.Lag = 0
+			}
+		}
+
+		lags = append(lags, lag)
+	}
+
+	if err := a.readTimeLags(lags); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+
+		return lags[i].Partition < lags[j].Partition
+	})
+
+	return lags, nil
+}
+
+// groupMembers returns members of partitions assigned in the consumer group.
+func (a *Admin) groupMembers(group string) (map[topicPartition]string, error) {
+	groups, err := a.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[topicPartition]string)
+	for _, g := range groups {
+		if g.Err != sarama.ErrNoError {
+			return nil, fmt.Errorf("describe group %s: %w", group, g.Err)
+		}
+
+		for _, m := range g.Members {
+			assignment, err := m.GetMemberAssignment()
+			if err != nil || assignment == nil {
+				continue
+			}
+
+			for topic, partitions := range assignment.Topics {
+				for _, p := range partitions {
+					members[topicPartition{topic, p}] = m.ClientId + "@" + m.ClientHost
+				}
+			}
+		}
+	}
+
+	return members, nil
+}
+
+// logEndOffsets returns log end offsets of partitions with one request to the leader of partitions,
+// partitions failed in requests are requested one by one with refreshing leaders.
+func (a *Admin) logEndOffsets(partitions map[topicPartition]int64) (map[topicPartition]int64, error) {
+	requests := make(map[*sarama.Broker]*sarama.OffsetRequest)
+	requested := make(map[*sarama.Broker][]topicPartition)
+
+	var retry []topicPartition
+
+	for tp := range partitions {
+		broker, err := a.client.Leader(tp.topic, tp.partition)
+		if err != nil {
+			retry = append(retry, tp)
+			continue
+		}
+
+		req, ok := requests[broker]
+		if !ok {
+			req = &sarama.OffsetRequest{}
+			if a.client.Config().Version.IsAtLeast(sarama.V0_10_1_0) {
+				req.Version = 1
+			}
+			requests[broker] = req
+		}
+
+		req.AddBlock(tp.topic, tp.partition, sarama.OffsetNewest, 1)
+		requested[broker] = append(requested[broker], tp)
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		offsets = make(map[topicPartition]int64, len(partitions))
+	)
+
+	for broker, req := range requests {
+		wg.Add(1)
+		go func(broker *sarama.Broker, req *sarama.OffsetRequest) {
+			defer wg.Done()
+
+			resp, err := broker.GetAvailableOffsets(req)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, tp := range requested[broker] {
+				offset, ok := offsetOf(resp, err, tp)
+				if !ok {
+					retry = append(retry, tp)
+					continue
+				}
+
+				offsets[tp] = offset
+			}
+		}(broker, req)
+	}
+
+	wg.Wait()
+
+	for _, tp := range retry {
+		offset, err := a.client.GetOffset(tp.topic, tp.partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("log end offset of %s/%d: %w", tp.topic, tp.partition, err)
+		}
+
+		offsets[tp] = offset
+	}
+
+	return offsets, nil
+}
+
+// offsetOf returns the offset of the partition in the response, ok is false if the request failed.
+func offsetOf(resp *sarama.OffsetResponse, err error, tp topicPartition) (offset int64, ok bool) {
+	if err != nil {
+		return 0, false
+	}
+
+	block := resp.GetBlock(tp.topic, tp.partition)
+	if block == nil || block.Err != sarama.ErrNoError {
+		return 0, false
+	}
+
+	// version 0 responses have offsets
+	if len(block.Offsets) > 0 {
+		return block.Offsets[0], true
+	}
+
+	return block.Offset, true
+}
+
+// readTimeLags sets time lag of lagging partitions reading the next records to consume at once,
+// records not read in RecordTimeout are skipped.
+func (a *Admin) readTimeLags(lags []PartitionLag) error {
+	consumer, err := a.recordConsumer()
+	if err != nil {
+		return err
+	}
+
+	expired := make(chan struct{})
+	timer := time.AfterFunc(a.RecordTimeout, func() { close(expired) })
+	defer timer.Stop()
+
+	var (
+		wg      sync.WaitGroup
+		readers = make(chan struct{}, maxRecordReaders)
+		now     = time.Now()
+	)
+
+	for i := range lags {
+		if lags[i].Lag <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(l *PartitionLag) {
+			defer wg.Done()
+
+			select {
+			case readers <- struct{}{}:
+				defer func() { <-readers }()
+			case <-expired:
+				return
+			}
+
+			ts, err := a.recordTimestamp(consumer, l.Topic, l.Partition, l.Committed, expired)
+			if err == nil && !ts.IsZero() {
+				l.TimeLag = now.Sub(ts)
+			}
+		}(&lags[i])
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// recordConsumer returns the consumer of records, it's created once.
+func (a *Admin) recordConsumer() (sarama.Consumer, error) {
+	if a.consumer == nil {
+		consumer, err := sarama.NewConsumerFromClient(a.client)
+		if err != nil {
+			return nil, err
+		}
+		a.consumer = consumer
+	}
+
+	return a.consumer, nil
+}
+
+// RecordTimestamp returns the timestamp of the record at the offset.
+func (a *Admin) RecordTimestamp(topic string, partition int32, offset int64) (time.Time, error) {
+	consumer, err := a.recordConsumer()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expired := make(chan struct{})
+	timer := time.AfterFunc(a.RecordTimeout, func() { close(expired) })
+	defer timer.Stop()
+
+	return a.recordTimestamp(consumer, topic, partition, offset, expired)
+}
+
+// recordTimestamp returns the timestamp of the record at the offset read until expired is closed.
+func (a *Admin) recordTimestamp(
+	consumer sarama.Consumer, topic string, partition int32, offset int64, expired <-chan struct{},
+) (time.Time, error) {
+	pc, err := consumer.ConsumePartition(topic, partition, offset)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer pc.Close()
+
+	select {
+	case msg := <-pc.Messages():
+		return msg.Timestamp, nil
+	case <-expired:
+		return time.Time{}, fmt.Errorf("no record at offset %d of %s/%d in %s", offset, topic, partition, a.RecordTimeout)
+	}
+}
@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeAssignment encodes member assignment of one topic.
+func encodeAssignment(topic string, partitions ...int32) []byte {
+	b := binary.BigEndian.AppendUint16(nil, 0) // version
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(topic)))
+	b = append(b, topic...)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(partitions)))
+	for _, p := range partitions {
+		b = binary.BigEndian.AppendUint32(b, uint32(p))
+	}
+
+	return binary.BigEndian.AppendUint32(b, 0xffffffff) // no user data
+}
+
+func TestAdmin_GroupLag(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	timestamp := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+
+	fetch := &sarama.FetchResponse{Version: 4}
+	fetch.AddRecordWithTimestamp("test", 0, nil, sarama.StringEncoder("v"), 7, timestamp)
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test", 0, broker.BrokerID()).
+			SetLeader("test", 1, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"DescribeGroupsRequest": sarama.NewMockWrapper(&sarama.DescribeGroupsResponse{
+			Groups: []*sarama.GroupDescription{{
+				GroupId: "group",
+				State:   "Stable",
+				Members: map[string]*sarama.GroupMemberDescription{
+					"m1": {ClientId: "protokaf", ClientHost: "/10.0.0.1", MemberAssignment: encodeAssignment("test", 0, 1)},
+				},
+			}},
+		}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("group", "test", 0, 7, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("test", 0, sarama.OffsetNewest, 10).
+			SetOffset("test", 0, sarama.OffsetOldest, 0).
+			SetOffset("test", 1, sarama.OffsetNewest, 3),
+		"FetchRequest": sarama.NewMockWrapper(fetch),
+	})
+
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+
+	admin, err := NewAdmin([]string{broker.Addr()}, config)
+	require.NoError(t, err)
+	defer admin.Close()
+
+	lags, err := admin.GroupLag("group", nil)
+	require.NoError(t, err)
+	require.Len(t, lags, 2)
+
+	assert.InDelta(t, time.Since(timestamp), lags[0].TimeLag, float64(10*time.Second))
+	lags[0].TimeLag = 0
+
+	assert.Equal(t, []PartitionLag{
+		{Topic: "test", Partition: 0, Committed: 7, LogEnd: 10, Lag: 3, Member: "protokaf@/10.0.0.1"},
+		{Topic: "test", Partition: 1, Committed: -1, LogEnd: 3, Lag: -1, Member: "protokaf@/10.0.0.1"},
+	}, lags)
+}
+
+// newLagMockBroker creates a new broker leading partitions of topic test with the group consuming them.
+func newLagMockBroker(t *testing.T, partitions int32, committed, logEnd int64, fetch *sarama.FetchResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+
+	metadata := sarama.NewMockMetadataResponse(t).
+		SetController(broker.BrokerID()).
+		SetBroker(broker.Addr(), broker.BrokerID())
+	offsetFetch := sarama.NewMockOffsetFetchResponse(t)
+	offsets := sarama.NewMockOffsetResponse(t).SetVersion(1)
+
+	for p := int32(0); p < partitions; p++ {
+		metadata.SetLeader("test", p, broker.BrokerID())
+		offsetFetch.SetOffset("group", "test", p, committed, "", sarama.ErrNoError)
+		offsets.SetOffset("test", p, sarama.OffsetNewest, logEnd).SetOffset("test", p, sarama.OffsetOldest, 0)
+	}
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "group", broker),
+		"DescribeGroupsRequest": sarama.NewMockWrapper(&sarama.DescribeGroupsResponse{
+			Groups: []*sarama.GroupDescription{{GroupId: "group", State: "Empty"}},
+		}),
+		"OffsetFetchRequest": offsetFetch,
+		"OffsetRequest":      offsets,
+		"FetchRequest":       sarama.NewMockWrapper(fetch),
+	})
+
+	return broker
+}
+
+func TestAdmin_GroupLag_OneOffsetRequest(t *testing.T) {
+	broker := newLagMockBroker(t, 3, 5, 5, &sarama.FetchResponse{Version: 4})
+	defer broker.Close()
+
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+
+	admin, err := NewAdmin([]string{broker.Addr()}, config)
+	require.NoError(t, err)
+	defer admin.Close()
+
+	lags, err := admin.GroupLag("group", []string{"test"})
+	require.NoError(t, err)
+	require.Len(t, lags, 3)
+
+	// log end offsets of partitions of the broker are requested at once
+	requests := 0
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.OffsetRequest); ok {
+			requests++
+		}
+	}
+	assert.Equal(t, 1, requests)
+}
+
+func TestAdmin_GroupLag_RecordTimeout(t *testing.T) {
+	// records are never fetched
+	broker := newLagMockBroker(t, 4, 5, 10, &sarama.FetchResponse{Version: 4})
+	defer broker.Close()
+
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+
+	admin, err := NewAdmin([]string{broker.Addr()}, config)
+	require.NoError(t, err)
+	defer admin.Close()
+
+	admin.RecordTimeout = 300 * time.Millisecond
+
+	// records of partitions are read at once until the same deadline
+	start := time.Now()
+	lags, err := admin.GroupLag("group", []string{"test"})
+	require.NoError(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(2*admin.RecordTimeout))
+
+	require.Len(t, lags, 4)
+	for _, l := range lags {
+		assert.Equal(t, int64(5), l.Lag)
+		assert.Zero(t, l.TimeLag)
+	}
+}
@@ -40,5 +40,10 @@ func (c *ConsumerGroup) Consume(ctx context.Context, topics []string, handler sa
 		if err := c.client.Consume(ctx, topics, handler); err != nil {
 			return err
 		}
+
+		// stop after cancel instead of joining the group again
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 	}
 }
@@ -6,9 +6,18 @@ import (
 	"github.com/Shopify/sarama"
 )
 
-func NewConfig(appName string, authDSN string) (*sarama.Config, error) {
+func NewConfig(appName string, authDSN string, version string) (*sarama.Config, error) {
+	if version == "" {
+		version = DefaultVersion
+	}
+
+	kafkaVersion, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
 	config := sarama.NewConfig()
-	config.Version = sarama.V0_11_0_0 // 0.11 - min version for support record headers
+	config.Version = kafkaVersion
 	config.ClientID = appName
 	config.Consumer.Return.Errors = true
 	config.Producer.Return.Successes = true
@@ -2,57 +2,172 @@ package kafka
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Shopify/sarama"
 )
 
 // Producer kafka producer.
+// Many messages may be in flight at once, results are delivered to the caller
+// of each message by tracking it through ProducerMessage.Metadata.
 type Producer struct {
 	client sarama.AsyncProducer
+	closer io.Closer
+	done   chan struct{}
+	once   sync.Once
+
+	// errors of messages delivered after Close is called or without a sender,
+	// they are written by dispatch and read after done is closed.
+	closing  atomic.Bool
+	errs     sarama.ProducerErrors
+	closeErr error
+}
+
+// inFlight is stored in ProducerMessage.Metadata while message is produced.
+type inFlight struct {
+	result   chan error
+	metadata interface{}
 }
 
 // NewProducer creates a new Producer using the given broker addresses and configuration.
+// Config must have Producer.Return.Successes and Producer.Return.Errors enabled.
 func NewProducer(brokers []string, config *sarama.Config) (*Producer, error) {
-	client, err := sarama.NewAsyncProducer(brokers, config)
+	// async producer doesn't return the error of closing its own client, so client is closed by Producer
+	client, err := sarama.NewClient(brokers, config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Producer{client}, nil
+	producer, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	p := NewProducerFromClient(producer)
+	p.closer = client
+
+	return p, nil
 }
 
-// SendMessage produces a given message, and returns only when it either has
-// succeeded or failed to produce. It will return the partition and the offset
-// of the produced message, or an error if the message failed to produce.
-func (p *Producer) SendMessage(ctx context.Context, msg *sarama.ProducerMessage) error {
-	errs := make(chan error)
+// NewProducerFromClient creates a new Producer using the given async producer.
+func NewProducerFromClient(client sarama.AsyncProducer) *Producer {
+	p := &Producer{
+		client: client,
+		done:   make(chan struct{}),
+	}
+	go p.dispatch()
 
-	go func() {
-		select {
-		case p.client.Input() <- msg:
-		case <-ctx.Done():
-			errs <- ctx.Err()
-		}
-	}()
+	return p
+}
+
+// dispatch delivers successes and errors to senders of messages.
+func (p *Producer) dispatch() {
+	defer close(p.done)
 
-	go func() {
+	successes, errs := p.client.Successes(), p.client.Errors()
+	for successes != nil || errs != nil {
 		select {
-		case err := <-p.client.Errors():
-			errs <- err
+		case m, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
 
-		case m := <-p.client.Successes():
-			*msg = *m
-			errs <- nil
+			resolve(m, nil)
+
+		case pe, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+
+			if !resolve(pe.Msg, pe.Err) || p.closing.Load() {
+				p.errs = append(p.errs, pe)
+			}
 		}
-	}()
+	}
+}
+
+// resolve delivers the result to the sender of message, it returns false if message has no sender.
+func resolve(msg *sarama.ProducerMessage, err error) bool {
+	f, ok := msg.Metadata.(*inFlight)
+	if !ok {
+		return false
+	}
+
+	msg.Metadata = f.metadata
+	f.result <- err
+
+	return true
+}
+
+// Send passes message to the producer without waiting for the result.
+// Returned channel receives the result of producing: nil or an error.
+// Partition and offset of the message are set when result is received.
+func (p *Producer) Send(ctx context.Context, msg *sarama.ProducerMessage) <-chan error {
+	result := make(chan error, 1)
+	if err := ctx.Err(); err != nil {
+		result <- err
+		return result
+	}
+
+	msg.Metadata = &inFlight{
+		result:   result,
+		metadata: msg.Metadata,
+	}
+
+	select {
+	case p.client.Input() <- msg:
+	case <-ctx.Done():
+		msg.Metadata = msg.Metadata.(*inFlight).metadata
+		result <- ctx.Err()
+	}
+
+	return result
+}
 
-	return <-errs
+// SendMessage produces a given message, and returns only when it either has
+// succeeded or failed to produce. It will return the partition and the offset
+// of the produced message, or an error if the message failed to produce.
+func (p *Producer) SendMessage(ctx context.Context, msg *sarama.ProducerMessage) error {
+	select {
+	case err := <-p.Send(ctx, msg):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Close shuts down the producer and waits for any buffered messages to be
 // flushed. You must call this function before a producer object passes out of
 // scope, as it may otherwise leak memory. You must call this before calling
 // Close on the underlying client.
+// It returns errors of messages failed while flushing and the error of closing the client.
 func (p *Producer) Close() error {
-	return p.client.Close()
+	p.once.Do(func() {
+		p.closing.Store(true)
+		p.client.AsyncClose()
+		<-p.done
+
+		if len(p.errs) > 0 {
+			p.closeErr = p.errs
+		}
+
+		if p.closer != nil {
+			if err := p.closer.Close(); err != nil {
+				if p.closeErr != nil {
+					p.closeErr = fmt.Errorf("%w, close client: %s", p.closeErr, err)
+				} else {
+					p.closeErr = fmt.Errorf("close client: %w", err)
+				}
+			}
+		}
+	})
+	<-p.done
+
+	return p.closeErr
 }
@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// DefaultVersion is the min version for support record headers.
+const DefaultVersion = "0.11.0.0"
+
+var acksValues = map[string]sarama.RequiredAcks{
+	"none":   sarama.NoResponse,
+	"0":      sarama.NoResponse,
+	"leader": sarama.WaitForLocal,
+	"1":      sarama.WaitForLocal,
+	"all":    sarama.WaitForAll,
+	"-1":     sarama.WaitForAll,
+}
+
+var compressionValues = map[string]sarama.CompressionCodec{
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+var (
+	ErrIdempotentAcks            = errors.New("idempotent producer requires acks=all")
+	ErrIdempotentMaxOpenRequests = errors.New("idempotent producer requires max open requests to be 1")
+	ErrIdempotentRetries         = errors.New("idempotent producer requires at least one retry")
+)
+
+// ProducerOptions are tuning options of producer.
+type ProducerOptions struct {
+	// Acks is one of none (0), leader (1), all (-1).
+	Acks string
+	// Compression is one of none, gzip, snappy, lz4, zstd.
+	Compression      string
+	CompressionLevel int
+	Idempotent       bool
+	MaxOpenRequests  int
+	MaxMessageBytes  int
+	Retries          int
+	RetryBackoff     time.Duration
+
+	FlushBytes       int
+	FlushMessages    int
+	FlushFrequency   time.Duration
+	FlushMaxMessages int
+}
+
+// Apply sets options to config and checks the result.
+func (o ProducerOptions) Apply(config *sarama.Config) error {
+	acks, ok := acksValues[strings.ToLower(o.Acks)]
+	if !ok {
+		return fmt.Errorf("invalid acks value: %s, use one of none, leader, all", o.Acks)
+	}
+
+	compression, ok := compressionValues[strings.ToLower(o.Compression)]
+	if !ok {
+		return fmt.Errorf("invalid compression value: %s, use one of none, gzip, snappy, lz4, zstd", o.Compression)
+	}
+
+	if o.Idempotent {
+		switch {
+		case acks != sarama.WaitForAll:
+			return ErrIdempotentAcks
+		case o.MaxOpenRequests != 1:
+			return ErrIdempotentMaxOpenRequests
+		case o.Retries < 1:
+			return ErrIdempotentRetries
+		}
+	}
+
+	config.Producer.RequiredAcks = acks
+	config.Producer.Compression = compression
+	config.Producer.CompressionLevel = o.CompressionLevel
+	config.Producer.Idempotent = o.Idempotent
+	config.Net.MaxOpenRequests = o.MaxOpenRequests
+	config.Producer.MaxMessageBytes = o.MaxMessageBytes
+	config.Producer.Retry.Max = o.Retries
+	config.Producer.Retry.Backoff = o.RetryBackoff
+	config.Producer.Flush.Bytes = o.FlushBytes
+	config.Producer.Flush.Messages = o.FlushMessages
+	config.Producer.Flush.Frequency = o.FlushFrequency
+	config.Producer.Flush.MaxMessages = o.FlushMaxMessages
+
+	return config.Validate()
+}
+
+// AcksString returns a name of acks value.
+func AcksString(acks sarama.RequiredAcks) string {
+	switch acks {
+	case sarama.NoResponse:
+		return "none"
+	case sarama.WaitForLocal:
+		return "leader"
+	case sarama.WaitForAll:
+		return "all"
+	}
+
+	return fmt.Sprint(int16(acks))
+}
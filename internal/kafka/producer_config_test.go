@@ -0,0 +1,105 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProducerOptions_Apply(t *testing.T) {
+	valid := func() ProducerOptions {
+		return ProducerOptions{
+			Acks:             "all",
+			Compression:      "lz4",
+			CompressionLevel: sarama.CompressionLevelDefault,
+			Idempotent:       true,
+			MaxOpenRequests:  1,
+			MaxMessageBytes:  2000000,
+			Retries:          5,
+			RetryBackoff:     time.Second,
+			FlushBytes:       1024,
+			FlushMessages:    10,
+			FlushFrequency:   time.Millisecond,
+			FlushMaxMessages: 100,
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		config, err := NewConfig("test", "", "")
+		require.NoError(t, err)
+		require.NoError(t, valid().Apply(config))
+
+		assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+		assert.Equal(t, sarama.CompressionLZ4, config.Producer.Compression)
+		assert.True(t, config.Producer.Idempotent)
+		assert.Equal(t, 1, config.Net.MaxOpenRequests)
+		assert.Equal(t, 2000000, config.Producer.MaxMessageBytes)
+		assert.Equal(t, 5, config.Producer.Retry.Max)
+		assert.Equal(t, time.Second, config.Producer.Retry.Backoff)
+		assert.Equal(t, 1024, config.Producer.Flush.Bytes)
+		assert.Equal(t, 10, config.Producer.Flush.Messages)
+		assert.Equal(t, time.Millisecond, config.Producer.Flush.Frequency)
+		assert.Equal(t, 100, config.Producer.Flush.MaxMessages)
+	})
+
+	tests := []struct {
+		name    string
+		modify  func(o *ProducerOptions)
+		wantErr error
+	}{
+		{"idempotent acks", func(o *ProducerOptions) { o.Acks = "leader" }, ErrIdempotentAcks},
+		{"idempotent open requests", func(o *ProducerOptions) { o.MaxOpenRequests = 5 }, ErrIdempotentMaxOpenRequests},
+		{"idempotent retries", func(o *ProducerOptions) { o.Retries = 0 }, ErrIdempotentRetries},
+		{"invalid acks", func(o *ProducerOptions) { o.Acks = "2" }, nil},
+		{"invalid compression", func(o *ProducerOptions) { o.Compression = "brotli" }, nil},
+		{"zstd requires version", func(o *ProducerOptions) { o.Compression = "zstd" }, nil},
+		{"invalid gzip level", func(o *ProducerOptions) {
+			o.Compression = "gzip"
+			o.CompressionLevel = 20
+		}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewConfig("test", "", "")
+			require.NoError(t, err)
+
+			o := valid()
+			tt.modify(&o)
+
+			err = o.Apply(config)
+			require.Error(t, err)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("zstd with version", func(t *testing.T) {
+		config, err := NewConfig("test", "", "2.1.0")
+		require.NoError(t, err)
+
+		o := valid()
+		o.Compression = "ZSTD"
+		assert.NoError(t, o.Apply(config))
+	})
+}
+
+func TestNewConfig_Version(t *testing.T) {
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, sarama.V0_11_0_0, config.Version)
+
+	_, err = NewConfig("test", "", "not-a-version")
+	assert.Error(t, err)
+}
+
+func TestAcksString(t *testing.T) {
+	assert.Equal(t, "none", AcksString(sarama.NoResponse))
+	assert.Equal(t, "leader", AcksString(sarama.WaitForLocal))
+	assert.Equal(t, "all", AcksString(sarama.WaitForAll))
+	assert.Equal(t, "2", AcksString(sarama.RequiredAcks(2)))
+}
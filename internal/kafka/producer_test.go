@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducer_Send(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	client := mocks.NewAsyncProducer(t, config)
+	client.ExpectInputAndSucceed()
+	client.ExpectInputAndFail(errFailed)
+	client.ExpectInputAndSucceed()
+
+	p := NewProducerFromClient(client)
+
+	ctx := context.Background()
+	msgs := make([]*sarama.ProducerMessage, 0, 3)
+	results := make([]<-chan error, 0, 3)
+
+	for i := 0; i < 3; i++ {
+		msg := &sarama.ProducerMessage{Topic: "test", Value: sarama.StringEncoder("data"), Metadata: i}
+		msgs = append(msgs, msg)
+		results = append(results, p.Send(ctx, msg))
+	}
+
+	assert.Nil(t, <-results[2])
+	assert.ErrorIs(t, <-results[1], errFailed)
+	assert.Nil(t, <-results[0])
+
+	for i, msg := range msgs {
+		assert.Equal(t, i, msg.Metadata)
+	}
+
+	assert.Nil(t, p.Close())
+}
+
+func TestProducer_SendMessage_Canceled(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	p := NewProducerFromClient(mocks.NewAsyncProducer(t, config))
+	defer p.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := p.SendMessage(ctx, &sarama.ProducerMessage{Topic: "test"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+type errCloser struct{ err error }
+
+func (c errCloser) Close() error { return c.err }
+
+func TestProducer_Close_Errors(t *testing.T) {
+	errFailed := errors.New("failed")
+	errClosed := errors.New("closed")
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+
+	client := mocks.NewAsyncProducer(t, config)
+	client.ExpectInputAndFail(errFailed)
+
+	p := NewProducerFromClient(client)
+	p.closer = errCloser{errClosed}
+
+	// message without a sender is failed while flushing
+	client.Input() <- &sarama.ProducerMessage{Topic: "test", Value: sarama.StringEncoder("data")}
+
+	err := p.Close()
+
+	var errs sarama.ProducerErrors
+	assert.ErrorAs(t, err, &errs)
+	if assert.Len(t, errs, 1) {
+		assert.ErrorIs(t, errs[0].Err, errFailed)
+	}
+	assert.EqualError(t, err, "kafka: Failed to deliver 1 messages., close client: closed")
+
+	// result of close is kept
+	assert.Equal(t, err, p.Close())
+}
+
+func TestProducer_Close_ClientError(t *testing.T) {
+	errClosed := errors.New("closed")
+
+	p := NewProducerFromClient(mocks.NewAsyncProducer(t, sarama.NewConfig()))
+	p.closer = errCloser{errClosed}
+
+	assert.ErrorIs(t, p.Close(), errClosed)
+}
@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// Record is a record with metadata, it's encoded in JSON to capture and replay topic data.
+// Key, header values and value are encoded in base64.
+type Record struct {
+	Topic     string         `json:"topic"`
+	Partition int32          `json:"partition"`
+	Offset    int64          `json:"offset"`
+	Timestamp time.Time      `json:"timestamp"`
+	Key       []byte         `json:"key"`
+	Headers   []RecordHeader `json:"headers,omitempty"`
+	// Value is nil for tombstones
+	Value []byte `json:"value"`
+	// TraceID is an ID of the trace continued by the consumer span of the record, it isn't replayed
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// RecordHeader is a header of Record.
+type RecordHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// NewRecordFromConsumerMessage creates a new Record of the consumed message.
+func NewRecordFromConsumerMessage(msg *sarama.ConsumerMessage) Record {
+	r := Record{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+		Key:       msg.Key,
+		Value:     msg.Value,
+	}
+
+	for _, h := range msg.Headers {
+		r.Headers = append(r.Headers, RecordHeader{Key: string(h.Key), Value: h.Value})
+	}
+
+	return r
+}
+
+// NewRecordFromProducerMessage creates a new Record of the produced message.
+func NewRecordFromProducerMessage(msg *sarama.ProducerMessage) (Record, error) {
+	r := Record{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Timestamp: msg.Timestamp,
+	}
+
+	var err error
+	if msg.Key != nil {
+		if r.Key, err = msg.Key.Encode(); err != nil {
+			return Record{}, err
+		}
+	}
+
+	if msg.Value != nil {
+		if r.Value, err = msg.Value.Encode(); err != nil {
+			return Record{}, err
+		}
+	}
+
+	for _, h := range msg.Headers {
+		r.Headers = append(r.Headers, RecordHeader{Key: string(h.Key), Value: h.Value})
+	}
+
+	return r, nil
+}
+
+// ProducerMessage returns message to produce the record again.
+func (r Record) ProducerMessage() *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Timestamp: r.Timestamp,
+	}
+
+	if r.Key != nil {
+		msg.Key = sarama.ByteEncoder(r.Key)
+	}
+
+	if r.Value != nil {
+		msg.Value = sarama.ByteEncoder(r.Value)
+	}
+
+	for _, h := range r.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(h.Key), Value: h.Value})
+	}
+
+	return msg
+}
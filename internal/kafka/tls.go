@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/sarama"
+)
+
+// TLSOptions are options of TLS connections to brokers.
+type TLSOptions struct {
+	Enable bool
+	// CAFile is PEM file of certificate authorities, system ones are used if empty
+	CAFile string
+	// CertFile and KeyFile are PEM files of client certificate
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// Apply enables TLS in the config if options are enabled.
+func (o TLSOptions) Apply(config *sarama.Config) error {
+	if !o.Enable {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify, //nolint:gosec // verification is disabled on purpose
+	}
+
+	if o.CAFile != "" {
+		data, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in %s", o.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return errors.New("client certificate requires both cert and key files")
+	}
+
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	config.Net.TLS.Enable = true
+	config.Net.TLS.Config = tlsConfig
+
+	return nil
+}
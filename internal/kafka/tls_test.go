@@ -0,0 +1,30 @@
+package kafka
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSOptions_Apply(t *testing.T) {
+	config := sarama.NewConfig()
+	require.NoError(t, TLSOptions{}.Apply(config))
+	assert.False(t, config.Net.TLS.Enable)
+
+	require.NoError(t, TLSOptions{Enable: true, InsecureSkipVerify: true}.Apply(config))
+	assert.True(t, config.Net.TLS.Enable)
+	assert.True(t, config.Net.TLS.Config.InsecureSkipVerify)
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, []byte("not a certificate"), 0o600))
+
+	err := TLSOptions{Enable: true, CAFile: ca}.Apply(sarama.NewConfig())
+	assert.EqualError(t, err, "no certificates in "+ca)
+
+	err = TLSOptions{Enable: true, CertFile: "client.pem"}.Apply(sarama.NewConfig())
+	assert.EqualError(t, err, "client certificate requires both cert and key files")
+}
@@ -0,0 +1,30 @@
+package kafka
+
+import "github.com/Shopify/sarama"
+
+const (
+	// TopicConfigTimestampType is a topic config entry of record timestamps type.
+	TopicConfigTimestampType = "message.timestamp.type"
+
+	// TimestampTypeLogAppendTime is a type of timestamps set by broker.
+	TimestampTypeLogAppendTime = "LogAppendTime"
+)
+
+// TopicConfig returns values of topic config entries by names, all entries are returned if names are empty.
+func TopicConfig(admin sarama.ClusterAdmin, topic string, names ...string) (map[string]string, error) {
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{
+		Type:        sarama.TopicResource,
+		Name:        topic,
+		ConfigNames: names,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(entries))
+	for _, e := range entries {
+		result[e.Name] = e.Value
+	}
+
+	return result, nil
+}
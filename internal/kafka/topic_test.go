@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicConfig(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()),
+		"DescribeConfigsRequest": sarama.NewMockWrapper(&sarama.DescribeConfigsResponse{
+			Resources: []*sarama.ResourceResponse{{
+				Type: sarama.TopicResource,
+				Name: "test",
+				Configs: []*sarama.ConfigEntry{
+					{Name: TopicConfigTimestampType, Value: TimestampTypeLogAppendTime},
+				},
+			}},
+		}),
+	})
+
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+
+	admin, err := sarama.NewClusterAdmin([]string{broker.Addr()}, config)
+	require.NoError(t, err)
+	defer admin.Close()
+
+	values, err := TopicConfig(admin, "test", TopicConfigTimestampType)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{TopicConfigTimestampType: TimestampTypeLogAppendTime}, values)
+}
@@ -0,0 +1,580 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// transactionTimeout is the max time of transaction before broker aborts it.
+const transactionTimeout = time.Minute
+
+var ErrTransactionsUnsupported = errors.New("transactions require kafka version 0.11.0.0 or later")
+
+// TransactionalProducer produces batches of messages in transactions.
+// Sarama producer doesn't support transactions, so the requests are sent
+// to the transaction coordinator and partition leaders directly.
+// TransactionalProducer is not safe for concurrent use.
+type TransactionalProducer struct {
+	client      sarama.Client
+	ownClient   bool
+	config      *sarama.Config
+	id          string
+	coordinator *sarama.Broker
+	producerID  int64
+	epoch       int16
+	sequences   map[string]map[int32]int32
+	partitioner map[string]sarama.Partitioner
+}
+
+// NewTransactionalProducer creates a new TransactionalProducer with the given transactional id.
+func NewTransactionalProducer(brokers []string, config *sarama.Config, transactionalID string) (*TransactionalProducer, error) {
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := NewTransactionalProducerFromClient(client, transactionalID)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	p.ownClient = true
+
+	return p, nil
+}
+
+// NewTransactionalProducerFromClient creates a new TransactionalProducer using the given client.
+// Producer id is initialized, so unfinished transactions of the previous producer
+// with the same transactional id are aborted.
+func NewTransactionalProducerFromClient(client sarama.Client, transactionalID string) (*TransactionalProducer, error) {
+	config := client.Config()
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return nil, ErrTransactionsUnsupported
+	}
+
+	p := &TransactionalProducer{
+		client:      client,
+		config:      config,
+		id:          transactionalID,
+		sequences:   make(map[string]map[int32]int32),
+		partitioner: make(map[string]sarama.Partitioner),
+	}
+
+	if err := p.findCoordinator(); err != nil {
+		return nil, err
+	}
+
+	if err := p.initProducerID(); err != nil {
+		p.coordinator.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// findCoordinator connects to the transaction coordinator, it's repeated while coordinator isn't available.
+func (p *TransactionalProducer) findCoordinator() error {
+	for attempt := 0; ; attempt++ {
+		brokers := p.client.Brokers()
+		if len(brokers) == 0 {
+			return sarama.ErrOutOfBrokers
+		}
+
+		broker := brokers[0]
+		if ok, _ := broker.Connected(); !ok {
+			if err := broker.Open(p.config); err != nil && !errors.Is(err, sarama.ErrAlreadyConnected) {
+				return err
+			}
+		}
+
+		res, err := broker.FindCoordinator(&sarama.FindCoordinatorRequest{
+			Version:         1,
+			CoordinatorKey:  p.id,
+			CoordinatorType: sarama.CoordinatorTransaction,
+		})
+		if err != nil {
+			return err
+		}
+
+		switch res.Err {
+		case sarama.ErrNoError:
+			p.coordinator = sarama.NewBroker(res.Coordinator.Addr())
+			return p.coordinator.Open(p.config)
+		case sarama.ErrConsumerCoordinatorNotAvailable, sarama.ErrOffsetsLoadInProgress:
+			if attempt < p.config.Producer.Retry.Max {
+				time.Sleep(p.config.Producer.Retry.Backoff)
+				continue
+			}
+		}
+
+		return fmt.Errorf("find transaction coordinator: %w", res.Err)
+	}
+}
+
+// refreshCoordinator reconnects to the transaction coordinator which may have moved to another broker.
+// Client.RefreshCoordinator looks up coordinators of consumer groups only, so it isn't used.
+func (p *TransactionalProducer) refreshCoordinator() error {
+	_ = p.coordinator.Close()
+
+	return p.findCoordinator()
+}
+
+func (p *TransactionalProducer) initProducerID() error {
+	return p.retry(func() (sarama.KError, error) {
+		res, err := p.coordinator.InitProducerID(&sarama.InitProducerIDRequest{
+			TransactionalID:    &p.id,
+			TransactionTimeout: transactionTimeout,
+		})
+		if err != nil {
+			return sarama.ErrNoError, err
+		}
+
+		p.producerID, p.epoch = res.ProducerID, res.ProducerEpoch
+
+		return res.Err, nil
+	})
+}
+
+// resetProducerID bumps the epoch of the producer id, sequences start from zero with a new epoch.
+func (p *TransactionalProducer) resetProducerID() error {
+	if err := p.initProducerID(); err != nil {
+		return err
+	}
+
+	p.sequences = make(map[string]map[int32]int32)
+
+	return nil
+}
+
+// SendBatch produces messages in one transaction, then commits or aborts it.
+// Partition and offset of every message are set when SendBatch returns.
+// If producing fails, the transaction is aborted.
+func (p *TransactionalProducer) SendBatch(msgs []*sarama.ProducerMessage, commit bool) error {
+	partitions := make(map[string][]int32)
+	for _, msg := range msgs {
+		if err := p.partition(msg); err != nil {
+			return err
+		}
+
+		if !containsPartition(partitions[msg.Topic], msg.Partition) {
+			partitions[msg.Topic] = append(partitions[msg.Topic], msg.Partition)
+		}
+	}
+
+	if err := p.addPartitions(partitions); err != nil {
+		return err
+	}
+
+	if err := p.produce(msgs); err != nil {
+		// batches of failed requests may be written or not, so sequences are reset with a new epoch
+		if endErr := p.endTransaction(false); endErr != nil {
+			return fmt.Errorf("%w (abort transaction: %s)", err, endErr)
+		}
+
+		if initErr := p.resetProducerID(); initErr != nil {
+			return fmt.Errorf("%w (init producer id: %s)", err, initErr)
+		}
+
+		return err
+	}
+
+	return p.endTransaction(commit)
+}
+
+func (p *TransactionalProducer) partition(msg *sarama.ProducerMessage) error {
+	partitioner, ok := p.partitioner[msg.Topic]
+	if !ok {
+		partitioner = p.config.Producer.Partitioner(msg.Topic)
+		p.partitioner[msg.Topic] = partitioner
+	}
+
+	partitions, err := p.client.Partitions(msg.Topic)
+	if err != nil {
+		return err
+	}
+
+	if len(partitions) == 0 {
+		return sarama.ErrLeaderNotAvailable
+	}
+
+	choice, err := partitioner.Partition(msg, int32(len(partitions)))
+	if err != nil {
+		return err
+	}
+
+	if choice < 0 || choice >= int32(len(partitions)) {
+		return sarama.ErrInvalidPartition
+	}
+
+	msg.Partition = partitions[choice]
+
+	return nil
+}
+
+func (p *TransactionalProducer) addPartitions(partitions map[string][]int32) error {
+	return p.retry(func() (sarama.KError, error) {
+		res, err := p.coordinator.AddPartitionsToTxn(&sarama.AddPartitionsToTxnRequest{
+			TransactionalID: p.id,
+			ProducerID:      p.producerID,
+			ProducerEpoch:   p.epoch,
+			TopicPartitions: partitions,
+		})
+		if err != nil {
+			return sarama.ErrNoError, err
+		}
+
+		for _, errs := range res.Errors {
+			for _, e := range errs {
+				if e.Err != sarama.ErrNoError {
+					return e.Err, nil
+				}
+			}
+		}
+
+		return sarama.ErrNoError, nil
+	})
+}
+
+// produce sends requests with record batches to every leader. Batches are limited by
+// Producer.MaxMessageBytes and Flush.MaxMessages, so a request has at most one batch of a partition
+// and batches of a partition are sent one request after another.
+// Batches rejected by a former leader are sent again to the new one after metadata is refreshed.
+func (p *TransactionalProducer) produce(msgs []*sarama.ProducerMessage) error {
+	now := time.Now()
+
+	var (
+		pending []*partitionBatches
+		index   = make(map[string]map[int32]*partitionBatches)
+	)
+
+	for _, msg := range msgs {
+		if index[msg.Topic] == nil {
+			index[msg.Topic] = make(map[int32]*partitionBatches)
+		}
+
+		pb := index[msg.Topic][msg.Partition]
+		if pb == nil {
+			pb = &partitionBatches{topic: msg.Topic, partition: msg.Partition}
+			index[msg.Topic][msg.Partition] = pb
+			pending = append(pending, pb)
+		}
+
+		ts := messageTimestamp(msg, now)
+
+		var b *recordBatch
+		if n := len(pb.batches); n > 0 {
+			b = pb.batches[n-1]
+		}
+
+		if b == nil {
+			b = p.newRecordBatch(ts)
+			pb.batches = append(pb.batches, b)
+		}
+
+		record, err := newRecord(msg, ts, b.records.FirstTimestamp)
+		if err != nil {
+			return err
+		}
+
+		if b.full(record, p.config) {
+			b = p.newRecordBatch(ts)
+			pb.batches = append(pb.batches, b)
+
+			record.TimestampDelta = 0
+		}
+
+		b.add(record, msg, ts)
+	}
+
+	for attempt := 0; len(pending) > 0; {
+		var (
+			leaders    []*sarama.Broker
+			partitions = make(map[*sarama.Broker][]*partitionBatches)
+		)
+
+		for _, pb := range pending {
+			leader, err := p.client.Leader(pb.topic, pb.partition)
+			if err != nil {
+				return err
+			}
+
+			if partitions[leader] == nil {
+				leaders = append(leaders, leader)
+			}
+			partitions[leader] = append(partitions[leader], pb)
+		}
+
+		var (
+			next      []*partitionBatches
+			moved     []string
+			leaderErr error
+		)
+
+		for _, leader := range leaders {
+			req := &sarama.ProduceRequest{
+				TransactionalID: &p.id,
+				RequiredAcks:    sarama.WaitForAll,
+				Timeout:         int32(p.config.Producer.Timeout / time.Millisecond),
+				Version:         3,
+			}
+
+			for _, pb := range partitions[leader] {
+				b := pb.batches[pb.sent]
+				b.records.FirstSequence = p.sequence(pb.topic, pb.partition)
+				req.AddBatch(pb.topic, pb.partition, b.records)
+			}
+
+			res, err := leader.Produce(req)
+			if err != nil {
+				return err
+			}
+
+			for _, pb := range partitions[leader] {
+				block := res.GetBlock(pb.topic, pb.partition)
+				if block == nil {
+					return sarama.ErrIncompleteResponse
+				}
+
+				switch block.Err {
+				case sarama.ErrNoError:
+				case sarama.ErrNotLeaderForPartition, sarama.ErrLeaderNotAvailable:
+					// batch isn't written, so it's sent again with the same sequence
+					next = append(next, pb)
+					moved = append(moved, pb.topic)
+					leaderErr = block.Err
+					continue
+				default:
+					return block.Err
+				}
+
+				b := pb.batches[pb.sent]
+				p.advanceSequence(pb.topic, pb.partition, len(b.msgs))
+
+				for i, msg := range b.msgs {
+					msg.Offset = block.Offset + int64(i)
+				}
+
+				if pb.sent++; pb.sent < len(pb.batches) {
+					next = append(next, pb)
+				}
+			}
+		}
+
+		if len(moved) > 0 {
+			if attempt >= p.config.Producer.Retry.Max {
+				return leaderErr
+			}
+			attempt++
+
+			time.Sleep(p.config.Producer.Retry.Backoff)
+
+			if err := p.client.RefreshMetadata(moved...); err != nil {
+				return err
+			}
+		}
+
+		pending = next
+	}
+
+	return nil
+}
+
+// partitionBatches are record batches of a partition, sent is the number of batches written.
+type partitionBatches struct {
+	topic     string
+	partition int32
+	batches   []*recordBatch
+	sent      int
+}
+
+const (
+	// recordBatchOverhead is the size of record batch header.
+	recordBatchOverhead = 61
+	// recordOverhead is the max size of record fields except key, value and headers.
+	recordOverhead = 5*binary.MaxVarintLen32 + binary.MaxVarintLen64 + 1
+)
+
+// recordBatch is a record batch of a partition with messages of its records.
+type recordBatch struct {
+	records *sarama.RecordBatch
+	msgs    []*sarama.ProducerMessage
+	size    int
+}
+
+func (p *TransactionalProducer) newRecordBatch(ts time.Time) *recordBatch {
+	return &recordBatch{
+		records: &sarama.RecordBatch{
+			Version:          2,
+			FirstTimestamp:   ts,
+			MaxTimestamp:     ts,
+			Codec:            p.config.Producer.Compression,
+			CompressionLevel: p.config.Producer.CompressionLevel,
+			ProducerID:       p.producerID,
+			ProducerEpoch:    p.epoch,
+			IsTransactional:  true,
+		},
+		size: recordBatchOverhead,
+	}
+}
+
+// full reports whether the record can't be added to the non-empty batch
+// without exceeding max message bytes or max messages of flush.
+func (b *recordBatch) full(record *sarama.Record, config *sarama.Config) bool {
+	if len(b.msgs) == 0 {
+		return false
+	}
+
+	if max := config.Producer.Flush.MaxMessages; max > 0 && len(b.msgs) >= max {
+		return true
+	}
+
+	return b.size+recordSize(record) > config.Producer.MaxMessageBytes
+}
+
+func (b *recordBatch) add(record *sarama.Record, msg *sarama.ProducerMessage, ts time.Time) {
+	if ts.After(b.records.MaxTimestamp) {
+		b.records.MaxTimestamp = ts
+	}
+
+	record.OffsetDelta = int64(len(b.records.Records))
+	b.records.Records = append(b.records.Records, record)
+	b.records.LastOffsetDelta = int32(record.OffsetDelta)
+	b.msgs = append(b.msgs, msg)
+	b.size += recordSize(record)
+}
+
+// recordSize returns the max encoded size of the record.
+func recordSize(record *sarama.Record) int {
+	size := recordOverhead + len(record.Key) + len(record.Value)
+	for _, h := range record.Headers {
+		size += len(h.Key) + len(h.Value) + 2*binary.MaxVarintLen32
+	}
+
+	return size
+}
+
+// sequence returns the sequence of the next record of the partition.
+func (p *TransactionalProducer) sequence(topic string, partition int32) int32 {
+	return p.sequences[topic][partition]
+}
+
+// advanceSequence reserves n records produced to the partition.
+func (p *TransactionalProducer) advanceSequence(topic string, partition int32, n int) {
+	if p.sequences[topic] == nil {
+		p.sequences[topic] = make(map[int32]int32)
+	}
+
+	p.sequences[topic][partition] += int32(n)
+}
+
+func (p *TransactionalProducer) endTransaction(commit bool) error {
+	return p.retry(func() (sarama.KError, error) {
+		res, err := p.coordinator.EndTxn(&sarama.EndTxnRequest{
+			TransactionalID:   p.id,
+			ProducerID:        p.producerID,
+			ProducerEpoch:     p.epoch,
+			TransactionResult: commit,
+		})
+		if err != nil {
+			return sarama.ErrNoError, err
+		}
+
+		return res.Err, nil
+	})
+}
+
+// retry repeats request while coordinator is busy,
+// the coordinator is found again if it has moved or is loading transactions.
+func (p *TransactionalProducer) retry(request func() (sarama.KError, error)) error {
+	for attempt := 0; ; attempt++ {
+		kerr, err := request()
+		if err != nil {
+			return err
+		}
+
+		var refresh bool
+		switch kerr {
+		case sarama.ErrNoError:
+			return nil
+		case sarama.ErrConcurrentTransactions:
+		case sarama.ErrNotCoordinatorForConsumer, sarama.ErrConsumerCoordinatorNotAvailable, sarama.ErrOffsetsLoadInProgress:
+			refresh = true
+		default:
+			return kerr
+		}
+
+		if attempt >= p.config.Producer.Retry.Max {
+			return kerr
+		}
+
+		time.Sleep(p.config.Producer.Retry.Backoff)
+
+		if refresh {
+			if err := p.refreshCoordinator(); err != nil {
+				return fmt.Errorf("%w (refresh coordinator: %s)", kerr, err)
+			}
+		}
+	}
+}
+
+// Close closes connection to the coordinator and the client if it was created by producer.
+func (p *TransactionalProducer) Close() error {
+	err := p.coordinator.Close()
+
+	if p.ownClient {
+		if clientErr := p.client.Close(); err == nil {
+			err = clientErr
+		}
+	}
+
+	return err
+}
+
+func newRecord(msg *sarama.ProducerMessage, ts, firstTimestamp time.Time) (*sarama.Record, error) {
+	record := &sarama.Record{
+		TimestampDelta: ts.Sub(firstTimestamp),
+	}
+
+	var err error
+	if msg.Key != nil {
+		if record.Key, err = msg.Key.Encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	if msg.Value != nil {
+		if record.Value, err = msg.Value.Encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range msg.Headers {
+		record.Headers = append(record.Headers, &msg.Headers[i])
+	}
+
+	return record, nil
+}
+
+// messageTimestamp returns the timestamp of the message or now if it isn't set.
+func messageTimestamp(msg *sarama.ProducerMessage, now time.Time) time.Time {
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = now
+	}
+
+	return ts.Truncate(time.Millisecond)
+}
+
+func containsPartition(partitions []int32, partition int32) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,279 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTransactionMockBroker(t *testing.T, produce sarama.MockResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(transactionMockHandlers(t, broker, produce))
+
+	return broker
+}
+
+func transactionMockHandlers(t *testing.T, broker *sarama.MockBroker, produce sarama.MockResponse) map[string]sarama.MockResponse {
+	return map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test", 0, broker.BrokerID()).
+			SetLeader("test", 1, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockWrapper(&sarama.FindCoordinatorResponse{
+			Version:     1,
+			Coordinator: sarama.NewBroker(broker.Addr()),
+		}),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{
+			ProducerID:    7,
+			ProducerEpoch: 1,
+		}),
+		"AddPartitionsToTxnRequest": sarama.NewMockSequence(
+			&sarama.AddPartitionsToTxnResponse{Errors: map[string][]*sarama.PartitionError{
+				"test": {{Partition: 0, Err: sarama.ErrConcurrentTransactions}},
+			}},
+			&sarama.AddPartitionsToTxnResponse{Errors: map[string][]*sarama.PartitionError{}},
+		),
+		"ProduceRequest": produce,
+		"EndTxnRequest":  sarama.NewMockWrapper(&sarama.EndTxnResponse{}),
+	}
+}
+
+func TestTransactionalProducer_SendBatch(t *testing.T) {
+	broker := newTransactionMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+	config.Producer.Retry.Backoff = time.Millisecond
+	config.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+
+	p, err := NewTransactionalProducer([]string{broker.Addr()}, config, "txn")
+	require.NoError(t, err)
+	defer p.Close()
+
+	assert.Equal(t, int64(7), p.producerID)
+	assert.Equal(t, int16(1), p.epoch)
+
+	msgs := make([]*sarama.ProducerMessage, 0, 3)
+	for i := 0; i < 3; i++ {
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: "test",
+			Key:   sarama.StringEncoder("key"),
+			Value: sarama.StringEncoder("value"),
+		})
+	}
+
+	require.NoError(t, p.SendBatch(msgs, true))
+	assert.Equal(t, []int32{0, 1, 0}, []int32{msgs[0].Partition, msgs[1].Partition, msgs[2].Partition})
+
+	require.NoError(t, p.SendBatch(msgs[:1], false))
+	assert.Equal(t, int32(1), msgs[0].Partition)
+
+	assert.Equal(t, int32(2), p.sequences["test"][0])
+	assert.Equal(t, int32(2), p.sequences["test"][1])
+
+	var (
+		produced int
+		results  []bool
+	)
+
+	for _, rr := range broker.History() {
+		switch req := rr.Request.(type) {
+		case *sarama.ProduceRequest:
+			produced++
+			require.NotNil(t, req.TransactionalID)
+			assert.Equal(t, "txn", *req.TransactionalID)
+			assert.Equal(t, sarama.WaitForAll, req.RequiredAcks)
+		case *sarama.AddPartitionsToTxnRequest:
+			assert.Equal(t, int64(7), req.ProducerID)
+		case *sarama.EndTxnRequest:
+			results = append(results, req.TransactionResult)
+		}
+	}
+
+	assert.Equal(t, 2, produced)
+	assert.Equal(t, []bool{true, false}, results)
+}
+
+func TestTransactionalProducer_SendBatch_Split(t *testing.T) {
+	broker := newTransactionMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3))
+	defer broker.Close()
+
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+	config.Producer.Retry.Backoff = time.Millisecond
+	config.Producer.Partitioner = sarama.NewManualPartitioner
+	config.Producer.Flush.MaxMessages = 2
+
+	p, err := NewTransactionalProducer([]string{broker.Addr()}, config, "txn")
+	require.NoError(t, err)
+	defer p.Close()
+
+	msgs := make([]*sarama.ProducerMessage, 0, 5)
+	for i := 0; i < 5; i++ {
+		msgs = append(msgs, &sarama.ProducerMessage{Topic: "test", Value: sarama.StringEncoder("value")})
+	}
+
+	require.NoError(t, p.SendBatch(msgs, true))
+
+	// timestamps of messages are not changed
+	assert.True(t, msgs[0].Timestamp.IsZero())
+
+	// batches of 2, 2 and 1 records
+	var produced int
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+
+	assert.Equal(t, 3, produced)
+	assert.Equal(t, int32(5), p.sequences["test"][0])
+}
+
+func TestTransactionalProducer_SendBatch_Failed(t *testing.T) {
+	broker := newTransactionMockBroker(t, sarama.NewMockProduceResponse(t).SetVersion(3).
+		SetError("test", 0, sarama.ErrNotEnoughReplicas))
+	defer broker.Close()
+
+	config, err := NewConfig("test", "", "")
+	require.NoError(t, err)
+	config.Producer.Retry.Backoff = time.Millisecond
+	config.Producer.Partitioner = sarama.NewManualPartitioner
+
+	p, err := NewTransactionalProducer([]string{broker.Addr()}, config, "txn")
+	require.NoError(t, err)
+	defer p.Close()
+
+	err = p.SendBatch([]*sarama.ProducerMessage{{Topic: "test", Value: sarama.StringEncoder("value")}}, true)
+	require.ErrorIs(t, err, sarama.ErrNotEnoughReplicas)
+
+	// sequences of the failed batch are not reserved, producer id is initialized again
+	assert.Empty(t, p.sequences)
+
+	var inits int
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.InitProducerIDRequest); ok {
+			inits++
+		}
+	}
+
+	assert.Equal(t, 2, inits)
+}
+
+func TestTransactionalProducer_SendBatch_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		response func(t *testing.T) sarama.MockResponse
+		// requests expected of a committed transaction
+		requests map[string]int
+	}{
+		{
+			name:    "NOT_COORDINATOR",
+			request: "EndTxnRequest",
+			response: func(t *testing.T) sarama.MockResponse {
+				return sarama.NewMockSequence(
+					&sarama.EndTxnResponse{Err: sarama.ErrNotCoordinatorForConsumer},
+					&sarama.EndTxnResponse{},
+				)
+			},
+			requests: map[string]int{"EndTxnRequest": 2, "FindCoordinatorRequest": 2, "ProduceRequest": 1},
+		},
+		{
+			name:    "COORDINATOR_LOAD_IN_PROGRESS",
+			request: "AddPartitionsToTxnRequest",
+			response: func(t *testing.T) sarama.MockResponse {
+				return sarama.NewMockSequence(
+					&sarama.AddPartitionsToTxnResponse{Errors: map[string][]*sarama.PartitionError{
+						"test": {{Partition: 0, Err: sarama.ErrOffsetsLoadInProgress}},
+					}},
+					&sarama.AddPartitionsToTxnResponse{Errors: map[string][]*sarama.PartitionError{}},
+				)
+			},
+			requests: map[string]int{"AddPartitionsToTxnRequest": 2, "FindCoordinatorRequest": 2, "ProduceRequest": 1},
+		},
+		{
+			name:    "NOT_LEADER_FOR_PARTITION",
+			request: "ProduceRequest",
+			response: func(t *testing.T) sarama.MockResponse {
+				return sarama.NewMockSequence(
+					sarama.NewMockProduceResponse(t).SetVersion(3).SetError("test", 0, sarama.ErrNotLeaderForPartition),
+					sarama.NewMockProduceResponse(t).SetVersion(3),
+				)
+			},
+			requests: map[string]int{"ProduceRequest": 2, "FindCoordinatorRequest": 1, "EndTxnRequest": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := sarama.NewMockBroker(t, 1)
+			defer broker.Close()
+
+			handlers := transactionMockHandlers(t, broker, sarama.NewMockProduceResponse(t).SetVersion(3))
+			handlers["AddPartitionsToTxnRequest"] = sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+				Errors: map[string][]*sarama.PartitionError{},
+			})
+			handlers[tt.request] = tt.response(t)
+			broker.SetHandlerByMap(handlers)
+
+			config, err := NewConfig("test", "", "")
+			require.NoError(t, err)
+			config.Producer.Retry.Backoff = time.Millisecond
+			config.Producer.Partitioner = sarama.NewManualPartitioner
+
+			p, err := NewTransactionalProducer([]string{broker.Addr()}, config, "txn")
+			require.NoError(t, err)
+			defer p.Close()
+
+			msg := &sarama.ProducerMessage{Topic: "test", Value: sarama.StringEncoder("value")}
+			require.NoError(t, p.SendBatch([]*sarama.ProducerMessage{msg}, true))
+			assert.Equal(t, int32(1), p.sequences["test"][0])
+
+			var metadata int
+			requests := make(map[string]int)
+			for _, rr := range broker.History() {
+				switch rr.Request.(type) {
+				case *sarama.MetadataRequest:
+					metadata++
+				case *sarama.FindCoordinatorRequest:
+					requests["FindCoordinatorRequest"]++
+				case *sarama.AddPartitionsToTxnRequest:
+					requests["AddPartitionsToTxnRequest"]++
+				case *sarama.ProduceRequest:
+					requests["ProduceRequest"]++
+				case *sarama.EndTxnRequest:
+					requests["EndTxnRequest"]++
+				}
+			}
+
+			for name, n := range tt.requests {
+				assert.Equal(t, n, requests[name], name)
+			}
+
+			// metadata is refreshed when leader has moved
+			if tt.request == "ProduceRequest" {
+				assert.Equal(t, 2, metadata)
+			}
+		})
+	}
+}
+
+func TestTransactionalProducer_Unsupported(t *testing.T) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V0_10_2_0
+
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).SetBroker(broker.Addr(), broker.BrokerID()),
+	})
+
+	_, err := NewTransactionalProducer([]string{broker.Addr()}, config, "txn")
+	assert.ErrorIs(t, err, ErrTransactionsUnsupported)
+}
@@ -0,0 +1,252 @@
+package proto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/dynamic"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatJSON      = "json"
+	FormatYAML      = "yaml"
+	FormatPrototext = "prototext"
+	FormatBinary    = "binary"
+	FormatBase64    = "base64"
+	FormatHex       = "hex"
+)
+
+// Formats is the list of supported formats of messages.
+var Formats = []string{FormatJSON, FormatYAML, FormatPrototext, FormatBinary, FormatBase64, FormatHex}
+
+// Codec encodes and decodes messages in some format.
+type Codec interface {
+	Marshal(m *dynamic.Message) ([]byte, error)
+	Unmarshal(data []byte, m *dynamic.Message) error
+}
+
+// ValueMarshaler is implemented by codecs of binary formats, they encode the binary value as is,
+// so values which can't be decoded with the message are encoded too.
+type ValueMarshaler interface {
+	MarshalValue(value []byte) ([]byte, error)
+}
+
+// JSONOptions are options of messages in JSON.
+type JSONOptions struct {
+	// UseProtoNames uses field names of proto files instead of camel case names.
+	UseProtoNames bool
+	// EnumsAsInts renders enum values as integers.
+	EnumsAsInts bool
+	// EmitDefaults renders fields with zero values.
+	EmitDefaults bool
+	// Indent is the indent of nested fields, message is written in one line without it.
+	Indent string
+}
+
+// NewCodec returns codec of the format.
+func NewCodec(format string) (Codec, error) {
+	switch format {
+	case FormatJSON:
+		return jsonCodec{opts: JSONOptions{EmitDefaults: true}}, nil
+	case FormatYAML:
+		return yamlCodec{}, nil
+	case FormatPrototext:
+		return prototextCodec{}, nil
+	case FormatBinary:
+		return binaryCodec{}, nil
+	case FormatBase64:
+		return base64Codec{}, nil
+	case FormatHex:
+		return hexCodec{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(Formats, ", "))
+}
+
+// NewJSONCodec returns codec of JSON with the options, JSON codec of NewCodec emits defaults.
+func NewJSONCodec(opts JSONOptions) Codec {
+	return jsonCodec{opts: opts}
+}
+
+// NewPrototextCodec returns codec of protobuf text format, compact codec writes message in one line.
+func NewPrototextCodec(compact bool) Codec {
+	return prototextCodec{compact: compact}
+}
+
+type jsonCodec struct {
+	opts JSONOptions
+}
+
+func (c jsonCodec) Marshal(m *dynamic.Message) ([]byte, error) {
+	return m.MarshalJSONPB(&jsonpb.Marshaler{
+		Indent:       c.opts.Indent,
+		OrigName:     c.opts.UseProtoNames,
+		EnumsAsInts:  c.opts.EnumsAsInts,
+		EmitDefaults: c.opts.EmitDefaults,
+	})
+}
+
+func (jsonCodec) Unmarshal(data []byte, m *dynamic.Message) error {
+	return m.UnmarshalJSON(data)
+}
+
+// yamlCodec converts YAML to JSON and back, so the field names and values are the same as in JSON.
+type yamlCodec struct{}
+
+func (yamlCodec) Marshal(m *dynamic.Message) ([]byte, error) {
+	data, err := jsonCodec{opts: JSONOptions{EmitDefaults: true}}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML, the node keeps order of fields
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	resetStyle(&node)
+
+	return yaml.Marshal(&node)
+}
+
+func (yamlCodec) Unmarshal(data []byte, m *dynamic.Message) error {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(jsonValue(v))
+	if err != nil {
+		return err
+	}
+
+	return m.UnmarshalJSON(data)
+}
+
+// resetStyle makes node to be marshaled in block style.
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		resetStyle(n)
+	}
+}
+
+// jsonValue converts maps with any keys decoded from YAML to maps with string keys.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = jsonValue(e)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = jsonValue(e)
+		}
+	}
+
+	return v
+}
+
+type prototextCodec struct {
+	compact bool
+}
+
+func (c prototextCodec) Marshal(m *dynamic.Message) ([]byte, error) {
+	if c.compact {
+		return m.MarshalText()
+	}
+
+	return m.MarshalTextIndent()
+}
+
+func (prototextCodec) Unmarshal(data []byte, m *dynamic.Message) error {
+	return m.UnmarshalText(data)
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(m *dynamic.Message) ([]byte, error) {
+	return m.Marshal()
+}
+
+func (binaryCodec) MarshalValue(value []byte) ([]byte, error) {
+	return value, nil
+}
+
+func (binaryCodec) Unmarshal(data []byte, m *dynamic.Message) error {
+	return m.Unmarshal(data)
+}
+
+// base64Codec is binary encoded in standard base64, surrounding spaces are ignored.
+type base64Codec struct{}
+
+func (c base64Codec) Marshal(m *dynamic.Message) ([]byte, error) {
+	data, err := m.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.MarshalValue(data)
+}
+
+func (base64Codec) MarshalValue(value []byte) ([]byte, error) {
+	out := make([]byte, base64.StdEncoding.EncodedLen(len(value)))
+	base64.StdEncoding.Encode(out, value)
+
+	return out, nil
+}
+
+func (base64Codec) Unmarshal(data []byte, m *dynamic.Message) error {
+	data = bytes.TrimSpace(data)
+
+	b := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(b, data)
+	if err != nil {
+		return err
+	}
+
+	return m.Unmarshal(b[:n])
+}
+
+// hexCodec is binary encoded in hex, surrounding spaces are ignored.
+type hexCodec struct{}
+
+func (c hexCodec) Marshal(m *dynamic.Message) ([]byte, error) {
+	data, err := m.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.MarshalValue(data)
+}
+
+func (hexCodec) MarshalValue(value []byte) ([]byte, error) {
+	out := make([]byte, hex.EncodedLen(len(value)))
+	hex.Encode(out, value)
+
+	return out, nil
+}
+
+func (hexCodec) Unmarshal(data []byte, m *dynamic.Message) error {
+	data = bytes.TrimSpace(data)
+
+	b := make([]byte, hex.DecodedLen(len(data)))
+	n, err := hex.Decode(b, data)
+	if err != nil {
+		return err
+	}
+
+	return m.Unmarshal(b[:n])
+}
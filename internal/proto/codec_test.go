@@ -0,0 +1,108 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec(t *testing.T) {
+	p, err := NewProto(testfiles)
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.NoError(t, err)
+
+	want := dynamic.NewMessage(md)
+	want.SetFieldByName("name", "Alice")
+	want.SetFieldByName("age", int32(30))
+
+	tests := []struct {
+		format string
+		input  string
+	}{
+		{FormatJSON, `{"name": "Alice", "age": 30}`},
+		{FormatYAML, "name: Alice\nage: 30\n"},
+		{FormatPrototext, `name: "Alice" age: 30`},
+		{FormatBinary, "\x0a\x05Alice\x10\x1e"},
+		{FormatBase64, " CgVBbGljZRAe\n"},
+		{FormatHex, "0a05416c696365101e\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			codec, err := NewCodec(tt.format)
+			require.NoError(t, err)
+
+			m, err := Decode(codec, []byte(tt.input), md)
+			require.NoError(t, err)
+			assert.True(t, dynamic.Equal(want, m), m.String())
+
+			// encoded message is decoded back
+			data, err := codec.Marshal(m)
+			require.NoError(t, err)
+
+			m, err = Decode(codec, data, md)
+			require.NoError(t, err)
+			assert.True(t, dynamic.Equal(want, m), m.String())
+		})
+	}
+}
+
+func TestCodec_YAML(t *testing.T) {
+	p, err := NewProto(testfiles)
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.NoError(t, err)
+
+	m := dynamic.NewMessage(md)
+	m.SetFieldByName("name", "123")
+
+	data, err := yamlCodec{}.Marshal(m)
+	require.NoError(t, err)
+	assert.Equal(t, "name: \"123\"\nage: 0\n", string(data))
+
+	_, err = Decode(yamlCodec{}, []byte("name: [Alice"), md)
+	assert.Error(t, err)
+}
+
+func TestNewCodec_Unknown(t *testing.T) {
+	_, err := NewCodec("xml")
+	assert.EqualError(t, err, `unknown format "xml", use one of json, yaml, prototext, binary, base64, hex`)
+}
+
+func TestCodec_Options(t *testing.T) {
+	p, err := NewProto(testfiles)
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.NoError(t, err)
+
+	m := dynamic.NewMessage(md)
+	m.SetFieldByName("name", "Alice")
+
+	tests := []struct {
+		name  string
+		codec Codec
+		want  string
+	}{
+		{"json", NewJSONCodec(JSONOptions{}), `{"name":"Alice"}`},
+		{"json defaults", NewJSONCodec(JSONOptions{EmitDefaults: true, Indent: "  "}), "{\n  \"name\": \"Alice\",\n  \"age\": 0\n}"},
+		{"prototext", NewPrototextCodec(false), `name: "Alice"`},
+		{"prototext compact", NewPrototextCodec(true), `name:"Alice"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.codec.Marshal(m)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+
+	// values of binary codecs are encoded as is
+	data, err := hexCodec{}.MarshalValue([]byte("not a message"))
+	require.NoError(t, err)
+	assert.Equal(t, "6e6f742061206d657373616765", string(data))
+}
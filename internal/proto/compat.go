@@ -0,0 +1,284 @@
+package proto
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Change is a difference between two versions of a message.
+type Change struct {
+	// Path is a fully-qualified name of changed element.
+	Path string
+	// Description describes the change.
+	Description string
+	// Breaking is true if consumers with one version can't read data written with another.
+	Breaking bool
+}
+
+func (c Change) String() string {
+	level := "WARNING"
+	if c.Breaking {
+		level = "BREAKING"
+	}
+
+	return fmt.Sprintf("%s %s: %s", level, c.Path, c.Description)
+}
+
+// wireCompatibleTypes are groups of scalar types which are encoded the same way,
+// enums are encoded as int32.
+var wireCompatibleTypes = [][]descriptorpb.FieldDescriptorProto_Type{
+	{
+		descriptorpb.FieldDescriptorProto_TYPE_ENUM,
+		descriptorpb.FieldDescriptorProto_TYPE_INT32,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_INT64,
+		descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	},
+	{
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	},
+	{
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	},
+	{
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	},
+	{
+		descriptorpb.FieldDescriptorProto_TYPE_STRING,
+		descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	},
+}
+
+// CheckCompatibility compares old and new versions of the message and nested message types.
+func CheckCompatibility(oldMsg, newMsg *desc.MessageDescriptor) []Change {
+	c := &compatChecker{seen: make(map[string]bool)}
+	c.checkMessage(oldMsg, newMsg)
+
+	return c.changes
+}
+
+type compatChecker struct {
+	changes []Change
+	seen    map[string]bool
+}
+
+func (c *compatChecker) add(path string, breaking bool, format string, args ...interface{}) {
+	c.changes = append(c.changes, Change{
+		Path:        path,
+		Description: fmt.Sprintf(format, args...),
+		Breaking:    breaking,
+	})
+}
+
+func (c *compatChecker) checkMessage(oldMsg, newMsg *desc.MessageDescriptor) {
+	key := oldMsg.GetFullyQualifiedName() + "|" + newMsg.GetFullyQualifiedName()
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+
+	for _, oldField := range oldMsg.GetFields() {
+		path := oldField.GetFullyQualifiedName()
+		newField := newMsg.FindFieldByNumber(oldField.GetNumber())
+
+		if newField == nil {
+			if renamed := newMsg.FindFieldByName(oldField.GetName()); renamed != nil {
+				c.add(path, true, "field renumbered from %d to %d", oldField.GetNumber(), renamed.GetNumber())
+			} else if isReservedNumber(newMsg, oldField.GetNumber()) {
+				// reserving is the safe way to remove fields, the number can't be reused with another type
+				c.add(path, false, "field %d removed (number is reserved)", oldField.GetNumber())
+			} else if isReservedName(newMsg, oldField.GetName()) {
+				c.add(path, false, "field %d removed (name is reserved)", oldField.GetNumber())
+			} else {
+				c.add(path, true, "field %d removed", oldField.GetNumber())
+			}
+
+			continue
+		}
+
+		if newField.GetName() != oldField.GetName() {
+			c.add(path, false, "field %d renamed to %s (breaks JSON)", oldField.GetNumber(), newField.GetName())
+		}
+
+		c.checkField(path, oldField, newField)
+	}
+
+	for _, newField := range newMsg.GetFields() {
+		if oldMsg.FindFieldByNumber(newField.GetNumber()) != nil {
+			continue
+		}
+
+		path := newField.GetFullyQualifiedName()
+		switch {
+		case isReservedNumber(oldMsg, newField.GetNumber()):
+			c.add(path, true, "field uses reserved number %d", newField.GetNumber())
+		case isReservedName(oldMsg, newField.GetName()):
+			c.add(path, true, "field uses reserved name %s", newField.GetName())
+		case newField.IsRequired():
+			c.add(path, true, "required field %d added", newField.GetNumber())
+		}
+	}
+}
+
+func (c *compatChecker) checkField(path string, oldField, newField *desc.FieldDescriptor) {
+	oldLabel, newLabel := oldField.GetLabel(), newField.GetLabel()
+
+	switch {
+	case oldField.IsMap() != newField.IsMap(), oldField.IsRepeated() != newField.IsRepeated():
+		c.add(path, true, "label changed from %s to %s", labelName(oldField), labelName(newField))
+		return
+	case oldLabel != newLabel && (oldField.IsRequired() || newField.IsRequired()):
+		c.add(path, true, "label changed from %s to %s", labelName(oldField), labelName(newField))
+	}
+
+	if oldField.IsMap() {
+		c.checkType(path+"<key>", oldField.GetMapKeyType(), newField.GetMapKeyType())
+		c.checkType(path+"<value>", oldField.GetMapValueType(), newField.GetMapValueType())
+
+		return
+	}
+
+	c.checkType(path, oldField, newField)
+
+	oldOneOf, newOneOf := oneOfName(oldField), oneOfName(newField)
+	if oldOneOf != newOneOf {
+		c.add(path, false, "oneof changed from %q to %q", oldOneOf, newOneOf)
+	}
+}
+
+func (c *compatChecker) checkType(path string, oldField, newField *desc.FieldDescriptor) {
+	oldType, newType := oldField.GetType(), newField.GetType()
+
+	if oldType != newType {
+		if isWireCompatible(oldType, newType) {
+			c.add(path, false, "type changed from %s to %s (wire compatible)", typeName(oldField), typeName(newField))
+		} else {
+			c.add(path, true, "type changed from %s to %s", typeName(oldField), typeName(newField))
+		}
+
+		return
+	}
+
+	switch oldType {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		oldMsg, newMsg := oldField.GetMessageType(), newField.GetMessageType()
+		if oldMsg.GetFullyQualifiedName() != newMsg.GetFullyQualifiedName() {
+			c.add(path, false, "message type changed from %s to %s", oldMsg.GetFullyQualifiedName(), newMsg.GetFullyQualifiedName())
+		}
+
+		c.checkMessage(oldMsg, newMsg)
+
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		c.checkEnum(oldField.GetEnumType(), newField.GetEnumType())
+	}
+}
+
+func (c *compatChecker) checkEnum(oldEnum, newEnum *desc.EnumDescriptor) {
+	key := oldEnum.GetFullyQualifiedName() + "|" + newEnum.GetFullyQualifiedName()
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+
+	for _, oldValue := range oldEnum.GetValues() {
+		path := oldValue.GetFullyQualifiedName()
+
+		if newValue := newEnum.FindValueByNumber(oldValue.GetNumber()); newValue != nil {
+			if newValue.GetName() != oldValue.GetName() {
+				c.add(path, false, "enum value %d renamed to %s (breaks JSON)", oldValue.GetNumber(), newValue.GetName())
+			}
+
+			continue
+		}
+
+		if renamed := newEnum.FindValueByName(oldValue.GetName()); renamed != nil {
+			c.add(path, true, "enum value renumbered from %d to %d", oldValue.GetNumber(), renamed.GetNumber())
+		} else {
+			c.add(path, true, "enum value %d removed", oldValue.GetNumber())
+		}
+	}
+
+	for _, newValue := range newEnum.GetValues() {
+		if oldEnum.FindValueByNumber(newValue.GetNumber()) != nil {
+			continue
+		}
+
+		for _, r := range oldEnum.AsEnumDescriptorProto().GetReservedRange() {
+			// enum reserved ranges are inclusive
+			if n := newValue.GetNumber(); n >= r.GetStart() && n <= r.GetEnd() {
+				c.add(newValue.GetFullyQualifiedName(), true, "enum value uses reserved number %d", n)
+			}
+		}
+	}
+}
+
+func isReservedNumber(md *desc.MessageDescriptor, number int32) bool {
+	for _, r := range md.AsDescriptorProto().GetReservedRange() {
+		// message reserved ranges are exclusive
+		if number >= r.GetStart() && number < r.GetEnd() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isReservedName(md *desc.MessageDescriptor, name string) bool {
+	for _, n := range md.AsDescriptorProto().GetReservedName() {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isWireCompatible(a, b descriptorpb.FieldDescriptorProto_Type) bool {
+	for _, group := range wireCompatibleTypes {
+		foundA, foundB := false, false
+		for _, t := range group {
+			foundA = foundA || t == a
+			foundB = foundB || t == b
+		}
+
+		if foundA && foundB {
+			return true
+		}
+	}
+
+	return false
+}
+
+func labelName(fd *desc.FieldDescriptor) string {
+	if fd.IsMap() {
+		return "map"
+	}
+
+	return strings.ToLower(strings.TrimPrefix(fd.GetLabel().String(), "LABEL_"))
+}
+
+func typeName(fd *desc.FieldDescriptor) string {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return fd.GetMessageType().GetFullyQualifiedName()
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return fd.GetEnumType().GetFullyQualifiedName()
+	}
+
+	return strings.ToLower(strings.TrimPrefix(fd.GetType().String(), "TYPE_"))
+}
+
+func oneOfName(fd *desc.FieldDescriptor) string {
+	if oo := fd.GetOneOf(); oo != nil && !oo.IsSynthetic() {
+		return oo.GetName()
+	}
+
+	return ""
+}
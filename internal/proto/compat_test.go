@@ -0,0 +1,129 @@
+package proto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	oldProto, err := NewProto([]string{"testdata/compat/v1.proto"})
+	require.Nil(t, err)
+
+	newProto, err := NewProto([]string{"testdata/compat/v2.proto"})
+	require.Nil(t, err)
+
+	oldMsg, err := oldProto.FindMessage("Order")
+	require.Nil(t, err)
+
+	newMsg, err := newProto.FindMessage("Order")
+	require.Nil(t, err)
+
+	changes := []string{}
+	for _, c := range CheckCompatibility(oldMsg, newMsg) {
+		changes = append(changes, c.String())
+	}
+
+	assert.Equal(t, []string{
+		"WARNING compat.Order.amount: type changed from int32 to int64 (wire compatible)",
+		"BREAKING compat.Order.comment: field 3 removed",
+		"BREAKING compat.Status.DELETED: enum value 2 removed",
+		"BREAKING compat.Item.price: type changed from int64 to string",
+		"BREAKING compat.Order.note: field renumbered from 6 to 7",
+		"BREAKING compat.Order.legacy: field uses reserved number 10",
+	}, changes)
+}
+
+func TestCheckCompatibility_Same(t *testing.T) {
+	p, err := NewProto([]string{"testdata/compat/v1.proto"})
+	require.Nil(t, err)
+
+	md, err := p.FindMessage("Order")
+	require.Nil(t, err)
+
+	assert.Empty(t, CheckCompatibility(md, md))
+}
+
+// checkCompatibility returns changes of message Msg between sources of proto files.
+func checkCompatibility(t *testing.T, oldSrc, newSrc string) []string {
+	find := func(src string) *desc.MessageDescriptor {
+		filename := filepath.Join(t.TempDir(), "msg.proto")
+		require.Nil(t, os.WriteFile(filename, []byte("syntax = \"proto3\";\npackage compat;\n"+src), 0o600))
+
+		p, err := NewProto([]string{filename})
+		require.Nil(t, err)
+
+		md, err := p.FindMessage("Msg")
+		require.Nil(t, err)
+
+		return md
+	}
+
+	changes := []string{}
+	for _, c := range CheckCompatibility(find(oldSrc), find(newSrc)) {
+		changes = append(changes, c.String())
+	}
+
+	return changes
+}
+
+func TestCheckCompatibility_Cases(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		expected []string
+	}{
+		{
+			name:     "removed field with reserved number",
+			old:      `message Msg { string id = 1; string email = 2; }`,
+			new:      `message Msg { string id = 1; reserved 2; }`,
+			expected: []string{"WARNING compat.Msg.email: field 2 removed (number is reserved)"},
+		},
+		{
+			name:     "removed field with reserved range",
+			old:      `message Msg { string id = 1; string email = 5; }`,
+			new:      `message Msg { string id = 1; reserved 3 to 6; }`,
+			expected: []string{"WARNING compat.Msg.email: field 5 removed (number is reserved)"},
+		},
+		{
+			name:     "removed field with reserved name",
+			old:      `message Msg { string id = 1; string email = 2; }`,
+			new:      `message Msg { string id = 1; reserved "email"; }`,
+			expected: []string{"WARNING compat.Msg.email: field 2 removed (name is reserved)"},
+		},
+		{
+			name:     "removed field",
+			old:      `message Msg { string id = 1; string email = 2; }`,
+			new:      `message Msg { string id = 1; reserved 3; }`,
+			expected: []string{"BREAKING compat.Msg.email: field 2 removed"},
+		},
+		{
+			name:     "enum to int32",
+			old:      `enum Kind { A = 0; } message Msg { Kind kind = 1; }`,
+			new:      `message Msg { int32 kind = 1; }`,
+			expected: []string{"WARNING compat.Msg.kind: type changed from compat.Kind to int32 (wire compatible)"},
+		},
+		{
+			name:     "uint64 to bool",
+			old:      `message Msg { uint64 flag = 1; }`,
+			new:      `message Msg { bool flag = 1; }`,
+			expected: []string{"WARNING compat.Msg.flag: type changed from uint64 to bool (wire compatible)"},
+		},
+		{
+			name:     "enum to sint32",
+			old:      `enum Kind { A = 0; } message Msg { Kind kind = 1; }`,
+			new:      `message Msg { sint32 kind = 1; }`,
+			expected: []string{"BREAKING compat.Msg.kind: type changed from compat.Kind to sint32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, checkCompatibility(t, tt.old, tt.new))
+		})
+	}
+}
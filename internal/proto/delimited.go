@@ -0,0 +1,39 @@
+package proto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// WriteDelimited writes data prefixed with its varint length,
+// the same way as writeDelimitedTo of the Java protobuf library.
+func WriteDelimited(w io.Writer, data []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(data))
+	n := binary.PutUvarint(buf, uint64(len(data)))
+
+	_, err := w.Write(append(buf[:n], data...))
+
+	return err
+}
+
+// ReadDelimited reads data prefixed with its varint length.
+// It returns io.EOF if there is no more data.
+func ReadDelimited(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	return data, nil
+}
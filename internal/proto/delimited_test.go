@@ -0,0 +1,39 @@
+package proto
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelimited(t *testing.T) {
+	values := [][]byte{
+		[]byte("first"),
+		{},
+		bytes.Repeat([]byte{1}, 300), // two bytes of length
+	}
+
+	buf := new(bytes.Buffer)
+	for _, v := range values {
+		require.NoError(t, WriteDelimited(buf, v))
+	}
+
+	assert.Equal(t, []byte{5, 'f', 'i', 'r', 's', 't', 0, 0xac, 0x02}, buf.Bytes()[:9])
+
+	r := bufio.NewReader(buf)
+	for _, want := range values {
+		got, err := ReadDelimited(r)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ReadDelimited(r)
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = ReadDelimited(bufio.NewReader(bytes.NewReader([]byte{5, 'a'})))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
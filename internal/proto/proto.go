@@ -9,9 +9,12 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/desc/protoparse"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 type Proto struct {
@@ -52,7 +55,8 @@ func NewProto(filenames []string, importPaths ...string) (p *Proto, err error) {
 	}
 
 	parser := protoparse.Parser{
-		ImportPaths: importPaths,
+		ImportPaths:           importPaths,
+		IncludeSourceCodeInfo: true,
 	}
 
 	descriptors, err := parser.ParseFiles(paths...)
@@ -66,27 +70,143 @@ func NewProto(filenames []string, importPaths ...string) (p *Proto, err error) {
 	}, nil
 }
 
+// NewProtoFromDescriptorSet creates a new instance of Proto from the file with serialized FileDescriptorSet.
+func NewProtoFromDescriptorSet(filename string) (*Proto, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := protov2.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("proto: invalid descriptor set %s: %w", filename, err)
+	}
+
+	files, err := desc.CreateFileDescriptorsFromSet(set)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := make([]*desc.FileDescriptor, 0, len(files))
+	for _, f := range set.GetFile() {
+		descriptors = append(descriptors, files[f.GetName()])
+	}
+
+	return &Proto{descriptors: descriptors}, nil
+}
+
+// Load creates Proto from a single descriptor set file (*.protoset, *.pb) or from proto files.
+func Load(filenames []string) (*Proto, error) {
+	if len(filenames) == 1 && IsDescriptorSet(filenames[0]) {
+		return NewProtoFromDescriptorSet(filenames[0])
+	}
+
+	return NewProto(filenames)
+}
+
+// IsDescriptorSet reports whether file is a descriptor set judging by its extension.
+func IsDescriptorSet(filename string) bool {
+	switch filepath.Ext(filename) {
+	case ".protoset", ".pb":
+		return true
+	}
+
+	return false
+}
+
 // FindMessage searches for message with given name.
+// The name is fully-qualified or a short name, which must be unique across parsed files.
 func (p *Proto) FindMessage(name string) (*desc.MessageDescriptor, error) {
 	if name == "" {
 		return nil, errors.New("proto: name is empty")
 	}
 
+	// finds the message with the given fully-qualified name
 	for _, fd := range p.descriptors {
-		// finds the message with the given fully-qualified name
 		if d := fd.FindMessage(name); d != nil {
 			return d, nil
 		}
+	}
+
+	// find just with short-name
+	var found []*desc.MessageDescriptor
+	for _, d := range p.Types() {
+		if md, ok := d.(*desc.MessageDescriptor); ok && md.GetName() == name {
+			found = append(found, md)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("proto: message with name %s not found", name)
+	case 1:
+		return found[0], nil
+	}
+
+	candidates := make([]string, 0, len(found))
+	for _, md := range found {
+		candidates = append(candidates, md.GetFullyQualifiedName())
+	}
+
+	return nil, fmt.Errorf("proto: message name %s is ambiguous, use one of: %s", name, strings.Join(candidates, ", "))
+}
 
-		// find just with short-name
-		for _, d := range fd.GetMessageTypes() {
-			if d.GetName() == name {
+// FindDescriptor searches for message, enum or service with given fully-qualified name.
+// Message may also be found with a short name.
+func (p *Proto) FindDescriptor(name string) (desc.Descriptor, error) {
+	for _, fd := range p.descriptors {
+		if d := fd.FindSymbol(name); d != nil {
+			switch d.(type) {
+			case *desc.MessageDescriptor, *desc.EnumDescriptor, *desc.ServiceDescriptor:
 				return d, nil
 			}
 		}
 	}
 
-	return nil, fmt.Errorf("proto: message with name %s not found", name)
+	return p.FindMessage(name)
+}
+
+// Types returns messages (including nested), enums and services of parsed files.
+// Map entries are skipped, descriptors are unique by fully-qualified name.
+func (p *Proto) Types() []desc.Descriptor {
+	var (
+		result []desc.Descriptor
+		seen   = make(map[string]bool)
+	)
+
+	add := func(d desc.Descriptor) {
+		if name := d.GetFullyQualifiedName(); !seen[name] {
+			seen[name] = true
+			result = append(result, d)
+		}
+	}
+
+	var addMessages func([]*desc.MessageDescriptor)
+	addMessages = func(messages []*desc.MessageDescriptor) {
+		for _, md := range messages {
+			if md.IsMapEntry() {
+				continue
+			}
+
+			add(md)
+			addMessages(md.GetNestedMessageTypes())
+			for _, ed := range md.GetNestedEnumTypes() {
+				add(ed)
+			}
+		}
+	}
+
+	for _, fd := range p.descriptors {
+		addMessages(fd.GetMessageTypes())
+		for _, ed := range fd.GetEnumTypes() {
+			add(ed)
+		}
+		for _, sd := range fd.GetServices() {
+			add(sd)
+		}
+	}
+
+	return result
 }
 
 func httpGet(url string) (filename string, cleaner func(), err error) {
@@ -15,7 +15,7 @@ type protoEncoder struct {
 
 // Encoder returns sarama.Encoder for protobuf.
 func Encoder(m *dynamic.Message) sarama.Encoder {
-	data, err := m.Marshal()
+	data, err := binaryCodec{}.Marshal(m)
 
 	return &protoEncoder{
 		data: data,
@@ -31,11 +31,17 @@ func (s protoEncoder) Length() int {
 	return len(s.data)
 }
 
+// Unmarshal parses message from JSON.
 func Unmarshal(b []byte, md *desc.MessageDescriptor) (*dynamic.Message, error) {
+	return Decode(jsonCodec{}, b, md)
+}
+
+// Decode parses message of the descriptor with the codec.
+func Decode(codec Codec, b []byte, md *desc.MessageDescriptor) (*dynamic.Message, error) {
 	f := dynamic.NewMessageFactoryWithDefaults()
 	m := f.NewDynamicMessage(md)
 
-	err := m.UnmarshalJSON(b)
+	err := codec.Unmarshal(b, m)
 	if err != nil {
 		return nil, err
 	}
@@ -6,9 +6,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/jhump/protoreflect/desc"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	protov2 "google.golang.org/protobuf/proto"
 )
 
 var testfiles = []string{
@@ -92,3 +96,55 @@ func TestProto_FindMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestProto_FindMessage_Ambiguous(t *testing.T) {
+	p, err := NewProto([]string{"testdata/example.proto", "testdata/other.proto"})
+	assert.Nil(t, err)
+
+	_, err = p.FindMessage("HelloRequest")
+	if assert.Error(t, err) {
+		assert.Equal(t, "proto: message name HelloRequest is ambiguous, use one of: example.HelloRequest, other.HelloRequest", err.Error())
+	}
+
+	md, err := p.FindMessage("other.HelloRequest")
+	assert.Nil(t, err)
+	assert.Equal(t, "other.HelloRequest", md.GetFullyQualifiedName())
+}
+
+func TestProto_Types(t *testing.T) {
+	p, err := NewProto([]string{"testdata/example.proto", "testdata/other.proto"})
+	assert.Nil(t, err)
+
+	names := []string{}
+	for _, d := range p.Types() {
+		names = append(names, d.GetFullyQualifiedName())
+	}
+
+	assert.Equal(t, []string{
+		"example.HelloRequest",
+		"example.HelloResponse",
+		"example.Num",
+		"example.Empty",
+		"example.Example",
+		"other.HelloRequest",
+		"other.Status",
+	}, names)
+}
+
+func TestProto_Load_DescriptorSet(t *testing.T) {
+	p, err := NewProto(testfiles)
+	require.Nil(t, err)
+
+	data, err := protov2.Marshal(desc.ToFileDescriptorSet(p.descriptors...))
+	require.Nil(t, err)
+
+	filename := filepath.Join(t.TempDir(), "example.protoset")
+	require.Nil(t, os.WriteFile(filename, data, 0o600))
+
+	loaded, err := Load([]string{filename})
+	require.Nil(t, err)
+
+	md, err := loaded.FindMessage("WithMoney")
+	require.Nil(t, err)
+	assert.Equal(t, "example.WithMoney", md.GetFullyQualifiedName())
+}
@@ -0,0 +1,408 @@
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// RedactRemove clears redacted fields.
+	RedactRemove = "remove"
+	// RedactMask replaces string and bytes values with RedactedMask, other fields are cleared.
+	RedactMask = "mask"
+	// RedactHash replaces string and bytes values with their HMAC-SHA256 with a secret key,
+	// so equal values stay equal, other fields are cleared.
+	RedactHash = "hash"
+
+	// RedactedMask is a mask of redacted values.
+	RedactedMask = "***"
+
+	// SensitiveOption is the name of bool field option marking fields to redact, e.g. (sensitive) = true.
+	SensitiveOption = "sensitive"
+)
+
+// RedactModes is the list of redact modes.
+var RedactModes = []string{RedactRemove, RedactMask, RedactHash}
+
+// ErrRedactKeyRequired is returned if hash mode has no key.
+var ErrRedactKeyRequired = errors.New("hash redact mode requires a key")
+
+// Redaction is a redact mode with a key of hash mode.
+type Redaction struct {
+	Mode string
+	// Key is a secret key of HMAC in hash mode, so hashes of guessable values can't be brute-forced
+	// without it.
+	Key []byte
+}
+
+// Validate returns an error if the mode is unknown or hash mode has no key.
+func (r Redaction) Validate() error {
+	switch r.Mode {
+	case RedactRemove, RedactMask:
+	case RedactHash:
+		if len(r.Key) == 0 {
+			return ErrRedactKeyRequired
+		}
+	default:
+		return fmt.Errorf("unknown redact mode %q, use one of %s", r.Mode, strings.Join(RedactModes, ", "))
+	}
+
+	return nil
+}
+
+// Redact redacts fields of the message at dotted paths of field names, e.g. user.email.
+// Fields of repeated and map values are redacted in every element.
+func Redact(m *dynamic.Message, paths []string, r Redaction) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := redactPath(m, strings.Split(path, "."), r); err != nil {
+			return fmt.Errorf("redact %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// RedactBytes returns redacted value, it's nil if mode is remove.
+func RedactBytes(value []byte, r Redaction) []byte {
+	switch r.Mode {
+	case RedactMask:
+		return []byte(RedactedMask)
+	case RedactHash:
+		mac := hmac.New(sha256.New, r.Key)
+		mac.Write(value)
+		return []byte("hmac-sha256:" + hex.EncodeToString(mac.Sum(nil)[:16]))
+	}
+
+	return nil
+}
+
+func redactPath(m *dynamic.Message, path []string, r Redaction) error {
+	fd := m.GetMessageDescriptor().FindFieldByName(path[0])
+	if fd == nil {
+		return fmt.Errorf("message %s has no field %s", m.GetMessageDescriptor().GetFullyQualifiedName(), path[0])
+	}
+
+	if !m.HasField(fd) {
+		return nil
+	}
+
+	if len(path) == 1 {
+		return redactField(m, fd, r)
+	}
+
+	redact := func(v interface{}) (interface{}, error) {
+		pm, ok := v.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("field %s isn't a message", fd.GetName())
+		}
+
+		dm, err := dynamic.AsDynamicMessage(pm)
+		if err != nil {
+			return nil, err
+		}
+
+		return dm, redactPath(dm, path[1:], r)
+	}
+
+	return updateValues(m, fd, redact)
+}
+
+// redactField replaces string and bytes values of the field, other fields are cleared.
+func redactField(m *dynamic.Message, fd *desc.FieldDescriptor, r Redaction) error {
+	switch {
+	case r.Mode == RedactRemove:
+	case fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return updateValues(m, fd, func(v interface{}) (interface{}, error) {
+			return string(RedactBytes([]byte(v.(string)), r)), nil
+		})
+	case fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return updateValues(m, fd, func(v interface{}) (interface{}, error) {
+			return RedactBytes(v.([]byte), r), nil
+		})
+	case fd.IsMap():
+		// values of maps are redacted, keys stay the same
+		return updateValues(m, fd, func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case string:
+				return string(RedactBytes([]byte(v), r)), nil
+			case []byte:
+				return RedactBytes(v, r), nil
+			}
+
+			return v, nil
+		})
+	}
+
+	m.ClearField(fd)
+
+	return nil
+}
+
+// updateValues replaces value of the field, every element of repeated fields or every value of maps.
+func updateValues(m *dynamic.Message, fd *desc.FieldDescriptor, update func(interface{}) (interface{}, error)) error {
+	switch v := m.GetField(fd).(type) {
+	case []interface{}:
+		for i := range v {
+			e, err := update(v[i])
+			if err != nil {
+				return err
+			}
+			v[i] = e
+		}
+
+		return m.TrySetField(fd, v)
+	case map[interface{}]interface{}:
+		for k := range v {
+			e, err := update(v[k])
+			if err != nil {
+				return err
+			}
+			v[k] = e
+		}
+
+		return m.TrySetField(fd, v)
+	default:
+		e, err := update(v)
+		if err != nil {
+			return err
+		}
+
+		return m.TrySetField(fd, e)
+	}
+}
+
+// DiscardUnknown removes unknown fields of the message and its nested messages,
+// e.g. fields removed from the schema which can't be redacted.
+func DiscardUnknown(m *dynamic.Message) error {
+	var fields []*desc.FieldDescriptor
+	for _, fd := range m.GetKnownFields() {
+		if m.HasField(fd) {
+			fields = append(fields, fd)
+		}
+	}
+
+	for _, fd := range fields {
+		if fd.GetMessageType() == nil {
+			continue
+		}
+
+		err := updateValues(m, fd, func(v interface{}) (interface{}, error) {
+			pm, ok := v.(proto.Message)
+			if !ok {
+				// values of maps with message values may be scalars
+				return v, nil
+			}
+
+			dm, err := dynamic.AsDynamicMessage(pm)
+			if err != nil {
+				return nil, err
+			}
+
+			return dm, DiscardUnknown(dm)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(m.GetUnknownFields()) == 0 {
+		return nil
+	}
+
+	// unknown fields are removed by reset only, so known fields are set again
+	values := make([]interface{}, len(fields))
+	for i, fd := range fields {
+		values[i] = m.GetField(fd)
+	}
+
+	m.Reset()
+
+	for i, fd := range fields {
+		if err := m.TrySetField(fd, values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SensitiveFields returns fields of the message and its nested messages marked with bool field option
+// named sensitive, e.g. (sensitive) = true or (acme.sensitive) = true.
+func SensitiveFields(md *desc.MessageDescriptor) []*desc.FieldDescriptor {
+	ext := findSensitiveOptions(md.GetFile(), make(map[string]bool))
+	if len(ext) == 0 {
+		return nil
+	}
+
+	var er dynamic.ExtensionRegistry
+	for _, e := range ext {
+		_ = er.AddExtension(e)
+	}
+
+	opts := optionsOf{
+		md: ext[0].GetOwner(),
+		mf: dynamic.NewMessageFactoryWithExtensionRegistry(&er),
+	}
+
+	return sensitiveFields(md, opts, make(map[string]bool))
+}
+
+// optionsOf reads field options with known extensions.
+type optionsOf struct {
+	md *desc.MessageDescriptor
+	mf *dynamic.MessageFactory
+}
+
+func sensitiveFields(md *desc.MessageDescriptor, opts optionsOf, visited map[string]bool) []*desc.FieldDescriptor {
+	// recursive messages are visited once
+	if visited[md.GetFullyQualifiedName()] {
+		return nil
+	}
+	visited[md.GetFullyQualifiedName()] = true
+
+	var fields []*desc.FieldDescriptor
+	for _, fd := range md.GetFields() {
+		if opts.isSensitive(fd) {
+			fields = append(fields, fd)
+			continue
+		}
+
+		if nested := fd.GetMessageType(); nested != nil {
+			fields = append(fields, sensitiveFields(nested, opts, visited)...)
+		}
+	}
+
+	return fields
+}
+
+// RedactFields redacts the fields wherever they are in the message, including nested messages.
+func RedactFields(m *dynamic.Message, fields []*desc.FieldDescriptor, r Redaction) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	set := make(map[*desc.FieldDescriptor]bool, len(fields))
+	for _, fd := range fields {
+		set[fd] = true
+	}
+
+	return redactFields(m, set, r)
+}
+
+func redactFields(m *dynamic.Message, fields map[*desc.FieldDescriptor]bool, r Redaction) error {
+	for _, fd := range m.GetKnownFields() {
+		if !m.HasField(fd) {
+			continue
+		}
+
+		if fields[fd] {
+			if err := redactField(m, fd, r); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if fd.GetMessageType() == nil {
+			continue
+		}
+
+		err := updateValues(m, fd, func(v interface{}) (interface{}, error) {
+			pm, ok := v.(proto.Message)
+			if !ok {
+				// values of maps with message values may be scalars
+				return v, nil
+			}
+
+			dm, err := dynamic.AsDynamicMessage(pm)
+			if err != nil {
+				return nil, err
+			}
+
+			return dm, redactFields(dm, fields, r)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o optionsOf) isSensitive(fd *desc.FieldDescriptor) bool {
+	opts := fd.GetFieldOptions()
+	if opts == nil {
+		return false
+	}
+
+	dm := o.mf.NewDynamicMessage(o.md)
+	if err := dm.ConvertFrom(opts); err != nil {
+		return false
+	}
+
+	for _, ext := range dm.GetKnownExtensions() {
+		if ext.GetName() != SensitiveOption {
+			continue
+		}
+
+		if v, ok := dm.GetField(ext).(bool); ok && v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findSensitiveOptions returns bool extensions of field options named sensitive of the file and its dependencies.
+func findSensitiveOptions(fd *desc.FileDescriptor, visited map[string]bool) []*desc.FieldDescriptor {
+	if visited[fd.GetName()] {
+		return nil
+	}
+	visited[fd.GetName()] = true
+
+	var res []*desc.FieldDescriptor
+
+	for _, ext := range allExtensions(fd) {
+		if ext.GetName() == SensitiveOption &&
+			ext.GetOwner().GetFullyQualifiedName() == "google.protobuf.FieldOptions" &&
+			ext.GetType() == descriptorpb.FieldDescriptorProto_TYPE_BOOL {
+			res = append(res, ext)
+		}
+	}
+
+	for _, dep := range fd.GetDependencies() {
+		res = append(res, findSensitiveOptions(dep, visited)...)
+	}
+
+	return res
+}
+
+func allExtensions(fd *desc.FileDescriptor) []*desc.FieldDescriptor {
+	res := append([]*desc.FieldDescriptor(nil), fd.GetExtensions()...)
+
+	var nested func(md *desc.MessageDescriptor)
+	nested = func(md *desc.MessageDescriptor) {
+		res = append(res, md.GetNestedExtensions()...)
+		for _, n := range md.GetNestedMessageTypes() {
+			nested(n)
+		}
+	}
+
+	for _, md := range fd.GetMessageTypes() {
+		nested(md)
+	}
+
+	return res
+}
@@ -0,0 +1,157 @@
+package proto
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	p, err := NewProto([]string{"testdata/types.proto", "testdata/recursive.proto"})
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("ExampleMessage")
+	require.NoError(t, err)
+
+	m := dynamic.NewMessage(md)
+	require.NoError(t, m.UnmarshalJSON([]byte(`{
+		"stringField": "secret",
+		"int32Field": 5,
+		"messageField": {"nestedInt32": 1, "nestedString": "secret"},
+		"mapInt32MessageField": {"1": {"nestedInt32": 2, "nestedString": "secret"}}
+	}`)))
+
+	require.NoError(t, Redact(m, []string{
+		"string_field",
+		"message_field.nested_string",
+		"map_int32_message_field.nested_string",
+		"option3.nested_string", // unset fields are skipped
+	}, Redaction{Mode: RedactRemove}))
+
+	data, err := m.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"int32Field": 5,
+		"messageField": {"nestedInt32": 1},
+		"mapInt32MessageField": {"1": {"nestedInt32": 2}}
+	}`, string(data))
+
+	tree, err := p.FindMessage("TreeNode")
+	require.NoError(t, err)
+
+	m = dynamic.NewMessage(tree)
+	require.NoError(t, m.UnmarshalJSON([]byte(`{"name": "root", "children": [{"name": "a"}, {"name": "b", "text": "t"}]}`)))
+	require.NoError(t, Redact(m, []string{"children.name"}, Redaction{Mode: RedactRemove}))
+
+	data, err = m.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name": "root", "children": [{}, {"text": "t"}]}`, string(data))
+
+	assert.EqualError(t, Redact(m, []string{"unknown"}, Redaction{Mode: RedactRemove}), "redact unknown: message example.TreeNode has no field unknown")
+	assert.EqualError(t, Redact(m, []string{"name.x"}, Redaction{Mode: RedactRemove}), "redact name.x: field name isn't a message")
+}
+
+func TestDiscardUnknown(t *testing.T) {
+	p, err := NewProto([]string{"testdata/recursive.proto"})
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("TreeNode")
+	require.NoError(t, err)
+
+	m := dynamic.NewMessage(md)
+	require.NoError(t, m.Unmarshal([]byte{
+		0x0a, 0x01, 'r', // name
+		0x12, 0x06, // children
+		0x0a, 0x01, 'c', // name
+		0xa0, 0x06, 0x01, // unknown field 100
+		0xaa, 0x06, 0x01, 'x', // unknown field 101
+	}))
+	require.Len(t, m.GetUnknownFields(), 1)
+
+	require.NoError(t, DiscardUnknown(m))
+	assert.Empty(t, m.GetUnknownFields())
+
+	data, err := m.Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x01, 'r', 0x12, 0x03, 0x0a, 0x01, 'c'}, data)
+}
+
+func TestRedact_Modes(t *testing.T) {
+	p, err := NewProto([]string{"testdata/types.proto"})
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("ExampleMessage")
+	require.NoError(t, err)
+
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{RedactRemove, `{"int32Field": 5}`},
+		{RedactMask, `{"stringField": "***", "bytesField": "Kioq", "int32Field": 5}`},
+		{RedactHash, `{"stringField": "hmac-sha256:25cf3c44c8f39313e8cbf7c23e22fe8b", "bytesField": "aG1hYy1zaGEyNTY6MjVjZjNjNDRjOGYzOTMxM2U4Y2JmN2MyM2UyMmZlOGI=", "int32Field": 5}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			m := dynamic.NewMessage(md)
+			require.NoError(t, m.UnmarshalJSON([]byte(`{"stringField": "secret", "bytesField": "c2VjcmV0", "int32Field": 5, "int64Field": 7}`)))
+			require.NoError(t, Redact(m, []string{"string_field", "bytes_field", "int64_field"}, Redaction{Mode: tt.mode, Key: []byte("key")}))
+
+			data, err := m.MarshalJSON()
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(data))
+		})
+	}
+
+	assert.EqualError(t, Redact(dynamic.NewMessage(md), nil, Redaction{Mode: "x"}), `unknown redact mode "x", use one of remove, mask, hash`)
+	assert.ErrorIs(t, Redact(dynamic.NewMessage(md), nil, Redaction{Mode: RedactHash}), ErrRedactKeyRequired)
+
+	// hashes depend on the key
+	other := RedactBytes([]byte("secret"), Redaction{Mode: RedactHash, Key: []byte("other")})
+	assert.NotEqual(t, RedactBytes([]byte("secret"), Redaction{Mode: RedactHash, Key: []byte("key")}), other)
+}
+
+func TestSensitiveFields(t *testing.T) {
+	p, err := NewProto([]string{"testdata/customer.proto"})
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("Customer")
+	require.NoError(t, err)
+
+	fields := SensitiveFields(md)
+
+	names := make([]string, 0, len(fields))
+	for _, fd := range fields {
+		names = append(names, fd.GetFullyQualifiedName())
+	}
+	assert.Equal(t, []string{"example.Customer.email", "example.Customer.card", "example.Customer.phone", "example.Address.street"}, names)
+
+	m := dynamic.NewMessage(md)
+	require.NoError(t, m.UnmarshalJSON([]byte(`{
+		"name": "Alice",
+		"email": "alice@example.com",
+		"phone": "123",
+		"address": {"city": "Paris", "street": "Rue"},
+		"referrals": [{"name": "Bob", "email": "bob@example.com"}]
+	}`)))
+	require.NoError(t, RedactFields(m, fields, Redaction{Mode: RedactMask}))
+
+	data, err := m.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"name": "Alice",
+		"email": "***",
+		"address": {"city": "Paris", "street": "***"},
+		"referrals": [{"name": "Bob", "email": "***"}]
+	}`, string(data))
+
+	other, err := NewProto([]string{"testdata/types.proto"})
+	require.NoError(t, err)
+
+	md, err = other.FindMessage("ExampleMessage")
+	require.NoError(t, err)
+	assert.Empty(t, SensitiveFields(md))
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanKindTag is a tag of span kind in FileSpan.
+const spanKindTag = "span.kind"
+
+// FileSpan is a finished span written by FileExporter in JSON lines.
+type FileSpan struct {
+	TraceID       string                 `json:"traceId"`
+	SpanID        string                 `json:"spanId"`
+	ParentSpanID  string                 `json:"parentSpanId,omitempty"`
+	OperationName string                 `json:"operationName"`
+	StartTime     time.Time              `json:"startTime"`
+	Duration      time.Duration          `json:"duration"`
+	Tags          map[string]interface{} `json:"tags,omitempty"`
+}
+
+// FileExporter writes finished spans to the writer in JSON lines, e.g. for offline debugging.
+type FileExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewFileExporter creates a new FileExporter, closer is closed on shutdown if it isn't nil.
+func NewFileExporter(w io.Writer, closer io.Closer) *FileExporter {
+	return &FileExporter{w: w, closer: closer}
+}
+
+// ExportSpans writes the spans.
+func (e *FileExporter) ExportSpans(_ context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, span := range spans {
+		sc := span.SpanContext()
+
+		s := FileSpan{
+			TraceID:       sc.TraceID().String(),
+			SpanID:        sc.SpanID().String(),
+			OperationName: span.Name(),
+			StartTime:     span.StartTime(),
+			Duration:      span.EndTime().Sub(span.StartTime()),
+			Tags:          map[string]interface{}{spanKindTag: span.SpanKind().String()},
+		}
+
+		if parent := span.Parent(); parent.IsValid() {
+			s.ParentSpanID = parent.SpanID().String()
+		}
+
+		for _, attr := range span.Attributes() {
+			s.Tags[string(attr.Key)] = attr.Value.AsInterface()
+		}
+
+		data, err := json.Marshal(s)
+		if err != nil {
+			data, _ = json.Marshal(map[string]string{"traceId": s.TraceID, "error": fmt.Sprint(err)})
+		}
+
+		if _, err := e.w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Shutdown closes the writer.
+func (e *FileExporter) Shutdown(context.Context) error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+
+	return nil
+}
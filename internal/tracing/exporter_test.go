@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	jaegerConfig "github.com/uber/jaeger-client-go/config"
+)
+
+func TestNewTracer_FileExporter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	cfg := &jaegerConfig.Configuration{
+		ServiceName: "test",
+		Sampler:     &jaegerConfig.SamplerConfig{Type: "const", Param: 1},
+	}
+
+	tracer, closer, err := NewTracer(cfg, Options{
+		Propagator: PropagatorW3C,
+		Exporter:   ExporterFile,
+		File:       filename,
+	})
+	require.NoError(t, err)
+
+	msg := &sarama.ProducerMessage{Topic: "test-topic"}
+	span, err := CreateSpan(tracer, msg)
+	require.NoError(t, err)
+	span.Finish()
+	require.NoError(t, closer.Close())
+
+	// headers are injected by the propagator
+	require.Len(t, msg.Headers, 1)
+	assert.Equal(t, "traceparent", string(msg.Headers[0].Key))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	var s FileSpan
+	require.NoError(t, json.Unmarshal(data, &s))
+	assert.Equal(t, tracingProduceOperationName, s.OperationName)
+	assert.Equal(t, "test-topic", s.Tags[tracingMessageTopicTag])
+	assert.Equal(t, "producer", s.Tags[spanKindTag])
+	assert.Equal(t, TraceID(span.Context()), s.TraceID)
+	assert.Contains(t, string(msg.Headers[0].Value), s.TraceID)
+}
+
+func TestNewTracer_OTLPHTTPExporter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/traces" {
+			atomic.AddInt32(&requests, 1)
+		}
+	}))
+	defer server.Close()
+
+	cfg := &jaegerConfig.Configuration{ServiceName: "test"}
+
+	tracer, closer, err := NewTracer(cfg, Options{
+		Propagator: PropagatorB3,
+		Exporter:   ExporterOTLPHTTP,
+		Endpoint:   server.URL,
+	})
+	require.NoError(t, err)
+
+	msg := &sarama.ProducerMessage{Topic: "test-topic"}
+	span, err := CreateSpan(tracer, msg)
+	require.NoError(t, err)
+	span.Finish()
+
+	// buffered spans are sent on close
+	require.NoError(t, closer.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	headers := make(map[string]string)
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	assert.Equal(t, TraceID(span.Context()), headers["x-b3-traceid"])
+}
+
+func TestNewTracer_InvalidOptions(t *testing.T) {
+	cfg := &jaegerConfig.Configuration{ServiceName: "test"}
+
+	_, _, err := NewTracer(cfg, Options{Propagator: "xray", Exporter: ExporterJaeger})
+	assert.EqualError(t, err, `unknown trace propagator "xray", use one of jaeger, w3c, b3`)
+
+	_, _, err = NewTracer(cfg, Options{Propagator: "xray", Exporter: ExporterOTLP})
+	assert.EqualError(t, err, `unknown trace propagator "xray", use one of jaeger, w3c, b3`)
+
+	_, _, err = NewTracer(cfg, Options{Propagator: PropagatorB3, Exporter: "zipkin"})
+	assert.EqualError(t, err, `unknown trace exporter "zipkin", use one of jaeger, otlp, otlp-grpc, otlp-http, stdout, file`)
+
+	_, _, err = NewTracer(cfg, Options{Propagator: PropagatorB3, Exporter: ExporterFile})
+	assert.EqualError(t, err, "file exporter requires trace file")
+
+	_, _, err = NewTracer(cfg, Options{Propagator: PropagatorB3, Exporter: ExporterOTLP, Endpoint: "ftp://localhost:4317"})
+	assert.EqualError(t, err, `invalid OTLP endpoint "ftp://localhost:4317": scheme must be http or https`)
+
+	_, _, err = NewJaegerTracer(cfg, Options{Propagator: PropagatorB3, Exporter: ExporterOTLP})
+	assert.EqualError(t, err, `jaeger tracer doesn't support "otlp" exporter`)
+
+	// OTLP exporter doesn't need collector to start
+	_, closer, err := NewTracer(cfg, Options{Propagator: PropagatorB3, Exporter: ExporterOTLP, Endpoint: "http://localhost:4317"})
+	require.NoError(t, err)
+	require.NoError(t, closer.Close())
+}
+
+func Test_parseOTLPEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		host     string
+		path     string
+		insecure bool
+	}{
+		{"collector:4317", "collector:4317", "", false},
+		{"http://localhost:4318/custom/traces/", "localhost:4318", "/custom/traces", true},
+		{"https://collector:4317", "collector:4317", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			host, path, insecure, err := parseOTLPEndpoint(tt.endpoint)
+			require.NoError(t, err)
+			assert.Equal(t, tt.host, host)
+			assert.Equal(t, tt.path, path)
+			assert.Equal(t, tt.insecure, insecure)
+		})
+	}
+}
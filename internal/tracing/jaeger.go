@@ -2,9 +2,11 @@ package tracing
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	jaegerConfig "github.com/uber/jaeger-client-go/config"
@@ -42,12 +44,107 @@ func NewJaegerConfig() (*jaegerConfig.Configuration, error) {
 	return jaegerCfg, nil
 }
 
+const (
+	// ExporterJaeger sends spans to Jaeger agent or collector with Jaeger client.
+	ExporterJaeger = "jaeger"
+	// ExporterOTLP sends spans to OpenTelemetry collector with OTLP over gRPC.
+	ExporterOTLP = "otlp"
+	// ExporterOTLPGRPC sends spans to OpenTelemetry collector with OTLP over gRPC.
+	ExporterOTLPGRPC = "otlp-grpc"
+	// ExporterOTLPHTTP sends spans to OpenTelemetry collector with OTLP over HTTP.
+	ExporterOTLPHTTP = "otlp-http"
+	// ExporterStdout writes spans to stdout in JSON lines.
+	ExporterStdout = "stdout"
+	// ExporterFile writes spans to the file in JSON lines.
+	ExporterFile = "file"
+)
+
+// Exporters is the list of span exporters.
+var Exporters = []string{ExporterJaeger, ExporterOTLP, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout, ExporterFile}
+
+// Options are options of tracers.
+type Options struct {
+	// Propagator is a format of headers spans are injected in
+	Propagator string
+	// Exporter is where finished spans are sent
+	Exporter string
+	// File is a file of spans of file exporter, spans are appended to it
+	File string
+	// Endpoint is a URL of OpenTelemetry collector of OTLP exporters, e.g. http://localhost:4317
+	Endpoint string
+}
+
+// OptionsFromConfig returns tracer options of flags and config.
+func OptionsFromConfig() Options {
+	return Options{
+		Propagator: viper.GetString("trace-propagator"),
+		Exporter:   viper.GetString("trace-exporter"),
+		File:       viper.GetString("trace-file"),
+		Endpoint:   viper.GetString("otlp-endpoint"),
+	}
+}
+
+// NewTracer creates a new tracer of options: OpenTelemetry SDK tracer,
+// or Jaeger client tracer with jaeger exporter for agents and collectors without OTLP.
+func NewTracer(
+	cfg *jaegerConfig.Configuration, opts Options, options ...jaegerConfig.Option,
+) (opentracing.Tracer, io.Closer, error) {
+	if opts.Exporter == ExporterJaeger {
+		return NewJaegerTracer(cfg, opts, options...)
+	}
+
+	return NewOTelTracer(cfg, opts)
+}
+
+// NewJaegerTracer creates a new Jaeger client tracer of the config sending spans to Jaeger,
+// it extracts span contexts of Jaeger, W3C and B3 headers.
+func NewJaegerTracer(
+	cfg *jaegerConfig.Configuration, opts Options, options ...jaegerConfig.Option,
+) (opentracing.Tracer, io.Closer, error) {
+	if opts.Exporter != ExporterJaeger {
+		return nil, nil, fmt.Errorf("jaeger tracer doesn't support %q exporter", opts.Exporter)
+	}
+
+	injector, err := NewInjector(opts.Propagator)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options = append(options,
+		jaegerConfig.Extractor(opentracing.TextMap, NewExtractor()),
+		jaegerConfig.Injector(opentracing.TextMap, injector),
+	)
+
+	return cfg.NewTracer(options...)
+}
+
+// SetJaegerFlags defines flags of Jaeger env vars and tracer options, they are bound to config with BindJaegerFlags.
 func SetJaegerFlags(flags *pflag.FlagSet) {
 	for envName, env := range jaegerEnvs {
 		var flag string
+		flags.StringVar(&flag, flagName(envName), env.defaultValue, env.usage)
+	}
+
+	flags.String("trace-propagator", PropagatorJaeger, fmt.Sprintf(
+		"Format of trace headers of produced messages: %s", strings.Join(Propagators, ", "),
+	))
+	flags.String("trace-exporter", ExporterJaeger, fmt.Sprintf(
+		"Where spans are sent: %s (Jaeger client with JAEGER_* settings), %s or %s (OTLP over gRPC), %s (OTLP over HTTP), %s or %s (JSON lines)",
+		ExporterJaeger, ExporterOTLP, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout, ExporterFile,
+	))
+	flags.String("trace-file", "", "File spans are appended to with file exporter")
+	flags.String("otlp-endpoint", "", "URL of OpenTelemetry collector of OTLP exporters, e.g. http://localhost:4317 (default OTEL_EXPORTER_OTLP_* env vars)")
+}
+
+// BindJaegerFlags binds flags of Jaeger env vars and tracer options to config,
+// it's called before the command runs because commands share names of flags.
+func BindJaegerFlags(flags *pflag.FlagSet) {
+	for envName := range jaegerEnvs {
 		name := flagName(envName)
+		_ = viper.BindPFlag(name, flags.Lookup(name))
+	}
 
-		flags.StringVar(&flag, name, env.defaultValue, env.usage)
+	for _, name := range []string{"trace-propagator", "trace-exporter", "trace-file", "otlp-endpoint"} {
 		_ = viper.BindPFlag(name, flags.Lookup(name))
 	}
 }
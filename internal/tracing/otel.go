@@ -0,0 +1,241 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	jaegerConfig "github.com/uber/jaeger-client-go/config"
+	b3Propagator "go.opentelemetry.io/contrib/propagators/b3"
+	jaegerPropagator "go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/attribute"
+	otelBridge "go.opentelemetry.io/otel/bridge/opentracing"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// shutdownTimeout limits the time of sending buffered spans on close.
+const shutdownTimeout = 5 * time.Second
+
+// NewOTelTracer creates a new OpenTracing tracer of OpenTelemetry SDK with the span exporter of options,
+// service name and sampler are taken from the Jaeger config.
+// It extracts span contexts of Jaeger, W3C and B3 headers like the Jaeger tracer.
+func NewOTelTracer(cfg *jaegerConfig.Configuration, opts Options) (opentracing.Tracer, io.Closer, error) {
+	propagator, err := NewTextMapPropagator(opts.Propagator)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exporter, batch, err := newSpanExporter(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// spans of file exporters are written when they are finished
+	spanProcessor := sdktrace.WithSyncer(exporter)
+	if batch {
+		spanProcessor = sdktrace.WithBatcher(exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		spanProcessor,
+		sdktrace.WithSampler(otelSampler(cfg.Sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+
+	tracer := otelBridge.NewBridgeTracer()
+	tracer.SetOpenTelemetryTracer(provider.Tracer("github.com/kuper-tech/protokaf"))
+	tracer.SetTextMapPropagator(propagator)
+
+	return tracer, providerCloser{provider}, nil
+}
+
+// providerCloser shuts down the tracer provider, it sends buffered spans and closes exporters.
+type providerCloser struct {
+	provider *sdktrace.TracerProvider
+}
+
+func (c providerCloser) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return c.provider.Shutdown(ctx)
+}
+
+// newSpanExporter creates a new span exporter of options, batch is set for exporters sending spans over network.
+func newSpanExporter(opts Options) (exporter sdktrace.SpanExporter, batch bool, err error) {
+	switch opts.Exporter {
+	case ExporterOTLP, ExporterOTLPGRPC:
+		grpcOpts, err := otlpGRPCOptions(opts.Endpoint)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// the connection is established in background, so exporter is created without collector
+		exporter, err := otlptracegrpc.New(context.Background(), grpcOpts...)
+		return exporter, true, err
+	case ExporterOTLPHTTP:
+		httpOpts, err := otlpHTTPOptions(opts.Endpoint)
+		if err != nil {
+			return nil, false, err
+		}
+
+		exporter, err := otlptracehttp.New(context.Background(), httpOpts...)
+		return exporter, true, err
+	case ExporterStdout:
+		return NewFileExporter(os.Stdout, nil), false, nil
+	case ExporterFile:
+		if opts.File == "" {
+			return nil, false, errors.New("file exporter requires trace file")
+		}
+
+		f, err := os.OpenFile(opts.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return NewFileExporter(f, f), false, nil
+	}
+
+	return nil, false, fmt.Errorf("unknown trace exporter %q, use one of %s", opts.Exporter, strings.Join(Exporters, ", "))
+}
+
+// parseOTLPEndpoint returns host:port and path of the endpoint, insecure is set for http scheme.
+// Endpoint without scheme is host:port of TLS connection. Empty endpoint is taken from OTEL_EXPORTER_OTLP_* env vars.
+func parseOTLPEndpoint(endpoint string) (host, path string, insecure bool, err error) {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, "", false, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid OTLP endpoint %q: %w", endpoint, err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		insecure = true
+	case "https":
+	default:
+		return "", "", false, fmt.Errorf("invalid OTLP endpoint %q: scheme must be http or https", endpoint)
+	}
+
+	return u.Host, strings.TrimRight(u.Path, "/"), insecure, nil
+}
+
+func otlpGRPCOptions(endpoint string) ([]otlptracegrpc.Option, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	host, _, insecure, err := parseOTLPEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(host)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	return opts, nil
+}
+
+func otlpHTTPOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	host, path, insecure, err := parseOTLPEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(host)}
+	if path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(path))
+	}
+	if insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	return opts, nil
+}
+
+// otelSampler returns a sampler of Jaeger sampler config, spans of sampled parents are always sampled.
+func otelSampler(cfg *jaegerConfig.SamplerConfig) sdktrace.Sampler {
+	root := sdktrace.AlwaysSample()
+
+	if cfg != nil {
+		switch cfg.Type {
+		case "const":
+			if cfg.Param == 0 {
+				root = sdktrace.NeverSample()
+			}
+		case "probabilistic", "remote":
+			root = sdktrace.TraceIDRatioBased(cfg.Param)
+		}
+	}
+
+	return sdktrace.ParentBased(root)
+}
+
+// NewTextMapPropagator creates a new propagator injecting span contexts in headers of the propagator
+// and extracting them from Jaeger uber-trace-id, W3C traceparent and B3 headers.
+func NewTextMapPropagator(propagator string) (propagation.TextMapPropagator, error) {
+	var inject propagation.TextMapPropagator
+
+	switch propagator {
+	case PropagatorJaeger:
+		inject = jaegerPropagator.Jaeger{}
+	case PropagatorW3C:
+		inject = propagation.TraceContext{}
+	case PropagatorB3:
+		inject = b3Propagator.New(b3Propagator.WithInjectEncoding(b3Propagator.B3MultipleHeader))
+	default:
+		return nil, fmt.Errorf("unknown trace propagator %q, use one of %s", propagator, strings.Join(Propagators, ", "))
+	}
+
+	return textMapPropagator{
+		inject: inject,
+		// later propagators override earlier ones, so Jaeger headers take precedence as in NewExtractor
+		extract: propagation.NewCompositeTextMapPropagator(
+			b3Propagator.New(),
+			propagation.TraceContext{},
+			jaegerPropagator.Jaeger{},
+		),
+	}, nil
+}
+
+// textMapPropagator injects span contexts with one propagator and extracts them with another.
+type textMapPropagator struct {
+	inject, extract propagation.TextMapPropagator
+}
+
+func (p textMapPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	p.inject.Inject(ctx, carrier)
+}
+
+// Extract extracts span context of headers case-insensitively like extractors of Jaeger client,
+// e.g. X-B3-TraceId is found by B3 propagator looking for x-b3-traceid.
+func (p textMapPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	headers := make(propagation.MapCarrier)
+	for _, key := range carrier.Keys() {
+		headers[strings.ToLower(key)] = carrier.Get(key)
+	}
+
+	return p.extract.Extract(ctx, headers)
+}
+
+func (p textMapPropagator) Fields() []string {
+	return p.inject.Fields()
+}
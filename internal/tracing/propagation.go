@@ -0,0 +1,179 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/uber/jaeger-client-go"
+	"github.com/uber/jaeger-client-go/zipkin"
+)
+
+const (
+	// PropagatorJaeger is a propagator of uber-trace-id header.
+	PropagatorJaeger = "jaeger"
+	// PropagatorW3C is a propagator of W3C traceparent header.
+	PropagatorW3C = "w3c"
+	// PropagatorB3 is a propagator of Zipkin X-B3-* headers.
+	PropagatorB3 = "b3"
+
+	w3cTraceParentHeader = "traceparent"
+	w3cVersion           = "00"
+	w3cInvalidVersion    = 0xff
+	w3cSampledFlag       = 0x01
+)
+
+// W3CPropagator injects and extracts span contexts in W3C traceparent header.
+type W3CPropagator struct{}
+
+// Inject sets traceparent header of the span context.
+func (W3CPropagator) Inject(sc jaeger.SpanContext, abstractCarrier interface{}) error {
+	writer, ok := abstractCarrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	var flags byte
+	if sc.IsSampled() {
+		flags |= w3cSampledFlag
+	}
+
+	traceID := sc.TraceID()
+	writer.Set(w3cTraceParentHeader, fmt.Sprintf(
+		"%s-%016x%016x-%016x-%02x", w3cVersion, traceID.High, traceID.Low, uint64(sc.SpanID()), flags,
+	))
+
+	return nil
+}
+
+// Extract returns the span context of traceparent header.
+func (W3CPropagator) Extract(abstractCarrier interface{}) (jaeger.SpanContext, error) {
+	reader, ok := abstractCarrier.(opentracing.TextMapReader)
+	if !ok {
+		return jaeger.SpanContext{}, opentracing.ErrInvalidCarrier
+	}
+
+	var traceParent string
+	err := reader.ForeachKey(func(key, value string) error {
+		if strings.EqualFold(key, w3cTraceParentHeader) {
+			traceParent = value
+		}
+		return nil
+	})
+	if err != nil {
+		return jaeger.SpanContext{}, err
+	}
+
+	if traceParent == "" {
+		return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+	}
+
+	return ParseTraceParent(traceParent)
+}
+
+// ParseTraceParent parses W3C traceparent: version-traceid-spanid-flags.
+// Version ff and all-zero trace ID and parent span ID are invalid, fields of versions after 00 are ignored.
+func ParseTraceParent(s string) (jaeger.SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return jaeger.SpanContext{}, fmt.Errorf("%w: invalid traceparent %q", opentracing.ErrSpanContextCorrupted, s)
+	}
+
+	version, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil || version == w3cInvalidVersion {
+		return jaeger.SpanContext{}, fmt.Errorf("%w: invalid version %q", opentracing.ErrSpanContextCorrupted, parts[0])
+	}
+
+	if version == 0 && len(parts) != 4 {
+		return jaeger.SpanContext{}, fmt.Errorf("%w: invalid traceparent %q", opentracing.ErrSpanContextCorrupted, s)
+	}
+
+	traceID, err := jaeger.TraceIDFromString(parts[1])
+	if err != nil || !traceID.IsValid() {
+		return jaeger.SpanContext{}, fmt.Errorf("%w: invalid trace id %q", opentracing.ErrSpanContextCorrupted, parts[1])
+	}
+
+	spanID, err := jaeger.SpanIDFromString(parts[2])
+	if err != nil || spanID == 0 {
+		return jaeger.SpanContext{}, fmt.Errorf("%w: invalid span id %q", opentracing.ErrSpanContextCorrupted, parts[2])
+	}
+
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return jaeger.SpanContext{}, fmt.Errorf("%w: invalid flags %q", opentracing.ErrSpanContextCorrupted, parts[3])
+	}
+
+	return jaeger.NewSpanContext(traceID, spanID, 0, flags&w3cSampledFlag != 0, nil), nil
+}
+
+// ParentSpanContext returns a sampled span context of an existing trace to continue:
+// W3C traceparent or trace ID with parent span ID in hex.
+func ParentSpanContext(traceParent, traceID, parentSpanID string) (jaeger.SpanContext, error) {
+	if traceParent != "" {
+		if traceID != "" || parentSpanID != "" {
+			return jaeger.SpanContext{}, errors.New("trace parent can't be used with trace ID and parent span ID")
+		}
+
+		return ParseTraceParent(traceParent)
+	}
+
+	if traceID == "" || parentSpanID == "" {
+		return jaeger.SpanContext{}, errors.New("trace ID requires parent span ID and vice versa")
+	}
+
+	tid, err := jaeger.TraceIDFromString(traceID)
+	if err != nil || !tid.IsValid() {
+		return jaeger.SpanContext{}, fmt.Errorf("invalid trace id %q", traceID)
+	}
+
+	sid, err := jaeger.SpanIDFromString(parentSpanID)
+	if err != nil || sid == 0 {
+		return jaeger.SpanContext{}, fmt.Errorf("invalid parent span id %q", parentSpanID)
+	}
+
+	return jaeger.NewSpanContext(tid, sid, 0, true, nil), nil
+}
+
+// Propagators is the list of propagators.
+var Propagators = []string{PropagatorJaeger, PropagatorW3C, PropagatorB3}
+
+// NewInjector creates a new injector of span contexts in headers of the propagator.
+func NewInjector(propagator string) (jaeger.Injector, error) {
+	switch propagator {
+	case PropagatorJaeger:
+		return jaeger.NewTextMapPropagator((&jaeger.HeadersConfig{}).ApplyDefaults(), *jaeger.NewNullMetrics()), nil
+	case PropagatorW3C:
+		return W3CPropagator{}, nil
+	case PropagatorB3:
+		return zipkin.NewZipkinB3HTTPHeaderPropagator(), nil
+	}
+
+	return nil, fmt.Errorf("unknown trace propagator %q, use one of %s", propagator, strings.Join(Propagators, ", "))
+}
+
+// multiExtractor extracts span context with the first extractor finding it.
+type multiExtractor []jaeger.Extractor
+
+// NewExtractor creates a new extractor of span contexts in Jaeger uber-trace-id, W3C traceparent and B3 headers.
+func NewExtractor() jaeger.Extractor {
+	return multiExtractor{
+		jaeger.NewTextMapPropagator((&jaeger.HeadersConfig{}).ApplyDefaults(), *jaeger.NewNullMetrics()),
+		W3CPropagator{},
+		zipkin.NewZipkinB3HTTPHeaderPropagator(),
+	}
+}
+
+func (e multiExtractor) Extract(carrier interface{}) (jaeger.SpanContext, error) {
+	for _, extractor := range e {
+		sc, err := extractor.Extract(carrier)
+		if errors.Is(err, opentracing.ErrSpanContextNotFound) {
+			continue
+		}
+
+		return sc, err
+	}
+
+	return jaeger.SpanContext{}, opentracing.ErrSpanContextNotFound
+}
@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestW3CPropagator(t *testing.T) {
+	sc, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+
+	headers := opentracing.TextMapCarrier{}
+	require.NoError(t, W3CPropagator{}.Inject(sc, headers))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", headers["traceparent"])
+
+	// short trace ids are padded
+	sc = jaeger.NewSpanContext(jaeger.TraceID{Low: 1}, 2, 0, false, nil)
+	require.NoError(t, W3CPropagator{}.Inject(sc, headers))
+	assert.Equal(t, "00-00000000000000000000000000000001-0000000000000002-00", headers["traceparent"])
+
+	extracted, err := W3CPropagator{}.Extract(headers)
+	require.NoError(t, err)
+	assert.Equal(t, sc.TraceID(), extracted.TraceID())
+	assert.False(t, extracted.IsSampled())
+
+}
+
+func TestParseTraceParent_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"no flags", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+		{"version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{"invalid version", "0x-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{"extra fields of version 00", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-00"},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{"zero parent span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{"invalid flags", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTraceParent(tt.value)
+			assert.ErrorIs(t, err, opentracing.ErrSpanContextCorrupted)
+		})
+	}
+
+	// fields of later versions are ignored
+	sc, err := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-00")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+}
+
+func TestNewExtractor(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers opentracing.TextMapCarrier
+		traceID string
+	}{
+		{"jaeger", opentracing.TextMapCarrier{"uber-trace-id": "a1b2:c3:0:1"}, "000000000000a1b2"},
+		{"w3c", opentracing.TextMapCarrier{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"b3", opentracing.TextMapCarrier{"X-B3-TraceId": "463ac35c9f6413ad", "X-B3-SpanId": "a2fb4a1d1a96d312", "X-B3-Sampled": "1"}, "463ac35c9f6413ad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := NewExtractor().Extract(tt.headers)
+			require.NoError(t, err)
+			assert.Equal(t, tt.traceID, sc.TraceID().String())
+		})
+	}
+
+	_, err := NewExtractor().Extract(opentracing.TextMapCarrier{"source": "app"})
+	assert.ErrorIs(t, err, opentracing.ErrSpanContextNotFound)
+}
+
+func TestParentSpanContext(t *testing.T) {
+	sc, err := ParentSpanContext("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+
+	sc, err = ParentSpanContext("", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+	assert.True(t, sc.IsSampled())
+
+	_, err = ParentSpanContext("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "")
+	assert.EqualError(t, err, "trace parent can't be used with trace ID and parent span ID")
+
+	_, err = ParentSpanContext("", "4bf92f3577b34da6a3ce929d0e0e4736", "")
+	assert.EqualError(t, err, "trace ID requires parent span ID and vice versa")
+
+	_, err = ParentSpanContext("", "xyz", "00f067aa0ba902b7")
+	assert.EqualError(t, err, `invalid trace id "xyz"`)
+
+	_, err = ParentSpanContext("", "4bf92f3577b34da6a3ce929d0e0e4736", "0")
+	assert.EqualError(t, err, `invalid parent span id "0"`)
+}
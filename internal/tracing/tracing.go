@@ -1,18 +1,27 @@
 package tracing
 
 import (
+	"fmt"
+
 	"github.com/Shopify/sarama"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
+	"github.com/uber/jaeger-client-go"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	tracingProduceOperationName = "produce"
+	tracingConsumeOperationName = "consume"
 	tracingMessageTopicTag      = "kafka.message.topic"
 	tracingMessageLengthTag     = "kafka.message.length"
+	tracingMessagePartitionTag  = "kafka.message.partition"
+	tracingMessageOffsetTag     = "kafka.message.offset"
 )
 
-func CreateSpan(tracer opentracing.Tracer, msg *sarama.ProducerMessage) (opentracing.Span, error) {
+// CreateSpan starts a producer span of the message and injects its context into headers,
+// the span is a root span unless options have a parent, e.g. opentracing.ChildOf.
+func CreateSpan(tracer opentracing.Tracer, msg *sarama.ProducerMessage, opts ...opentracing.StartSpanOption) (opentracing.Span, error) {
 	if tracer == nil {
 		tracer = opentracing.GlobalTracer()
 	}
@@ -22,15 +31,16 @@ func CreateSpan(tracer opentracing.Tracer, msg *sarama.ProducerMessage) (opentra
 		msgValueLen = v.Length()
 	}
 
+	// span kind is a start tag, OpenTelemetry spans can't change it later
 	tags := opentracing.Tags{
+		string(ext.SpanKind):    ext.SpanKindProducerEnum,
 		tracingMessageTopicTag:  msg.Topic,
 		tracingMessageLengthTag: msgValueLen,
 	}
 	span := tracer.StartSpan(
 		tracingProduceOperationName,
-		tags,
+		append(opts, tags)...,
 	)
-	ext.SpanKindProducer.Set(span)
 
 	// get OT header
 	headers := opentracing.TextMapCarrier{}
@@ -53,3 +63,58 @@ func CreateSpan(tracer opentracing.Tracer, msg *sarama.ProducerMessage) (opentra
 
 	return span, nil
 }
+
+// CreateConsumerSpan starts a consumer span of the record continuing the trace of its headers.
+// It returns opentracing.ErrSpanContextNotFound if headers have no trace context.
+func CreateConsumerSpan(tracer opentracing.Tracer, msg *sarama.ConsumerMessage) (opentracing.Span, error) {
+	if tracer == nil {
+		tracer = opentracing.GlobalTracer()
+	}
+
+	headers := opentracing.TextMapCarrier{}
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+
+	parent, err := tracer.Extract(opentracing.TextMap, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	span := tracer.StartSpan(
+		tracingConsumeOperationName,
+		opentracing.ChildOf(parent),
+		opentracing.Tags{
+			string(ext.SpanKind):       ext.SpanKindConsumerEnum,
+			tracingMessageTopicTag:     msg.Topic,
+			tracingMessagePartitionTag: msg.Partition,
+			tracingMessageOffsetTag:    msg.Offset,
+			tracingMessageLengthTag:    len(msg.Value),
+		},
+	)
+
+	return span, nil
+}
+
+// TraceID returns trace ID of the span context of Jaeger or OpenTelemetry tracer.
+func TraceID(sc opentracing.SpanContext) string {
+	switch sc := sc.(type) {
+	case jaeger.SpanContext:
+		return sc.TraceID().String()
+	case interface{ TraceID() trace.TraceID }:
+		return sc.TraceID().String()
+	}
+
+	return fmt.Sprint(sc)
+}
+
+// ContinueSpanContext returns a span context of the tracer continuing the trace of the span context,
+// e.g. of ParentSpanContext, so spans of OpenTelemetry tracer can be its children too.
+func ContinueSpanContext(tracer opentracing.Tracer, sc jaeger.SpanContext) (opentracing.SpanContext, error) {
+	headers := opentracing.TextMapCarrier{}
+	if err := (W3CPropagator{}).Inject(sc, headers); err != nil {
+		return nil, err
+	}
+
+	return tracer.Extract(opentracing.TextMap, headers)
+}
@@ -1,12 +1,21 @@
 package tracing
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Shopify/sarama"
+	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/mocktracer"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+	jaegerConfig "github.com/uber/jaeger-client-go/config"
 )
 
 func TestCreateSpan(t *testing.T) {
@@ -37,3 +46,120 @@ func TestCreateSpan(t *testing.T) {
 	}
 	defer span.Finish()
 }
+
+func TestCreateConsumerSpan(t *testing.T) {
+	reporter := jaeger.NewInMemoryReporter()
+	tracer, closer := jaeger.NewTracer(
+		"test", jaeger.NewConstSampler(true), reporter,
+		jaeger.TracerOptions.Extractor(opentracing.TextMap, NewExtractor()),
+	)
+	defer closer.Close()
+
+	msg := &sarama.ConsumerMessage{
+		Topic:     "test-topic",
+		Partition: 1,
+		Offset:    10,
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("traceparent"), Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+		},
+	}
+
+	span, err := CreateConsumerSpan(tracer, msg)
+	require.NoError(t, err)
+	span.Finish()
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(span.Context()))
+
+	spans := reporter.GetSpans()
+	require.Len(t, spans, 1)
+
+	consumed := spans[0].(*jaeger.Span)
+	assert.Equal(t, "00f067aa0ba902b7", consumed.SpanContext().ParentID().String())
+	assert.Equal(t, ext.SpanKindConsumer.Value, consumed.Tags()[string(ext.SpanKind)])
+	assert.Equal(t, int64(10), consumed.Tags()[tracingMessageOffsetTag])
+
+	_, err = CreateConsumerSpan(tracer, &sarama.ConsumerMessage{Topic: "test-topic"})
+	assert.ErrorIs(t, err, opentracing.ErrSpanContextNotFound)
+}
+
+func TestCreateSpan_Parent(t *testing.T) {
+	reporter := jaeger.NewInMemoryReporter()
+	tracer, closer := jaeger.NewTracer(
+		"test", jaeger.NewConstSampler(true), reporter,
+		jaeger.TracerOptions.Injector(opentracing.TextMap, W3CPropagator{}),
+	)
+	defer closer.Close()
+
+	parent, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	msg := &sarama.ProducerMessage{Topic: "test-topic"}
+	span, err := CreateSpan(tracer, msg, opentracing.ChildOf(parent))
+	require.NoError(t, err)
+	span.Finish()
+
+	sc := span.Context().(jaeger.SpanContext)
+	assert.Equal(t, parent.TraceID(), sc.TraceID())
+	assert.Equal(t, parent.SpanID(), sc.ParentID())
+
+	require.Len(t, msg.Headers, 1)
+	assert.Equal(t, "traceparent", string(msg.Headers[0].Key))
+	assert.Equal(t, fmt.Sprintf("00-4bf92f3577b34da6a3ce929d0e0e4736-%016x-01", uint64(sc.SpanID())), string(msg.Headers[0].Value))
+}
+
+func TestOTelTracer_Continue(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	cfg := &jaegerConfig.Configuration{ServiceName: "test"}
+	tracer, closer, err := NewOTelTracer(cfg, Options{Propagator: PropagatorJaeger, Exporter: ExporterFile, File: filename})
+	require.NoError(t, err)
+
+	// consumer spans continue traces of any format
+	for _, h := range []*sarama.RecordHeader{
+		{Key: []byte("uber-trace-id"), Value: []byte("4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1")},
+		{Key: []byte("traceparent"), Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+		{Key: []byte("X-B3-TraceId"), Value: []byte("4bf92f3577b34da6a3ce929d0e0e4736")},
+	} {
+		msg := &sarama.ConsumerMessage{Topic: "test-topic", Headers: []*sarama.RecordHeader{h}}
+		if string(h.Key) == "X-B3-TraceId" {
+			msg.Headers = append(msg.Headers,
+				&sarama.RecordHeader{Key: []byte("X-B3-SpanId"), Value: []byte("00f067aa0ba902b7")},
+				&sarama.RecordHeader{Key: []byte("X-B3-Sampled"), Value: []byte("1")},
+			)
+		}
+
+		span, err := CreateConsumerSpan(tracer, msg)
+		require.NoError(t, err, string(h.Key))
+		span.Finish()
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(span.Context()), string(h.Key))
+	}
+
+	// producer spans are children of parents of flags
+	parent, err := ParentSpanContext("", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	sc, err := ContinueSpanContext(tracer, parent)
+	require.NoError(t, err)
+
+	msg := &sarama.ProducerMessage{Topic: "test-topic"}
+	span, err := CreateSpan(tracer, msg, opentracing.ChildOf(sc))
+	require.NoError(t, err)
+	span.Finish()
+	require.NoError(t, closer.Close())
+
+	require.Len(t, msg.Headers, 1)
+	assert.Equal(t, "uber-trace-id", string(msg.Headers[0].Key))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(span.Context()))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 4)
+
+	var consumed, produced FileSpan
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &consumed))
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &produced))
+	assert.Equal(t, "consumer", consumed.Tags[spanKindTag])
+	assert.Equal(t, "00f067aa0ba902b7", produced.ParentSpanID)
+}
@@ -4,10 +4,11 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 
-	"github.com/golang/protobuf/jsonpb"
 	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/proto"
 )
 
 type Logger interface {
@@ -27,6 +28,15 @@ type Pairs []Pair
 
 // Dump dumps list of pairs with Logger.
 func (p Pairs) Dump(log Logger) {
+	p.print(log.Debugf, "Dump begin")
+}
+
+// Print prints list of pairs with Logger at info level.
+func (p Pairs) Print(log Logger, name string) {
+	p.print(log.Infof, name)
+}
+
+func (p Pairs) print(logf func(string, ...interface{}), name string) {
 	maxLen := 0
 	for _, m := range p {
 		if n := len(m.Name); maxLen < n {
@@ -39,50 +49,68 @@ func (p Pairs) Dump(log Logger) {
 		return n + pad
 	}
 
-	log.Debug(titleStd("Dump begin"))
+	logf("%s", titleStd(name))
 
 	for _, m := range p {
 		n, v := m.Name, m.Value
 
 		switch x := v.(type) {
 		case []byte:
-			log.Debugf("%s: <hex dump>\n%s", nameWithPad(n), hex.Dump(x))
+			logf("%s: <hex dump>\n%s", nameWithPad(n), hex.Dump(x))
 
 		default:
 			if v == "" {
 				v = "(empty)"
 			}
 
-			log.Debugf("%s: %v", nameWithPad(n), v)
+			logf("%s: %v", nameWithPad(n), v)
 		}
 	}
 }
 
-func marshalJSONCustom(msg *dynamic.Message) func() ([]byte, error) {
-	return func() ([]byte, error) {
-		return msg.MarshalJSONPB(&jsonpb.Marshaler{Indent: "  ", EmitDefaults: true})
+// DynamicMessage dumps dynamic.Message encoded by codec of the output.
+func DynamicMessage(log Logger, name, output string, codec proto.Codec, msg *dynamic.Message) {
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		log.Errorf("Error to marshal message: %s", err)
 	}
-}
 
-// DynamicMessage dumps dynamic.Message.
-func DynamicMessage(log Logger, name, output string, msg *dynamic.Message) {
-	marshaller := marshalJSONCustom(msg)
+	title := titleStd(fmt.Sprintf("%s (%s output)", name, output))
+	log.Infof("%s\n%s", title, string(data))
+}
 
-	switch output {
-	case "text":
-		marshaller = msg.MarshalTextIndent
+// WriteMessage writes message encoded by codec in one line. Codecs of binary formats encode
+// the value as is, so values which can't be decoded with the message are written too.
+// Value is the encoded message.
+func WriteMessage(w io.Writer, codec proto.Codec, msg *dynamic.Message, value []byte) error {
+	var (
+		line []byte
+		err  error
+	)
 
-	case "json":
-		marshaller = marshalJSONCustom(msg)
+	if m, ok := codec.(proto.ValueMarshaler); ok {
+		line, err = m.MarshalValue(value)
+	} else {
+		line, err = codec.Marshal(msg)
 	}
 
-	data, err := marshaller()
 	if err != nil {
-		log.Errorf("Error to marshal message: %s", err)
+		return err
 	}
 
-	title := titleStd(fmt.Sprintf("%s (%s output)", name, output))
-	log.Infof("%s\n%s", title, string(data))
+	_, err = w.Write(append(line, '\n'))
+
+	return err
+}
+
+// Text dumps text with title.
+func Text(log Logger, name, text string) {
+	log.Infof("%s\n%s", titleStd(name), text)
+}
+
+// Tombstone dumps a record without value.
+func Tombstone(log Logger, name string, key []byte) {
+	log.Infof("%s\nkey: %s", titleStd(name+" (tombstone)"), key)
 }
 
 func PrintStruct(log Logger, title string, i interface{}) {
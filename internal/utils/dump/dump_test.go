@@ -1,6 +1,14 @@
 package dump
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/kuper-tech/protokaf/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
 func Test_title(t *testing.T) {
 	type args struct {
@@ -26,3 +34,46 @@ func Test_title(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteMessage(t *testing.T) {
+	p, err := proto.NewProto([]string{"../../proto/testdata/example.proto"})
+	require.NoError(t, err)
+
+	md, err := p.FindMessage("HelloRequest")
+	require.NoError(t, err)
+
+	msg := dynamic.NewMessage(md)
+	msg.SetFieldByName("name", "Alice")
+
+	value, err := msg.Marshal()
+	require.NoError(t, err)
+
+	hexCodec, err := proto.NewCodec(proto.FormatHex)
+	require.NoError(t, err)
+
+	base64Codec, err := proto.NewCodec(proto.FormatBase64)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		codec proto.Codec
+		value []byte
+		want  string
+	}{
+		{"jsonl", proto.NewJSONCodec(proto.JSONOptions{}), value, "{\"name\":\"Alice\"}\n"},
+		{"jsonl defaults", proto.NewJSONCodec(proto.JSONOptions{EmitDefaults: true}), value, "{\"name\":\"Alice\",\"age\":0}\n"},
+		{"prototext-compact", proto.NewPrototextCodec(true), value, "name:\"Alice\"\n"},
+		{"hex", hexCodec, value, "0a05416c696365\n"},
+		{"base64", base64Codec, value, "CgVBbGljZQ==\n"},
+		// values of binary codecs are written as is
+		{"hex undecodable", hexCodec, []byte{0xff}, "ff\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			require.NoError(t, WriteMessage(&b, tt.codec, msg, tt.value))
+			assert.Equal(t, tt.want, b.String())
+		})
+	}
+}
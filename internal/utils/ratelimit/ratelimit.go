@@ -0,0 +1,228 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// recheckInterval is used to wait while the rate is zero.
+	recheckInterval = 10 * time.Millisecond
+
+	// maxReserveDelay is the longest wait for a token, the rate is re-evaluated after it
+	// because it may change a lot while ramping near zero.
+	maxReserveDelay = time.Second
+)
+
+// Clock tells the time and waits, it may be replaced in tests.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for the duration or until ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+	// AfterFunc calls f in its own goroutine after the duration, stop cancels the call.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// SystemClock is the Clock of the system time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+var units = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// Rate is a number of events per second, changed linearly from From to To during Ramp.
+type Rate struct {
+	From float64
+	To   float64
+	Ramp time.Duration
+}
+
+// ParseRate parses rate in format "<n>/<unit>" or "<n>/<unit>..<n>/<unit> over <duration>",
+// e.g. "500/s" or "100/s..2000/s over 5m". Units are ms, s, m and h, default unit is s.
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+
+	parts := strings.SplitN(s, "..", 2)
+	if len(parts) == 1 {
+		r, err := parseSingle(s)
+		return Rate{From: r, To: r}, err
+	}
+
+	to, over := parts[1], ""
+	if i := strings.Index(to, " over "); i >= 0 {
+		to, over = to[:i], to[i+len(" over "):]
+	}
+
+	if over == "" {
+		return Rate{}, fmt.Errorf(`rate: ramp duration is not set: %q, expected "<from>..<to> over <duration>"`, s)
+	}
+
+	ramp, err := time.ParseDuration(strings.TrimSpace(over))
+	if err != nil {
+		return Rate{}, fmt.Errorf("rate: invalid ramp duration: %w", err)
+	}
+
+	r := Rate{Ramp: ramp}
+	if r.From, err = parseSingle(parts[0]); err != nil {
+		return Rate{}, err
+	}
+	if r.To, err = parseSingle(to); err != nil {
+		return Rate{}, err
+	}
+
+	return r, nil
+}
+
+func parseSingle(s string) (float64, error) {
+	num, unit := strings.TrimSpace(s), "s"
+	if i := strings.Index(num, "/"); i >= 0 {
+		num, unit = strings.TrimSpace(num[:i]), strings.TrimSpace(num[i+1:])
+	}
+
+	per, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("rate: unknown unit %q in %q", unit, s)
+	}
+
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("rate: invalid number %q in %q", num, s)
+	}
+
+	return n * float64(time.Second) / float64(per), nil
+}
+
+// At returns the rate after elapsed time since the start.
+func (r Rate) At(elapsed time.Duration) float64 {
+	if r.Ramp <= 0 || elapsed >= r.Ramp {
+		return r.To
+	}
+
+	return r.From + (r.To-r.From)*float64(elapsed)/float64(r.Ramp)
+}
+
+func (r Rate) String() string {
+	if r.Ramp <= 0 {
+		return fmt.Sprintf("%g/s", r.To)
+	}
+
+	return fmt.Sprintf("%g/s..%g/s over %s", r.From, r.To, r.Ramp)
+}
+
+// Limiter is a token bucket limiter which may be shared by many goroutines.
+// The bucket is refilled with the rate changed over time.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   Rate
+	start  time.Time
+	last   time.Time
+	tokens float64
+	burst  float64
+	clock  Clock
+}
+
+// NewLimiter creates a new Limiter with given rate and bucket size.
+func NewLimiter(rate Rate, burst int) *Limiter {
+	return NewLimiterWithClock(rate, burst, SystemClock)
+}
+
+// NewLimiterWithClock creates a new Limiter with given rate and bucket size using the clock.
+func NewLimiterWithClock(rate Rate, burst int, clock Clock) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	now := clock.Now()
+
+	return &Limiter{
+		rate:   rate,
+		start:  now,
+		last:   now,
+		tokens: float64(burst),
+		burst:  float64(burst),
+		clock:  clock,
+	}
+}
+
+// Wait blocks until an event is allowed or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		delay, ok := l.reserve()
+		if delay > 0 {
+			if err := l.clock.Sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+
+		if ok {
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token and returns the time to wait for it.
+// Returns false if token was not taken because the rate is zero or too low
+// to wait for the next token, the caller should reserve again after the returned time.
+func (l *Limiter) reserve() (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	rate := l.rate.At(now.Sub(l.start))
+
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += rate * elapsed.Seconds()
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+
+		l.last = now
+	}
+
+	if rate <= 0 && l.tokens < 1 {
+		return recheckInterval, false
+	}
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0, true
+	}
+
+	delay := time.Duration((1 - l.tokens) / rate * float64(time.Second))
+	if delay > maxReserveDelay {
+		return maxReserveDelay, false
+	}
+
+	l.tokens--
+
+	return delay, true
+}
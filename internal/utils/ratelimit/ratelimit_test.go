@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Rate
+		wantErr bool
+	}{
+		{"500/s", Rate{500, 500, 0}, false},
+		{"500", Rate{500, 500, 0}, false},
+		{"60/m", Rate{1, 1, 0}, false},
+		{"2/ms", Rate{2000, 2000, 0}, false},
+		{"100/s..2000/s over 5m", Rate{100, 2000, 5 * time.Minute}, false},
+		{"100/s..2000/s", Rate{}, true},
+		{"100/d", Rate{}, true},
+		{"-1/s", Rate{}, true},
+		{"abc", Rate{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseRate(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRate_At(t *testing.T) {
+	r := Rate{From: 100, To: 200, Ramp: 10 * time.Second}
+
+	assert.Equal(t, float64(100), r.At(0))
+	assert.Equal(t, float64(150), r.At(5*time.Second))
+	assert.Equal(t, float64(200), r.At(20*time.Second))
+}
+
+// fakeClock is a clock which time is changed by tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(_ context.Context, d time.Duration) error {
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func (c *fakeClock) AfterFunc(time.Duration, func()) func() bool {
+	return func() bool { return false }
+}
+
+func TestLimiter_reserve(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	l := NewLimiterWithClock(Rate{From: 10, To: 10}, 1, clock)
+
+	delays := []time.Duration{}
+	for i := 0; i < 4; i++ {
+		d, ok := l.reserve()
+		assert.True(t, ok)
+		delays = append(delays, d)
+	}
+
+	assert.Equal(t, []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}, delays)
+
+	// tokens are refilled with time, but not over burst
+	clock.now = clock.now.Add(time.Second)
+	d, _ := l.reserve()
+	assert.Equal(t, time.Duration(0), d)
+}
+
+func TestLimiter_reserve_ZeroRate(t *testing.T) {
+	l := NewLimiter(Rate{}, 1)
+
+	_, ok := l.reserve()
+	assert.True(t, ok)
+
+	d, ok := l.reserve()
+	assert.False(t, ok)
+	assert.Equal(t, recheckInterval, d)
+}
+
+func TestLimiter_reserve_RampFromZero(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	// the rate is near zero at the start, the next token isn't waited for hours
+	l := NewLimiterWithClock(Rate{From: 0, To: 100, Ramp: 10 * time.Second}, 1, clock)
+
+	_, ok := l.reserve()
+	assert.True(t, ok)
+
+	clock.now = clock.now.Add(time.Millisecond)
+
+	d, ok := l.reserve()
+	assert.False(t, ok)
+	assert.Equal(t, maxReserveDelay, d)
+
+	// the rate is 10/s after a second
+	assert.Nil(t, l.Wait(context.Background()))
+	assert.Equal(t, time.Unix(1, 0).Add(time.Millisecond), clock.now)
+}
@@ -0,0 +1,412 @@
+package sink
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	// ManifestFile is the name of manifest in the output directory.
+	ManifestFile = "manifest.json"
+)
+
+// Options are options of files.
+type Options struct {
+	Dir string
+	// Extension of files without dot, e.g. jsonl
+	Extension   string
+	Compression string
+	// RotateSize is the max size of file data before compression, 0 is unlimited
+	RotateSize int64
+	// RotateEvery is the max time of writing to one file, 0 is unlimited.
+	// It's checked on writes, so a file of partition without new records is kept open until close.
+	RotateEvery time.Duration
+}
+
+// Manifest lists written files.
+type Manifest struct {
+	Files []ManifestFileEntry `json:"files"`
+}
+
+// ManifestFileEntry describes records of one file.
+type ManifestFileEntry struct {
+	File        string    `json:"file"`
+	Topic       string    `json:"topic"`
+	Partition   int32     `json:"partition"`
+	FirstOffset int64     `json:"first_offset"`
+	LastOffset  int64     `json:"last_offset"`
+	Records     int64     `json:"records"`
+	Bytes       int64     `json:"bytes"`
+	Created     time.Time `json:"created"`
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// FileSink writes records to files per topic partition and rotates them by size or time.
+// Manifest is updated on every rotation and on close. Files of a directory written before
+// are kept: their manifest entries are extended and new files are numbered after them.
+// FileSink is safe for concurrent use.
+type FileSink struct {
+	mu       sync.Mutex
+	opts     Options
+	files    map[topicPartition]*file
+	seq      map[topicPartition]int
+	manifest Manifest
+
+	now func() time.Time
+}
+
+type file struct {
+	f     *os.File
+	w     io.WriteCloser // compressor, nil if data isn't compressed
+	entry *ManifestFileEntry
+}
+
+// NewFileSink creates the output directory and a new FileSink, manifest of the directory is read if it exists.
+func NewFileSink(opts Options) (*FileSink, error) {
+	switch opts.Compression {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return nil, fmt.Errorf(
+			"unknown compression %q, use one of %s, %s, %s",
+			opts.Compression, CompressionNone, CompressionGzip, CompressionZstd,
+		)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	manifest, err := ReadManifest(opts.Dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return &FileSink{
+		opts:     opts,
+		files:    make(map[topicPartition]*file),
+		seq:      make(map[topicPartition]int),
+		manifest: manifest,
+		now:      time.Now,
+	}, nil
+}
+
+// Write writes data of the record at offset of topic partition.
+func (s *FileSink) Write(topic string, partition int32, offset int64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tp := topicPartition{topic, partition}
+
+	f := s.files[tp]
+	if f != nil && s.rotationNeeded(f, len(data)) {
+		if err := s.closeFile(tp); err != nil {
+			return err
+		}
+
+		if err := s.writeManifest(); err != nil {
+			return err
+		}
+
+		f = nil
+	}
+
+	if f == nil {
+		var err error
+		if f, err = s.openFile(tp); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = f.f
+	if f.w != nil {
+		w = f.w
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	if f.entry.Records == 0 {
+		f.entry.FirstOffset = offset
+	}
+	f.entry.LastOffset = offset
+	f.entry.Records++
+	f.entry.Bytes += int64(len(data))
+
+	return nil
+}
+
+// rotationNeeded reports whether data doesn't fit the file, a file has one record at least.
+func (s *FileSink) rotationNeeded(f *file, size int) bool {
+	if f.entry.Records == 0 {
+		return false
+	}
+
+	if s.opts.RotateSize > 0 && f.entry.Bytes+int64(size) > s.opts.RotateSize {
+		return true
+	}
+
+	return s.opts.RotateEvery > 0 && s.now().Sub(f.entry.Created) >= s.opts.RotateEvery
+}
+
+// openFile creates the next file of topic partition, existing files are skipped.
+func (s *FileSink) openFile(tp topicPartition) (*file, error) {
+	var (
+		name string
+		f    *os.File
+		err  error
+	)
+
+	for {
+		s.seq[tp]++
+
+		name = s.fileName(tp, s.seq[tp])
+		f, err = os.OpenFile(filepath.Join(s.opts.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+	}
+
+	res := &file{
+		f: f,
+		entry: &ManifestFileEntry{
+			File:      name,
+			Topic:     tp.topic,
+			Partition: tp.partition,
+			Created:   s.now(),
+		},
+	}
+
+	switch s.opts.Compression {
+	case CompressionGzip:
+		res.w = gzip.NewWriter(f)
+	case CompressionZstd:
+		if res.w, err = zstd.NewWriter(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	s.files[tp] = res
+
+	return res, nil
+}
+
+func (s *FileSink) fileName(tp topicPartition, seq int) string {
+	name := fmt.Sprintf("%s-%d-%06d", tp.topic, tp.partition, seq)
+	if s.opts.Extension != "" {
+		name += "." + s.opts.Extension
+	}
+
+	switch s.opts.Compression {
+	case CompressionGzip:
+		name += ".gz"
+	case CompressionZstd:
+		name += ".zst"
+	}
+
+	return name
+}
+
+// closeFile closes file of topic partition and adds it to manifest if it's closed successfully.
+func (s *FileSink) closeFile(tp topicPartition) error {
+	f := s.files[tp]
+	delete(s.files, tp)
+
+	var err error
+	if f.w != nil {
+		err = f.w.Close()
+	}
+
+	if closeErr := f.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("close %s: %w", f.entry.File, err)
+	}
+
+	s.manifest.Files = append(s.manifest.Files, *f.entry)
+
+	return nil
+}
+
+func (s *FileSink) writeManifest() error {
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(s.opts.Dir, ManifestFile), data, 0o644)
+}
+
+// Close closes all files and writes manifest, files failed to close aren't listed in it.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tps := make([]topicPartition, 0, len(s.files))
+	for tp := range s.files {
+		tps = append(tps, tp)
+	}
+
+	// files of the same partitions are listed in manifest in order
+	sort.Slice(tps, func(i, j int) bool {
+		if tps[i].topic != tps[j].topic {
+			return tps[i].topic < tps[j].topic
+		}
+
+		return tps[i].partition < tps[j].partition
+	})
+
+	var (
+		failed   int
+		firstErr error
+	)
+
+	for _, tp := range tps {
+		if err := s.closeFile(tp); err != nil {
+			if failed == 0 {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+
+	err := s.writeManifest()
+	if failed == 0 {
+		return err
+	}
+
+	closeErr := fmt.Errorf("%d of %d files failed to close, first error: %w", failed, len(tps), firstErr)
+	if err != nil {
+		return fmt.Errorf("%w (write manifest: %s)", closeErr, err)
+	}
+
+	return closeErr
+}
+
+// Manifest returns the list of closed files.
+func (s *FileSink) Manifest() Manifest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Manifest{Files: append([]ManifestFileEntry(nil), s.manifest.Files...)}
+}
+
+// Open opens file written by FileSink, gzip and zstd files are decompressed by extension.
+func Open(filename string) (io.ReadCloser, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch filepath.Ext(filename) {
+	case ".gz":
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		return &decompressor{Reader: r, r: r, f: f}, nil
+	case ".zst":
+		d, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		r := d.IOReadCloser()
+
+		return &decompressor{Reader: r, r: r, f: f}, nil
+	}
+
+	return f, nil
+}
+
+// decompressor closes decompressing reader and the file.
+type decompressor struct {
+	io.Reader
+	r io.Closer
+	f *os.File
+}
+
+func (d *decompressor) Close() error {
+	err := d.r.Close()
+	if closeErr := d.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// ReadManifest reads manifest of the directory written by FileSink.
+func ReadManifest(dir string) (Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses size in bytes with optional KB, MB or GB suffix, e.g. 100MB.
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, u.suffix))
+			mult = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, use bytes or number with KB, MB, GB suffix", s)
+	}
+
+	return n * mult, nil
+}
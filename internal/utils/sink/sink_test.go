@@ -0,0 +1,185 @@
+package sink
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink_RotateSize(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewFileSink(Options{Dir: dir, Extension: "jsonl", RotateSize: 10})
+	require.NoError(t, err)
+
+	for offset := int64(0); offset < 3; offset++ {
+		require.NoError(t, s.Write("test", 0, offset, []byte("{\"n\":1}\n")))
+	}
+	require.NoError(t, s.Write("test", 1, 7, []byte("{\"n\":2}\n")))
+	require.NoError(t, s.Close())
+
+	data, err := os.ReadFile(filepath.Join(dir, "test-0-000003.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"n\":1}\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, ManifestFile))
+	require.NoError(t, err)
+
+	var m Manifest
+	require.NoError(t, json.Unmarshal(data, &m))
+	require.Len(t, m.Files, 4)
+
+	assert.Equal(t, "test-0-000001.jsonl", m.Files[0].File)
+	assert.Equal(t, int64(0), m.Files[0].FirstOffset)
+	assert.Equal(t, int64(1), m.Files[1].FirstOffset)
+	assert.Equal(t, "test-0-000003.jsonl", m.Files[2].File)
+	assert.Equal(t, "test-1-000001.jsonl", m.Files[3].File)
+	assert.Equal(t, int32(1), m.Files[3].Partition)
+	assert.Equal(t, int64(7), m.Files[3].LastOffset)
+	assert.Equal(t, int64(8), m.Files[3].Bytes)
+}
+
+func TestFileSink_Rerun(t *testing.T) {
+	dir := t.TempDir()
+
+	for offset := int64(0); offset < 2; offset++ {
+		s, err := NewFileSink(Options{Dir: dir, Extension: "jsonl"})
+		require.NoError(t, err)
+		require.NoError(t, s.Write("test", 0, offset, []byte("{}\n")))
+		require.NoError(t, s.Close())
+	}
+
+	// files of the previous run are kept
+	m, err := ReadManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+
+	assert.Equal(t, "test-0-000001.jsonl", m.Files[0].File)
+	assert.Equal(t, int64(0), m.Files[0].FirstOffset)
+	assert.Equal(t, "test-0-000002.jsonl", m.Files[1].File)
+	assert.Equal(t, int64(1), m.Files[1].FirstOffset)
+}
+
+func TestFileSink_RotateEvery(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := NewFileSink(Options{Dir: t.TempDir(), RotateEvery: time.Hour})
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.Write("test", 0, 1, []byte("a")))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, s.Write("test", 0, 2, []byte("b")))
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, s.Write("test", 0, 3, []byte("c")))
+	require.NoError(t, s.Close())
+
+	files := s.Manifest().Files
+	require.Len(t, files, 2)
+	assert.Equal(t, int64(2), files[0].Records)
+	assert.Equal(t, int64(2), files[0].LastOffset)
+	assert.Equal(t, int64(3), files[1].FirstOffset)
+}
+
+func TestFileSink_Close_Failed(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := NewFileSink(Options{Dir: dir, Extension: "jsonl"})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Write("test", 0, 1, []byte("{}\n")))
+	require.NoError(t, s.Write("test", 1, 2, []byte("{}\n")))
+	require.NoError(t, s.Write("test", 2, 3, []byte("{}\n")))
+
+	// file of partition 0 is closed already
+	require.NoError(t, s.files[topicPartition{"test", 0}].f.Close())
+
+	err = s.Close()
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.Contains(t, err.Error(), "1 of 3 files failed to close, first error: close test-0-000001.jsonl")
+
+	// other files are closed and written to manifest
+	assert.Empty(t, s.files)
+
+	m, err := ReadManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, m.Files, 2)
+	assert.Equal(t, "test-1-000001.jsonl", m.Files[0].File)
+	assert.Equal(t, "test-2-000001.jsonl", m.Files[1].File)
+}
+
+func TestFileSink_Compression(t *testing.T) {
+	tests := []struct {
+		compression string
+		file        string
+		reader      func(r io.Reader) (io.Reader, error)
+	}{
+		{CompressionGzip, "test-0-000001.hex.gz", func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		}},
+		{CompressionZstd, "test-0-000001.hex.zst", func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compression, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s, err := NewFileSink(Options{Dir: dir, Extension: "hex", Compression: tt.compression})
+			require.NoError(t, err)
+			require.NoError(t, s.Write("test", 0, 0, []byte("0a05\n")))
+			require.NoError(t, s.Close())
+
+			f, err := os.Open(filepath.Join(dir, tt.file))
+			require.NoError(t, err)
+			defer f.Close()
+
+			r, err := tt.reader(f)
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "0a05\n", string(data))
+		})
+	}
+
+	_, err := NewFileSink(Options{Dir: t.TempDir(), Compression: "brotli"})
+	assert.Error(t, err)
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{"100", 100, false},
+		{"100B", 100, false},
+		{"2KB", 2048, false},
+		{"100MB", 100 << 20, false},
+		{"1gb", 1 << 30, false},
+		{"MB", 0, true},
+		{"-1MB", 0, true},
+		{"1.5MB", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseSize(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// reservoirSize is the number of latencies sampled to compute percentiles.
+const reservoirSize = 10000
+
+// Collector collects results of produced messages. It's safe for concurrent use.
+type Collector struct {
+	mu        sync.Mutex
+	start     time.Time
+	messages  int64
+	bytes     int64
+	errors    map[string]int64
+	latencies *reservoir
+
+	// beginning of the current interval
+	intervalStart     time.Time
+	intervalMessages  int64
+	intervalBytes     int64
+	intervalLatencies *reservoir
+
+	now func() time.Time
+}
+
+// NewCollector creates a new Collector, time is measured since creation.
+func NewCollector() *Collector {
+	now := time.Now()
+
+	return &Collector{
+		start:             now,
+		intervalStart:     now,
+		errors:            make(map[string]int64),
+		latencies:         newReservoir(reservoirSize),
+		intervalLatencies: newReservoir(reservoirSize),
+		now:               time.Now,
+	}
+}
+
+// Success adds message of given size produced with latency.
+func (c *Collector) Success(size int, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.messages++
+	c.bytes += int64(size)
+	c.latencies.Add(latency)
+	c.intervalLatencies.Add(latency)
+}
+
+// Error adds failed message, errors are counted by ErrorClass.
+func (c *Collector) Error(err error) {
+	class := ErrorClass(err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errors[class]++
+}
+
+// errorClasses are errors counted by their text.
+var errorClasses = []error{
+	context.DeadlineExceeded,
+	context.Canceled,
+	sarama.ErrOutOfBrokers,
+	sarama.ErrClosedClient,
+	sarama.ErrNotConnected,
+	sarama.ErrShuttingDown,
+	sarama.ErrInvalidPartition,
+	sarama.ErrIncompleteResponse,
+}
+
+// ErrorClass returns a stable class of error, so errors of different messages are counted together:
+// text of Kafka error code, of context error or of known client error, type of error otherwise.
+func ErrorClass(err error) string {
+	var kerr sarama.KError
+	if errors.As(err, &kerr) {
+		return kerr.Error()
+	}
+
+	for _, class := range errorClasses {
+		if errors.Is(err, class) {
+			return class.Error()
+		}
+	}
+
+	return fmt.Sprintf("%T", err)
+}
+
+// Report returns statistics since the start.
+func (c *Collector) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	errs := make(map[string]int64, len(c.errors))
+	for k, v := range c.errors {
+		errs[k] = v
+	}
+
+	return newReport(c.now().Sub(c.start), c.messages, c.bytes, errs, c.latencies)
+}
+
+// Interval returns statistics since the previous call and starts a new interval.
+func (c *Collector) Interval() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	r := newReport(
+		now.Sub(c.intervalStart),
+		c.messages-c.intervalMessages,
+		c.bytes-c.intervalBytes,
+		nil,
+		c.intervalLatencies,
+	)
+
+	c.intervalStart = now
+	c.intervalMessages = c.messages
+	c.intervalBytes = c.bytes
+	c.intervalLatencies = newReservoir(reservoirSize)
+
+	return r
+}
+
+// Latency is latency percentiles in milliseconds.
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// Report is statistics of produced messages.
+type Report struct {
+	DurationSeconds   float64          `json:"duration_seconds"`
+	Messages          int64            `json:"messages"`
+	Bytes             int64            `json:"bytes"`
+	MessagesPerSecond float64          `json:"messages_per_second"`
+	BytesPerSecond    float64          `json:"bytes_per_second"`
+	Errors            map[string]int64 `json:"errors,omitempty"`
+	LatencyMs         Latency          `json:"latency_ms"`
+}
+
+func newReport(d time.Duration, messages, bytes int64, errs map[string]int64, latencies *reservoir) Report {
+	r := Report{
+		DurationSeconds: d.Seconds(),
+		Messages:        messages,
+		Bytes:           bytes,
+		Errors:          errs,
+	}
+
+	if s := d.Seconds(); s > 0 {
+		r.MessagesPerSecond = float64(messages) / s
+		r.BytesPerSecond = float64(bytes) / s
+	}
+
+	if len(latencies.samples) > 0 {
+		sorted := make([]time.Duration, len(latencies.samples))
+		copy(sorted, latencies.samples)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		r.LatencyMs = Latency{
+			P50: ms(percentile(sorted, 50)),
+			P90: ms(percentile(sorted, 90)),
+			P99: ms(percentile(sorted, 99)),
+			Max: ms(latencies.max),
+		}
+	}
+
+	return r
+}
+
+// ErrorsCount returns the total number of errors.
+func (r Report) ErrorsCount() (n int64) {
+	for _, v := range r.Errors {
+		n += v
+	}
+
+	return
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf(
+		"%d messages in %.1fs, %.1f msg/s, %.1f KiB/s, errors: %d, latency p50: %.2fms, p90: %.2fms, p99: %.2fms, max: %.2fms",
+		r.Messages, r.DurationSeconds, r.MessagesPerSecond, r.BytesPerSecond/1024, r.ErrorsCount(),
+		r.LatencyMs.P50, r.LatencyMs.P90, r.LatencyMs.P99, r.LatencyMs.Max,
+	)
+}
+
+// ErrorsString returns errors counts sorted by error.
+func (r Report) ErrorsString() string {
+	keys := make([]string, 0, len(r.Errors))
+	for k := range r.Errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		lines = append(lines, fmt.Sprintf("%d: %s", r.Errors[k], k))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// reservoir is a uniform random sample of a fixed number of latencies, percentiles
+// are exact until the sample is full. The maximum is tracked exactly.
+type reservoir struct {
+	samples []time.Duration
+	seen    int64
+	max     time.Duration
+	rnd     *rand.Rand
+}
+
+func newReservoir(size int) *reservoir {
+	return &reservoir{
+		samples: make([]time.Duration, 0, size),
+		rnd:     rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+}
+
+// Add adds latency to the sample replacing a random one if the sample is full.
+func (r *reservoir) Add(d time.Duration) {
+	r.seen++
+	if d > r.max {
+		r.max = d
+	}
+
+	if len(r.samples) < cap(r.samples) {
+		r.samples = append(r.samples, d)
+		return
+	}
+
+	if i := r.rnd.Int63n(r.seen); i < int64(len(r.samples)) {
+		r.samples[i] = d
+	}
+}
+
+// percentile returns nearest-rank percentile of sorted values.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,84 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	c := NewCollector()
+	c.start, c.intervalStart, c.now = now, now, func() time.Time { return now }
+
+	for i := 1; i <= 100; i++ {
+		c.Success(10, time.Duration(i)*time.Millisecond)
+	}
+	c.Error(context.DeadlineExceeded)
+	c.Error(fmt.Errorf("message 1: %w", context.DeadlineExceeded))
+
+	now = now.Add(2 * time.Second)
+	r := c.Report()
+
+	assert.Equal(t, int64(100), r.Messages)
+	assert.Equal(t, int64(1000), r.Bytes)
+	assert.Equal(t, float64(50), r.MessagesPerSecond)
+	assert.Equal(t, float64(500), r.BytesPerSecond)
+	assert.Equal(t, int64(2), r.ErrorsCount())
+	assert.Equal(t, "2: context deadline exceeded", r.ErrorsString())
+	assert.Equal(t, Latency{P50: 50, P90: 90, P99: 99, Max: 100}, r.LatencyMs)
+
+	// intervals
+	assert.Equal(t, int64(100), c.Interval().Messages)
+
+	c.Success(10, time.Millisecond)
+	now = now.Add(time.Second)
+
+	i := c.Interval()
+	assert.Equal(t, int64(1), i.Messages)
+	assert.Equal(t, float64(1), i.MessagesPerSecond)
+	assert.Equal(t, float64(1), i.LatencyMs.Max)
+}
+
+func TestCollector_ErrorClasses(t *testing.T) {
+	c := NewCollector()
+
+	// errors of the same type and code are counted in one bucket
+	c.Error(&sarama.ProducerError{Msg: &sarama.ProducerMessage{Offset: 1}, Err: sarama.ErrNotLeaderForPartition})
+	c.Error(&sarama.ProducerError{Msg: &sarama.ProducerMessage{Offset: 2}, Err: sarama.ErrNotLeaderForPartition})
+	c.Error(fmt.Errorf("record 1: %w", sarama.ErrOutOfBrokers))
+	c.Error(errors.New("template: field 1"))
+	c.Error(errors.New("template: field 2"))
+
+	assert.Equal(t, map[string]int64{
+		sarama.ErrNotLeaderForPartition.Error(): 2,
+		sarama.ErrOutOfBrokers.Error():          1,
+		"*errors.errorString":                   2,
+	}, c.Report().Errors)
+}
+
+func Test_percentile(t *testing.T) {
+	values := []time.Duration{1, 2, 3}
+
+	assert.Equal(t, time.Duration(2), percentile(values, 50))
+	assert.Equal(t, time.Duration(3), percentile(values, 99))
+	assert.Equal(t, time.Duration(1), percentile(values, 0))
+}
+
+func Test_reservoir(t *testing.T) {
+	r := newReservoir(10)
+
+	for i := 1; i <= 1000; i++ {
+		r.Add(time.Duration(i))
+	}
+
+	assert.Len(t, r.samples, 10)
+	assert.Equal(t, int64(1000), r.seen)
+	assert.Equal(t, time.Duration(1000), r.max)
+}